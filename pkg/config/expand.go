@@ -117,6 +117,23 @@ limitations under the License.
 //	  proxies, embedded Basic Authentication and other features from
 //	  that function.
 //
+//	${vault:mount/path#field}
+//
+//	  The field of the HashiCorp Vault secret at mount/path is fetched.
+//	  KV version 1 and 2 secrets engines are supported, and for version
+//	  2 the `data/` path element is added automatically. If #field is
+//	  omitted the whole secret is returned as JSON. The server and
+//	  authentication (token, AppRole or Kubernetes) are configured
+//	  from the `VAULT_*` environment variables, see [NewVault], or by
+//	  passing a client with the config.UseVault() option. Secrets are
+//	  cached, respecting any lease, and are only ever held in protected
+//	  memory when using ExpandToEnclave() and similar.
+//
+//	  Examples:
+//
+//	  - password: ${vault:secret/geneos/gateway#password}
+//	  - dbuser: ${vault:database/creds/readonly#username}
+//
 //	The prefix below can be enabled with the config.Expressions() option.
 //
 //	${expr:EXPRESSION}
@@ -277,6 +294,17 @@ func (c *Config) Expand(input string, options ...ExpandOptions) (value []byte) {
 			}
 			return c.expandEncodedBytes(s[4:], options...)
 		}
+		if opts.vaultClient() && bytes.HasPrefix(s, []byte("vault:")) {
+			if e := expandVaultEnclave(string(s[6:]), opts); e != nil {
+				l, _ := e.Open()
+				defer l.Destroy()
+				if opts.trimSpace {
+					return bytes.Clone(bytes.TrimSpace(l.Bytes()))
+				}
+				return bytes.Clone(l.Bytes())
+			}
+			return
+		}
 		str, _ := c.ExpandRawString(string(s), options...)
 		return []byte(str)
 	})
@@ -343,6 +371,9 @@ func (c *Config) ExpandToEnclave(input string, options ...ExpandOptions) (value
 			}
 			return c.expandEncodedBytesEnclave(s[4:], options...)
 		}
+		if opts.vaultClient() && bytes.HasPrefix(s, []byte("vault:")) {
+			return expandVaultEnclave(string(s[6:]), opts)
+		}
 		str, _ := c.ExpandRawString(string(s), options...)
 		return memguard.NewEnclave([]byte(str))
 	})
@@ -389,6 +420,13 @@ func (c *Config) ExpandToLockedBuffer(input string, options ...ExpandOptions) (v
 			}
 			return c.expandEncodedBytesLockedBuffer(s[4:], options...)
 		}
+		if opts.vaultClient() && bytes.HasPrefix(s, []byte("vault:")) {
+			if e := expandVaultEnclave(string(s[6:]), opts); e != nil {
+				l, _ := e.Open()
+				return l
+			}
+			return nil
+		}
 		str, _ := c.ExpandRawString(string(s), options...)
 		return memguard.NewBufferFromBytes([]byte(str))
 	})
@@ -691,7 +729,11 @@ func (c *Config) ExpandRawString(s string, options ...ExpandOptions) (value stri
 		// the above test would have picked it up. it is up to the
 		// function called to trim whitespace, if required.
 		f := strings.SplitN(s, ":", 2)
-		if fn, ok := opts.funcMaps[f[0]]; ok {
+		fn, ok := opts.funcMaps[f[0]]
+		if f[0] == "vault" && opts.vault != nil {
+			fn, ok = opts.vault.Expand, true
+		}
+		if ok {
 			if opts.trimPrefix {
 				value, err = fn(c, f[1], opts.trimSpace)
 			} else {
@@ -17,7 +17,10 @@ limitations under the License.
 
 package config
 
-import "sync"
+import (
+	"reflect"
+	"sync"
+)
 
 type expandOptions struct {
 	defaultValue       any
@@ -34,6 +37,7 @@ type expandOptions struct {
 	trimPrefix         bool
 	trimSpace          bool
 	usekeyfile         string
+	vault              *Vault
 }
 
 // ExpandOptions control the way configuration options undergo string
@@ -52,6 +56,7 @@ var defaultFuncMaps = map[string]func(*Config, string, bool) (string, error){
 	"http":  fetchURL,
 	"https": fetchURL,
 	"file":  fetchFile,
+	"vault": fetchVault,
 }
 var defaultFuncMapsMutex sync.Mutex
 
@@ -153,6 +158,31 @@ func Prefix(prefix string, fn func(*Config, string, bool) (string, error)) Expan
 	}
 }
 
+// UseVault sets the Vault client used for `${vault:mount/path#field}`
+// expansions, instead of the default client configured from the
+// environment. Unlike Prefix("vault", v.Expand), ExpandToEnclave and
+// other functions that return protected values read the secret from
+// the client without an intermediate string, and the client only
+// applies to the call it is passed to.
+func UseVault(v *Vault) ExpandOptions {
+	return func(e *expandOptions) {
+		e.vault = v
+	}
+}
+
+// vaultClient returns true if `${vault:...}` expansions should read
+// the secret directly from a Vault client, which is the one set with
+// UseVault or, for the built-in `vault` prefix, the default client.
+// Otherwise, if a different function has been set for the prefix with
+// Prefix, that function is used as for any other prefix.
+func (e *expandOptions) vaultClient() bool {
+	if e.vault != nil {
+		return true
+	}
+	fn, ok := e.funcMaps["vault"]
+	return ok && reflect.ValueOf(fn).Pointer() == reflect.ValueOf(fetchVault).Pointer()
+}
+
 // ExternalLookups enables or disables the built-in expansion options
 // that fetch data from outside the program, such as URLs and file
 // paths. The default is true.
@@ -0,0 +1,694 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/awnumar/memguard"
+)
+
+// DefaultVaultCacheTTL is how long secrets without a lease are cached
+// by a Vault client unless changed with VaultCacheTTL
+const DefaultVaultCacheTTL = 5 * time.Minute
+
+// default Kubernetes service account token location
+const vaultKubernetesJWTFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// Vault is a client for reading secrets from a HashiCorp Vault server
+// for `${vault:mount/path#field}` expansion. Create one with NewVault
+// and use it with the UseVault or Prefix expand options, or rely on the
+// built-in default client which is configured from the standard
+// `VAULT_*` environment variables.
+//
+// Secrets, and the client token, are held in memguard enclaves. Secrets
+// that come with a lease are cached until shortly before the lease
+// expires, otherwise they are cached for the cache TTL.
+type Vault struct {
+	address    string
+	namespace  string
+	auth       string
+	authMount  string
+	token      *memguard.Enclave
+	roleID     string
+	secretID   *memguard.Enclave
+	role       string
+	jwtFile    string
+	cacheTTL   time.Duration
+	httpClient *http.Client
+
+	mutex        sync.Mutex
+	clientToken  *memguard.Enclave
+	tokenExpires time.Time
+	mounts       map[string]string
+	cache        map[string]vaultCacheEntry
+}
+
+type vaultCacheEntry struct {
+	data    *memguard.Enclave
+	expires time.Time
+}
+
+// VaultOptions are used to configure a Vault client created with
+// NewVault
+type VaultOptions func(*Vault)
+
+// NewVault returns a new Vault client. The client is first configured
+// from the environment variables `VAULT_ADDR`, `VAULT_NAMESPACE`,
+// `VAULT_CACERT` and `VAULT_SKIP_VERIFY`, as for the Vault CLI, and
+// then authentication is selected from, in order, `VAULT_TOKEN`,
+// `VAULT_ROLE_ID` and `VAULT_SECRET_ID` for AppRole, `VAULT_K8S_ROLE`
+// and optionally `VAULT_K8S_JWT_FILE` for Kubernetes, and finally a
+// token in `~/.vault-token`. `VAULT_AUTH_MOUNT` overrides the default
+// mount point for AppRole and Kubernetes authentication. Options then
+// override any of these.
+func NewVault(options ...VaultOptions) (v *Vault) {
+	v = &Vault{
+		address:  "https://127.0.0.1:8200",
+		auth:     "token",
+		cacheTTL: DefaultVaultCacheTTL,
+		mounts:   map[string]string{},
+		cache:    map[string]vaultCacheEntry{},
+	}
+
+	if addr := os.Getenv("VAULT_ADDR"); addr != "" {
+		v.address = addr
+	}
+	v.namespace = os.Getenv("VAULT_NAMESPACE")
+	v.authMount = os.Getenv("VAULT_AUTH_MOUNT")
+
+	switch {
+	case os.Getenv("VAULT_TOKEN") != "":
+		v.token = memguard.NewEnclave([]byte(os.Getenv("VAULT_TOKEN")))
+	case os.Getenv("VAULT_ROLE_ID") != "":
+		v.auth = "approle"
+		v.roleID = os.Getenv("VAULT_ROLE_ID")
+		v.secretID = memguard.NewEnclave([]byte(os.Getenv("VAULT_SECRET_ID")))
+	case os.Getenv("VAULT_K8S_ROLE") != "":
+		v.auth = "kubernetes"
+		v.role = os.Getenv("VAULT_K8S_ROLE")
+		v.jwtFile = os.Getenv("VAULT_K8S_JWT_FILE")
+	default:
+		if home, err := UserHomeDir(); err == nil {
+			if t, err := os.ReadFile(path.Join(home, ".vault-token")); err == nil {
+				v.token = memguard.NewEnclave(bytes.TrimSpace(t))
+			}
+		}
+	}
+
+	tlsConfig := &tls.Config{}
+	if cafile := os.Getenv("VAULT_CACERT"); cafile != "" {
+		if pem, err := os.ReadFile(cafile); err == nil {
+			tlsConfig.RootCAs = x509.NewCertPool()
+			tlsConfig.RootCAs.AppendCertsFromPEM(pem)
+		}
+	}
+	if skip, _ := strconv.ParseBool(os.Getenv("VAULT_SKIP_VERIFY")); skip {
+		tlsConfig.InsecureSkipVerify = true
+	}
+	v.httpClient = &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}
+
+	for _, opt := range options {
+		opt(v)
+	}
+	return
+}
+
+// VaultAddress sets the URL of the Vault server, e.g.
+// `https://vault.example.com:8200`
+func VaultAddress(address string) VaultOptions {
+	return func(v *Vault) {
+		v.address = address
+	}
+}
+
+// VaultNamespace sets the Vault Enterprise namespace for all requests
+func VaultNamespace(namespace string) VaultOptions {
+	return func(v *Vault) {
+		v.namespace = namespace
+	}
+}
+
+// VaultToken selects token authentication using token
+func VaultToken(token *Plaintext) VaultOptions {
+	return func(v *Vault) {
+		v.auth = "token"
+		v.token = token.Enclave
+	}
+}
+
+// VaultAppRole selects AppRole authentication using roleID and
+// secretID
+func VaultAppRole(roleID string, secretID *Plaintext) VaultOptions {
+	return func(v *Vault) {
+		v.auth = "approle"
+		v.roleID = roleID
+		v.secretID = secretID.Enclave
+	}
+}
+
+// VaultKubernetes selects Kubernetes authentication as role using the
+// service account JWT in jwtFile. If jwtFile is empty then the default
+// service account token file for a pod is used.
+func VaultKubernetes(role, jwtFile string) VaultOptions {
+	return func(v *Vault) {
+		v.auth = "kubernetes"
+		v.role = role
+		v.jwtFile = jwtFile
+	}
+}
+
+// VaultAuthMount sets the mount point of the AppRole or Kubernetes
+// authentication method, if not the default of `approle` or
+// `kubernetes` respectively
+func VaultAuthMount(mount string) VaultOptions {
+	return func(v *Vault) {
+		v.authMount = mount
+	}
+}
+
+// VaultCacheTTL sets how long secrets without a lease are cached. A
+// ttl of zero disables caching of these secrets. Secrets with a lease
+// are always cached until shortly before the lease expires.
+func VaultCacheTTL(ttl time.Duration) VaultOptions {
+	return func(v *Vault) {
+		v.cacheTTL = ttl
+	}
+}
+
+// VaultHTTPClient sets the HTTP client used for all requests, replacing
+// the one configured from the environment
+func VaultHTTPClient(client *http.Client) VaultOptions {
+	return func(v *Vault) {
+		v.httpClient = client
+	}
+}
+
+var defaultVault *Vault
+var defaultVaultOnce sync.Once
+
+// getDefaultVault returns the built-in Vault client, creating it from
+// the environment on first use
+func getDefaultVault() *Vault {
+	defaultVaultOnce.Do(func() {
+		defaultVault = NewVault()
+	})
+	return defaultVault
+}
+
+// fetchVault is the built-in `vault` prefix function using the default
+// Vault client
+func fetchVault(c *Config, s string, trim bool) (string, error) {
+	return getDefaultVault().Expand(c, s, trim)
+}
+
+// Expand has the signature required by the Prefix expand option so
+// that a configured client can be used for the `vault` prefix, e.g.
+//
+//	config.Prefix("vault", v.Expand)
+//
+// s is the secret reference `mount/path#field`, with or without the
+// leading `vault:`. Prefer UseVault, with which ExpandToEnclave and
+// other functions that return protected values read the secret from v
+// without an intermediate string.
+func (v *Vault) Expand(_ *Config, s string, trim bool) (value string, err error) {
+	e, err := v.Read(strings.TrimPrefix(s, "vault:"))
+	if err != nil {
+		return
+	}
+	l, err := e.Open()
+	if err != nil {
+		return
+	}
+	defer l.Destroy()
+	if trim {
+		return string(bytes.TrimSpace(l.Bytes())), nil
+	}
+	return string(l.Bytes()), nil
+}
+
+// Read returns the secret identified by ref, in the form
+// `mount/path#field`, in an enclave. For KV version 2 mounts the
+// `data/` path element is added automatically. If the field is not
+// given then the JSON encoding of all the fields of the secret is
+// returned. String values are returned without JSON quoting, other
+// values as JSON.
+func (v *Vault) Read(ref string) (value *memguard.Enclave, err error) {
+	p, field, _ := strings.Cut(ref, "#")
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil, fmt.Errorf("vault: invalid secret reference %q", ref)
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	data, err := v.secret(p)
+	if err != nil {
+		return
+	}
+	defer data.Destroy()
+
+	if field == "" {
+		return memguard.NewEnclave(bytes.Clone(data.Bytes())), nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(data.Bytes(), &fields); err != nil {
+		return nil, fmt.Errorf("vault: %s: %w", p, err)
+	}
+	defer func() {
+		for _, f := range fields {
+			memguard.WipeBytes(f)
+		}
+	}()
+	raw, ok := fields[field]
+	if !ok {
+		return nil, fmt.Errorf("vault: %s: field %q %w", p, field, fs.ErrNotExist)
+	}
+	if len(raw) > 0 && raw[0] == '"' {
+		b, err := unquoteJSONBytes(raw)
+		if err != nil {
+			return nil, fmt.Errorf("vault: %s: field %q: %w", p, field, err)
+		}
+		return memguard.NewEnclave(b), nil
+	}
+	return memguard.NewEnclave(bytes.Clone(raw)), nil
+}
+
+// secret returns the data of the secret at path p, from the cache if
+// it has not expired. The caller must hold the mutex and destroy the
+// returned buffer.
+func (v *Vault) secret(p string) (data *memguard.LockedBuffer, err error) {
+	if c, ok := v.cache[p]; ok {
+		if time.Now().Before(c.expires) {
+			return c.data.Open()
+		}
+		delete(v.cache, p)
+	}
+
+	mount, version, err := v.mount(p)
+	if err != nil {
+		return
+	}
+	apiPath := p
+	if version == "2" {
+		apiPath = mount + "data/" + strings.TrimPrefix(p, mount)
+	}
+
+	body, err := v.request(http.MethodGet, apiPath, nil)
+	if err != nil {
+		return
+	}
+	defer memguard.WipeBytes(body)
+
+	var resp struct {
+		LeaseID       string          `json:"lease_id"`
+		LeaseDuration int             `json:"lease_duration"`
+		Data          json.RawMessage `json:"data"`
+	}
+	if err = json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("vault: %s: %w", p, err)
+	}
+	defer memguard.WipeBytes(resp.Data)
+
+	raw := resp.Data
+	if version == "2" {
+		var kv2 struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err = json.Unmarshal(resp.Data, &kv2); err != nil {
+			return nil, fmt.Errorf("vault: %s: %w", p, err)
+		}
+		defer memguard.WipeBytes(kv2.Data)
+		raw = kv2.Data
+	}
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		// a deleted KV v2 secret returns metadata but no data
+		return nil, fmt.Errorf("vault: %s: %w", p, fs.ErrNotExist)
+	}
+
+	// secrets with a lease, e.g. dynamic database credentials, are
+	// kept until just before the lease expires so that new credentials
+	// are not created on every expansion. KV version 1 returns a lease
+	// duration as a refresh hint but no lease ID.
+	lease := time.Duration(resp.LeaseDuration) * time.Second
+	ttl := v.cacheTTL
+	if resp.LeaseID != "" {
+		ttl = lease * 9 / 10
+	} else if lease > 0 && lease < ttl {
+		ttl = lease
+	}
+	if ttl > 0 {
+		v.cache[p] = vaultCacheEntry{
+			data:    memguard.NewEnclave(bytes.Clone(raw)),
+			expires: time.Now().Add(ttl),
+		}
+	}
+
+	return memguard.NewBufferFromBytes(bytes.Clone(raw)), nil
+}
+
+// mount returns the mount point, with a trailing slash, and the KV
+// version, if any, of the secrets engine for path p. Results are
+// cached for the life of the client.
+func (v *Vault) mount(p string) (mount, version string, err error) {
+	for m, ver := range v.mounts {
+		if strings.HasPrefix(p, m) && len(m) > len(mount) {
+			mount, version = m, ver
+		}
+	}
+	if mount != "" {
+		return
+	}
+
+	body, err := v.request(http.MethodGet, "sys/internal/ui/mounts/"+p, nil)
+	if err != nil {
+		return
+	}
+	var resp struct {
+		Data struct {
+			Path    string            `json:"path"`
+			Type    string            `json:"type"`
+			Options map[string]string `json:"options"`
+		} `json:"data"`
+	}
+	if err = json.Unmarshal(body, &resp); err != nil {
+		return "", "", fmt.Errorf("vault: mount for %s: %w", p, err)
+	}
+	mount = resp.Data.Path
+	if mount == "" {
+		return "", "", fmt.Errorf("vault: no secrets engine mounted for %s: %w", p, fs.ErrNotExist)
+	}
+	if resp.Data.Type == "kv" || resp.Data.Type == "generic" {
+		version = resp.Data.Options["version"]
+		if version == "" {
+			version = "1"
+		}
+	}
+	v.mounts[mount] = version
+	return
+}
+
+// request sends a request to the Vault API path p, relative to `/v1/`,
+// with the client token and namespace and returns the response body.
+// If the token has been rejected and can be renewed by logging in
+// again then the request is retried once.
+func (v *Vault) request(method, p string, body []byte) (out []byte, err error) {
+	for retry := 0; retry < 2; retry++ {
+		var token *memguard.LockedBuffer
+		if token, err = v.login(); err != nil {
+			return
+		}
+
+		var status int
+		out, status, err = v.do(method, p, body, token)
+		if token != nil {
+			token.Destroy()
+		}
+		if err != nil {
+			return
+		}
+		if status == http.StatusForbidden && v.auth != "token" && retry == 0 {
+			// token may have been revoked or expired early
+			v.clientToken = nil
+			continue
+		}
+		if status == http.StatusNotFound {
+			return nil, fmt.Errorf("vault: %s: %w", p, fs.ErrNotExist)
+		}
+		if status > 299 {
+			err = vaultError(p, status, out)
+			memguard.WipeBytes(out)
+			return nil, err
+		}
+		return
+	}
+	return
+}
+
+// do performs a single HTTP request
+func (v *Vault) do(method, p string, body []byte, token *memguard.LockedBuffer) (out []byte, status int, err error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(v.address, "/")+"/v1/"+p, r)
+	if err != nil {
+		return
+	}
+	req.Header.Set("X-Vault-Request", "true")
+	if token != nil && token.Size() > 0 {
+		req.Header["X-Vault-Token"] = []string{string(token.Bytes())}
+	}
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("vault: %w", err)
+	}
+	defer resp.Body.Close()
+	out, err = io.ReadAll(resp.Body)
+	return out, resp.StatusCode, err
+}
+
+// login returns the client token, logging in first for AppRole and
+// Kubernetes authentication if there is no token or it has expired.
+// The caller must destroy the returned buffer.
+func (v *Vault) login() (token *memguard.LockedBuffer, err error) {
+	if v.auth == "token" {
+		if v.token == nil {
+			return
+		}
+		return v.token.Open()
+	}
+
+	if v.clientToken != nil && (v.tokenExpires.IsZero() || time.Now().Before(v.tokenExpires)) {
+		return v.clientToken.Open()
+	}
+
+	var body []byte
+	mount := v.authMount
+	switch v.auth {
+	case "approle":
+		if mount == "" {
+			mount = "approle"
+		}
+		body = append(body, `{"role_id":`...)
+		body = appendJSONBytes(body, []byte(v.roleID))
+		if v.secretID != nil {
+			s, err := v.secretID.Open()
+			if err != nil {
+				return nil, err
+			}
+			body = append(body, `,"secret_id":`...)
+			body = appendJSONBytes(body, s.Bytes())
+			s.Destroy()
+		}
+		body = append(body, '}')
+	case "kubernetes":
+		if mount == "" {
+			mount = "kubernetes"
+		}
+		jwtFile := v.jwtFile
+		if jwtFile == "" {
+			jwtFile = vaultKubernetesJWTFile
+		}
+		jwt, err := os.ReadFile(jwtFile)
+		if err != nil {
+			return nil, fmt.Errorf("vault: %w", err)
+		}
+		body = append(body, `{"role":`...)
+		body = appendJSONBytes(body, []byte(v.role))
+		body = append(body, `,"jwt":`...)
+		body = appendJSONBytes(body, bytes.TrimSpace(jwt))
+		body = append(body, '}')
+		memguard.WipeBytes(jwt)
+	default:
+		return nil, fmt.Errorf("vault: unknown authentication method %q", v.auth)
+	}
+	defer memguard.WipeBytes(body)
+
+	out, status, err := v.do(http.MethodPost, "auth/"+strings.Trim(mount, "/")+"/login", body, nil)
+	if err != nil {
+		return
+	}
+	defer memguard.WipeBytes(out)
+	if status > 299 {
+		return nil, vaultError("login", status, out)
+	}
+
+	var resp struct {
+		Auth struct {
+			ClientToken   json.RawMessage `json:"client_token"`
+			LeaseDuration int             `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	if err = json.Unmarshal(out, &resp); err != nil {
+		return nil, fmt.Errorf("vault: login: %w", err)
+	}
+	t, err := unquoteJSONBytes(resp.Auth.ClientToken)
+	memguard.WipeBytes(resp.Auth.ClientToken)
+	if err != nil || len(t) == 0 {
+		return nil, fmt.Errorf("vault: login: no client token returned")
+	}
+
+	v.clientToken = memguard.NewEnclave(t)
+	v.tokenExpires = time.Time{}
+	if resp.Auth.LeaseDuration > 0 {
+		v.tokenExpires = time.Now().Add(time.Duration(resp.Auth.LeaseDuration) * time.Second * 9 / 10)
+	}
+	return v.clientToken.Open()
+}
+
+// vaultError returns an error using the messages in a Vault error
+// response body
+func vaultError(p string, status int, body []byte) error {
+	var resp struct {
+		Errors []string `json:"errors"`
+	}
+	if json.Unmarshal(body, &resp) == nil && len(resp.Errors) > 0 {
+		return fmt.Errorf("vault: %s: %s (%d)", p, strings.Join(resp.Errors, ", "), status)
+	}
+	return fmt.Errorf("vault: %s: %s", p, http.StatusText(status))
+}
+
+// appendJSONBytes appends s as a quoted JSON string to dst without
+// converting it to a Go string
+func appendJSONBytes(dst, s []byte) []byte {
+	const hex = "0123456789abcdef"
+	dst = append(dst, '"')
+	for _, c := range s {
+		switch {
+		case c == '"', c == '\\':
+			dst = append(dst, '\\', c)
+		case c < 0x20:
+			dst = append(dst, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return append(dst, '"')
+}
+
+// unquoteJSONBytes returns the contents of the quoted JSON string raw
+// as a new byte slice, without converting it to a Go string
+func unquoteJSONBytes(raw []byte) (out []byte, err error) {
+	if len(raw) < 2 || raw[0] != '"' || raw[len(raw)-1] != '"' {
+		return nil, errors.New("not a JSON string")
+	}
+	raw = raw[1 : len(raw)-1]
+	out = make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c != '\\' {
+			out = append(out, c)
+			continue
+		}
+		i++
+		if i == len(raw) {
+			return nil, errors.New("invalid JSON string escape")
+		}
+		switch raw[i] {
+		case '"', '\\', '/':
+			out = append(out, raw[i])
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'u':
+			r, n := unquoteJSONRune(raw[i+1:])
+			if n == 0 {
+				return nil, errors.New("invalid JSON string escape")
+			}
+			if utf16.IsSurrogate(r) && len(raw) >= i+1+n+6 && raw[i+1+n] == '\\' && raw[i+2+n] == 'u' {
+				if r2, m := unquoteJSONRune(raw[i+3+n:]); m > 0 {
+					if d := utf16.DecodeRune(r, r2); d != utf8.RuneError {
+						r = d
+						n += 2 + m
+					}
+				}
+			}
+			out = utf8.AppendRune(out, r)
+			i += n
+		default:
+			return nil, errors.New("invalid JSON string escape")
+		}
+	}
+	return
+}
+
+// unquoteJSONRune decodes the four hex digits at the start of b
+func unquoteJSONRune(b []byte) (r rune, n int) {
+	if len(b) < 4 {
+		return
+	}
+	v, err := strconv.ParseUint(string(b[:4]), 16, 16)
+	if err != nil {
+		return
+	}
+	return rune(v), 4
+}
+
+// expandVaultEnclave returns the secret for ref in an enclave, using
+// the client from UseVault, if any, or the default client. Errors
+// result in a nil enclave, as for other expansions.
+func expandVaultEnclave(ref string, opts *expandOptions) *memguard.Enclave {
+	v := opts.vault
+	if v == nil {
+		v = getDefaultVault()
+	}
+	e, err := v.Read(ref)
+	if err != nil {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testVault returns a client for a Vault stand-in that serves a KV v2
+// secret at secret/geneos/gateway and a KV v1 secret at kv/legacy, and
+// counters for the logins and reads made
+func testVault(t *testing.T) (v *Vault, reads, logins *int) {
+	reads, logins = new(int), new(int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/approle/login":
+			*logins++
+			w.Write([]byte(`{"auth":{"client_token":"s.test","lease_duration":3600}}`))
+			return
+		case "/v1/sys/internal/ui/mounts/secret/geneos/gateway":
+			w.Write([]byte(`{"data":{"path":"secret/","type":"kv","options":{"version":"2"}}}`))
+			return
+		case "/v1/sys/internal/ui/mounts/kv/legacy":
+			w.Write([]byte(`{"data":{"path":"kv/","type":"kv","options":null}}`))
+			return
+		}
+		if r.Header.Get("X-Vault-Token") != "s.test" || r.Header.Get("X-Vault-Namespace") != "ns1" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		*reads++
+		switch r.URL.Path {
+		case "/v1/secret/data/geneos/gateway":
+			w.Write([]byte(`{"data":{"data":{"password":"pa\"ssé","port":7039}}}`))
+		case "/v1/kv/legacy":
+			w.Write([]byte(`{"lease_duration":600,"data":{"user":"geneos"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	v = NewVault(
+		VaultAddress(srv.URL),
+		VaultNamespace("ns1"),
+		VaultAppRole("role", NewPlaintext([]byte("secret"))),
+	)
+	return
+}
+
+func TestVaultExpand(t *testing.T) {
+	v, reads, logins := testVault(t)
+	cf := New()
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"${vault:secret/geneos/gateway#password}", `pa"ssé`},
+		{"${vault:secret/geneos/gateway#port}", "7039"},
+		{"user=${vault:kv/legacy#user}", "user=geneos"},
+		{"${vault:kv/legacy#missing}", ""},
+		{"${vault:secret/geneos/missing#password}", ""},
+	}
+	for _, tt := range tests {
+		if got := cf.ExpandString(tt.input, UseVault(v)); got != tt.want {
+			t.Errorf("ExpandString(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	e := cf.ExpandToEnclave("${vault:secret/geneos/gateway#password}", UseVault(v))
+	if e == nil {
+		t.Fatal("ExpandToEnclave returned nil")
+	}
+	l, err := e.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(l.Bytes()) != `pa"ssé` {
+		t.Errorf("ExpandToEnclave returned %q", l.Bytes())
+	}
+	l.Destroy()
+
+	if got := cf.ExpandString("${vault:kv/legacy}", UseVault(v)); !strings.Contains(got, `"user":"geneos"`) {
+		t.Errorf("whole secret returned %q", got)
+	}
+
+	// one login, and one read for each path found, the rest cached
+	if *logins != 1 || *reads != 3 {
+		t.Errorf("got %d logins and %d reads, want 1 and 3", *logins, *reads)
+	}
+
+	// the client must not be used once UseVault is no longer given
+	if got := cf.ExpandString("${vault:secret/geneos/gateway#password}"); got == `pa"ssé` {
+		t.Error("ExpandString without UseVault used the earlier client")
+	}
+}
+
+func TestVaultPrefix(t *testing.T) {
+	// Prefix with the default external lookups adds to the shared
+	// prefix functions, so restore the built-in one afterwards
+	t.Cleanup(func() {
+		defaultFuncMapsMutex.Lock()
+		defaultFuncMaps["vault"] = fetchVault
+		defaultFuncMapsMutex.Unlock()
+	})
+
+	v, _, _ := testVault(t)
+	cf := New()
+
+	for _, fn := range []struct {
+		name   string
+		prefix func(*Config, string, bool) (string, error)
+		want   string
+	}{
+		{"client", v.Expand, `pa"ssé`},
+		{"custom", func(_ *Config, s string, _ bool) (string, error) { return "custom " + s, nil }, "custom vault:secret/geneos/gateway#password"},
+	} {
+		opt := Prefix("vault", fn.prefix)
+		input := "${vault:secret/geneos/gateway#password}"
+
+		if got := cf.ExpandString(input, opt); got != fn.want {
+			t.Errorf("%s: ExpandString returned %q, want %q", fn.name, got, fn.want)
+		}
+		if got := string(cf.Expand(input, opt)); got != fn.want {
+			t.Errorf("%s: Expand returned %q, want %q", fn.name, got, fn.want)
+		}
+		e := cf.ExpandToEnclave(input, opt)
+		if e == nil {
+			t.Errorf("%s: ExpandToEnclave returned nil", fn.name)
+		} else if l, err := e.Open(); err != nil || string(l.Bytes()) != fn.want {
+			t.Errorf("%s: ExpandToEnclave returned %q, %v", fn.name, l.Bytes(), err)
+		} else {
+			l.Destroy()
+		}
+		l := cf.ExpandToLockedBuffer(input, opt)
+		if string(l.Bytes()) != fn.want {
+			t.Errorf("%s: ExpandToLockedBuffer returned %q", fn.name, l.Bytes())
+		}
+		l.Destroy()
+	}
+}
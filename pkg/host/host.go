@@ -71,6 +71,7 @@ type Host interface {
 	Stat(name string) (f fs.FileInfo, err error)
 	Symlink(oldname, newname string) (err error)
 	TempDir() string
+	Truncate(name string, size int64) (err error)
 	WriteFile(name string, data []byte, perm os.FileMode) (err error)
 	// these two do not conform to the afero / os interface
 	Open(name string) (f io.ReadSeekCloser, err error)
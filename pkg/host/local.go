@@ -189,6 +189,10 @@ func (h *Local) TempDir() string {
 	return os.TempDir()
 }
 
+func (h *Local) Truncate(name string, size int64) (err error) {
+	return os.Truncate(name, size)
+}
+
 func (h *Local) Signal(pid int, signal syscall.Signal) (err error) {
 	proc, _ := os.FindProcess(pid)
 	if err = proc.Signal(signal); err != nil && !errors.Is(err, syscall.EEXIST) {
@@ -0,0 +1,834 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package host
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/mem"
+)
+
+// Memory is a Host backed by an in-memory filesystem, for testing. It
+// behaves like a Linux remote host: paths are always slash separated,
+// symbolic links are supported and processes started with Start appear
+// under `/proc/PID` with `exe`, `cmdline`, `environ`, `cwd`, `stat` and
+// `status` entries so that process lookups work as for a real host.
+//
+// The results of running and starting commands are scripted with
+// OnCommand. By default commands succeed with no output and started
+// processes keep running until sent SIGTERM, SIGINT, SIGQUIT or SIGKILL.
+type Memory struct {
+	name     string
+	hostname string
+	username string
+	homedir  string
+	goos     string
+	goarch   string
+	uid      int
+	gid      int
+	fs       afero.Fs
+
+	mutex     sync.Mutex
+	cwd       string
+	owners    map[string][2]int
+	commands  map[string]MemoryCommandFunc
+	processes map[int]*MemoryProcess
+	nextPID   int
+	failed    error
+}
+
+var _ Host = (*Memory)(nil)
+
+// MemoryProcess is a fake process started on a Memory host
+type MemoryProcess struct {
+	PID     int
+	Path    string
+	Args    []string
+	Env     []string
+	Dir     string
+	Started time.Time
+
+	// Signals records all the signals sent to the process
+	Signals []syscall.Signal
+
+	ignore []syscall.Signal
+}
+
+// MemoryResult is the scripted result of a command on a Memory host
+type MemoryResult struct {
+	// Stdout is returned by Run, and written to the errfile by Start
+	Stdout []byte
+
+	// Stderr is written to the errfile given to Run and Start
+	Stderr []byte
+
+	// ExitCode is the exit status of the command. For Start a non-zero
+	// exit code means the process exits immediately.
+	ExitCode int
+
+	// Err, if set, is returned as the error from Run or Start, as if
+	// the command could not be executed
+	Err error
+
+	// Ignore lists signals, other than SIGKILL, that do not terminate a
+	// process started with Start
+	Ignore []syscall.Signal
+}
+
+// MemoryCommandFunc returns the result for cmd run or started on h
+type MemoryCommandFunc func(h *Memory, cmd *exec.Cmd) MemoryResult
+
+// MemoryExitError is returned by Run on a Memory host for a scripted
+// non-zero exit code
+type MemoryExitError struct {
+	Code int
+}
+
+func (e *MemoryExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ExitCode returns the scripted exit code, as for exec.ExitError
+func (e *MemoryExitError) ExitCode() int {
+	return e.Code
+}
+
+// MemoryOptions are used to configure a Memory host
+type MemoryOptions func(*Memory)
+
+// NewMemory returns a new Memory host called name, with an empty
+// filesystem other than the user's home directory, `/tmp` and `/proc`.
+// The defaults are a hostname the same as name, a username of `geneos`
+// with a home directory of `/home/geneos`, linux on amd64 and the uid
+// and gid of the current process as file owner.
+func NewMemory(name string, options ...MemoryOptions) (h *Memory) {
+	h = &Memory{
+		name:      name,
+		hostname:  name,
+		username:  "geneos",
+		goos:      "linux",
+		goarch:    "amd64",
+		uid:       os.Getuid(),
+		gid:       os.Getgid(),
+		fs:        afero.NewMemMapFs(),
+		owners:    map[string][2]int{},
+		commands:  map[string]MemoryCommandFunc{},
+		processes: map[int]*MemoryProcess{},
+		nextPID:   1000,
+	}
+	for _, opt := range options {
+		opt(h)
+	}
+	if h.homedir == "" {
+		h.homedir = path.Join("/home", h.username)
+	}
+	h.cwd = h.homedir
+	for _, dir := range []string{h.homedir, "/tmp", "/proc"} {
+		h.fs.MkdirAll(dir, 0755)
+	}
+	return
+}
+
+// MemoryHostname sets the hostname of a Memory host
+func MemoryHostname(hostname string) MemoryOptions {
+	return func(h *Memory) {
+		h.hostname = hostname
+	}
+}
+
+// MemoryUsername sets the username of a Memory host
+func MemoryUsername(username string) MemoryOptions {
+	return func(h *Memory) {
+		h.username = username
+	}
+}
+
+// MemoryHomedir sets the home directory, and initial working directory,
+// of a Memory host
+func MemoryHomedir(dir string) MemoryOptions {
+	return func(h *Memory) {
+		h.homedir = dir
+	}
+}
+
+// MemoryOS sets the operating system and architecture returned by Uname
+func MemoryOS(goos, goarch string) MemoryOptions {
+	return func(h *Memory) {
+		h.goos, h.goarch = goos, goarch
+	}
+}
+
+// MemoryOwner sets the default uid and gid of files and processes
+func MemoryOwner(uid, gid int) MemoryOptions {
+	return func(h *Memory) {
+		h.uid, h.gid = uid, gid
+	}
+}
+
+// OnCommand sets fn to be called to get the result of running or
+// starting program, which is matched first against the full path of the
+// command and then the base name. An empty program sets the default for
+// all commands without their own function.
+func OnCommand(program string, fn MemoryCommandFunc) MemoryOptions {
+	return func(h *Memory) {
+		h.commands[program] = fn
+	}
+}
+
+// OnCommand sets fn as the function for program after h is created. See
+// the OnCommand option.
+func (h *Memory) OnCommand(program string, fn MemoryCommandFunc) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.commands[program] = fn
+}
+
+// Processes returns the processes running on h, sorted by PID
+func (h *Memory) Processes() (processes []*MemoryProcess) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, p := range h.processes {
+		processes = append(processes, p)
+	}
+	sort.Slice(processes, func(i, j int) bool { return processes[i].PID < processes[j].PID })
+	return
+}
+
+// Exit ends the process pid, as if it had exited of its own accord
+func (h *Memory) Exit(pid int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.exit(pid)
+}
+
+// SetAvailable makes h unavailable, with IsAvailable returning err, or
+// available again if err is nil
+func (h *Memory) SetAvailable(err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.failed = err
+}
+
+func (h *Memory) String() string {
+	return h.name
+}
+
+func (h *Memory) GetFs() afero.Fs {
+	return h.fs
+}
+
+func (h *Memory) HostPath(p string) string {
+	return fmt.Sprintf("%s:%s", h, p)
+}
+
+func (h *Memory) Hostname() string {
+	return h.hostname
+}
+
+func (h *Memory) ServerVersion() string {
+	return "memory-" + h.goos
+}
+
+// IsAvailable returns true unless made unavailable with SetAvailable
+func (h *Memory) IsAvailable() (bool, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.failed == nil, h.failed
+}
+
+// IsLocal returns false, as a Memory host behaves like a remote host
+func (h *Memory) IsLocal() bool {
+	return false
+}
+
+func (h *Memory) LastError() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.failed
+}
+
+func (h *Memory) Uname() (os, arch string, err error) {
+	return h.goos, h.goarch, nil
+}
+
+func (h *Memory) Username() string {
+	return h.username
+}
+
+// abs returns the cleaned absolute path of name
+func (h *Memory) abs(name string) string {
+	if !path.IsAbs(name) {
+		name = path.Join(h.cwd, name)
+	}
+	return path.Clean(name)
+}
+
+// resolve returns the absolute path of name with all symbolic links in
+// the directory part, and in the final element if follow is true,
+// replaced by their targets. Paths that do not exist are returned
+// resolved as far as possible.
+func (h *Memory) resolve(name string, follow bool) (string, error) {
+	name = h.abs(name)
+	for links := 0; links < 40; links++ {
+		parts := strings.Split(strings.TrimPrefix(name, "/"), "/")
+		resolved := "/"
+		restart := false
+		for i, part := range parts {
+			if part == "" {
+				continue
+			}
+			p := path.Join(resolved, part)
+			if i == len(parts)-1 && !follow {
+				resolved = p
+				break
+			}
+			target, ok := h.readlink(p)
+			if !ok {
+				resolved = p
+				continue
+			}
+			if !path.IsAbs(target) {
+				target = path.Join(resolved, target)
+			}
+			name = path.Join(append([]string{target}, parts[i+1:]...)...)
+			restart = true
+			break
+		}
+		if !restart {
+			return resolved, nil
+		}
+	}
+	return "", &fs.PathError{Op: "resolve", Path: name, Err: syscall.ELOOP}
+}
+
+// readlink returns the target of the symbolic link at the resolved
+// path p
+func (h *Memory) readlink(p string) (target string, ok bool) {
+	st, err := h.fs.Stat(p)
+	if err != nil || st.Mode()&fs.ModeSymlink == 0 {
+		return
+	}
+	b, err := afero.ReadFile(h.fs, p)
+	if err != nil {
+		return
+	}
+	return string(b), true
+}
+
+// checkParent returns an error if the parent directory of the resolved
+// path p does not exist
+func (h *Memory) checkParent(op, p string) error {
+	st, err := h.fs.Stat(path.Dir(p))
+	if err != nil {
+		return &fs.PathError{Op: op, Path: p, Err: fs.ErrNotExist}
+	}
+	if !st.IsDir() {
+		return &fs.PathError{Op: op, Path: p, Err: syscall.ENOTDIR}
+	}
+	return nil
+}
+
+// fileInfo wraps st so that Sys returns an *sftp.FileStat with the
+// owner of p, as for remote hosts
+func (h *Memory) fileInfo(p string, st fs.FileInfo) fs.FileInfo {
+	h.mutex.Lock()
+	owner, ok := h.owners[p]
+	h.mutex.Unlock()
+	if !ok {
+		owner = [2]int{h.uid, h.gid}
+	}
+	return &memoryFileInfo{
+		FileInfo: st,
+		stat: &sftp.FileStat{
+			Size:  uint64(st.Size()),
+			Mode:  uint32(st.Mode().Perm()),
+			Mtime: uint32(st.ModTime().Unix()),
+			UID:   uint32(owner[0]),
+			GID:   uint32(owner[1]),
+		},
+	}
+}
+
+type memoryFileInfo struct {
+	fs.FileInfo
+	stat *sftp.FileStat
+}
+
+func (m *memoryFileInfo) Sys() any {
+	return m.stat
+}
+
+func (h *Memory) Abs(name string) (string, error) {
+	return h.abs(name), nil
+}
+
+func (h *Memory) Getwd() (dir string, err error) {
+	return h.cwd, nil
+}
+
+func (h *Memory) Chown(name string, uid, gid int) (err error) {
+	p, err := h.resolve(name, true)
+	if err != nil {
+		return
+	}
+	return h.chown(p, uid, gid)
+}
+
+func (h *Memory) Lchown(name string, uid, gid int) (err error) {
+	p, err := h.resolve(name, false)
+	if err != nil {
+		return
+	}
+	return h.chown(p, uid, gid)
+}
+
+func (h *Memory) chown(p string, uid, gid int) (err error) {
+	if _, err = h.fs.Stat(p); err != nil {
+		return
+	}
+	h.mutex.Lock()
+	h.owners[p] = [2]int{uid, gid}
+	h.mutex.Unlock()
+	return
+}
+
+func (h *Memory) Chtimes(name string, atime time.Time, mtime time.Time) (err error) {
+	p, err := h.resolve(name, true)
+	if err != nil {
+		return
+	}
+	return h.fs.Chtimes(p, atime, mtime)
+}
+
+func (h *Memory) Lchtimes(name string, atime time.Time, mtime time.Time) (err error) {
+	p, err := h.resolve(name, false)
+	if err != nil {
+		return
+	}
+	return h.fs.Chtimes(p, atime, mtime)
+}
+
+// Glob returns the paths matching pattern, as for [path.Match]
+func (h *Memory) Glob(pattern string) (paths []string, err error) {
+	if _, err = path.Match(pattern, ""); err != nil {
+		return
+	}
+	pattern = h.abs(pattern)
+	if !strings.ContainsAny(pattern, `*?[\`) {
+		if _, err = h.Lstat(pattern); err != nil {
+			return nil, nil
+		}
+		return []string{pattern}, nil
+	}
+
+	dir, file := path.Split(pattern)
+	dir = path.Clean(dir)
+	dirs := []string{dir}
+	if strings.ContainsAny(dir, `*?[\`) {
+		if dirs, err = h.Glob(dir); err != nil {
+			return
+		}
+	}
+	for _, d := range dirs {
+		entries, err := h.ReadDir(d)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if ok, _ := path.Match(file, e.Name()); ok {
+				paths = append(paths, path.Join(d, e.Name()))
+			}
+		}
+	}
+	return paths, nil
+}
+
+func (h *Memory) Lstat(name string) (f fs.FileInfo, err error) {
+	p, err := h.resolve(name, false)
+	if err != nil {
+		return
+	}
+	st, err := h.fs.Stat(p)
+	if err != nil {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: fs.ErrNotExist}
+	}
+	return h.fileInfo(p, st), nil
+}
+
+func (h *Memory) Stat(name string) (f fs.FileInfo, err error) {
+	p, err := h.resolve(name, true)
+	if err != nil {
+		return
+	}
+	st, err := h.fs.Stat(p)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return h.fileInfo(p, st), nil
+}
+
+func (h *Memory) MkdirAll(name string, perm os.FileMode) (err error) {
+	p, err := h.resolve(name, true)
+	if err != nil {
+		return
+	}
+	if st, err := h.fs.Stat(p); err == nil && !st.IsDir() {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+	}
+	return h.fs.MkdirAll(p, perm)
+}
+
+// ReadDir reads the named directory and returns all its directory
+// entries sorted by name.
+func (h *Memory) ReadDir(name string) (dirs []os.DirEntry, err error) {
+	p, err := h.resolve(name, true)
+	if err != nil {
+		return
+	}
+	infos, err := afero.ReadDir(h.fs, p)
+	if err != nil {
+		return
+	}
+	for _, st := range infos {
+		dirs = append(dirs, fs.FileInfoToDirEntry(h.fileInfo(path.Join(p, st.Name()), st)))
+	}
+	return
+}
+
+func (h *Memory) ReadFile(name string) (b []byte, err error) {
+	p, err := h.resolve(name, true)
+	if err != nil {
+		return
+	}
+	if st, err := h.fs.Stat(p); err == nil && st.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: syscall.EISDIR}
+	}
+	return afero.ReadFile(h.fs, p)
+}
+
+func (h *Memory) Readlink(name string) (link string, err error) {
+	p, err := h.resolve(name, false)
+	if err != nil {
+		return
+	}
+	link, ok := h.readlink(p)
+	if !ok {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return
+}
+
+// Remove removes the file or empty directory name
+func (h *Memory) Remove(name string) (err error) {
+	p, err := h.resolve(name, false)
+	if err != nil {
+		return
+	}
+	st, err := h.fs.Stat(p)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if st.IsDir() {
+		if entries, _ := afero.ReadDir(h.fs, p); len(entries) > 0 {
+			return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+	}
+	return h.fs.Remove(p)
+}
+
+func (h *Memory) RemoveAll(name string) (err error) {
+	p, err := h.resolve(name, false)
+	if err != nil {
+		return
+	}
+	return h.fs.RemoveAll(p)
+}
+
+func (h *Memory) Rename(oldpath, newpath string) (err error) {
+	o, err := h.resolve(oldpath, false)
+	if err != nil {
+		return
+	}
+	n, err := h.resolve(newpath, false)
+	if err != nil {
+		return
+	}
+	if err = h.checkParent("rename", n); err != nil {
+		return
+	}
+	return h.fs.Rename(o, n)
+}
+
+// Symlink creates newname as a symbolic link to oldname, which is
+// stored as given and is not required to exist
+func (h *Memory) Symlink(oldname, newname string) (err error) {
+	p, err := h.resolve(newname, false)
+	if err != nil {
+		return
+	}
+	if err = h.checkParent("symlink", p); err != nil {
+		return
+	}
+	if _, err = h.fs.Stat(p); err == nil {
+		return &fs.PathError{Op: "symlink", Path: newname, Err: fs.ErrExist}
+	}
+	f, err := h.fs.Create(p)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	if _, err = f.WriteString(oldname); err != nil {
+		return
+	}
+	if m, ok := f.(*mem.File); ok {
+		mem.SetMode(m.Data(), fs.ModeSymlink|0777)
+	}
+	return
+}
+
+func (h *Memory) TempDir() string {
+	return "/tmp"
+}
+
+func (h *Memory) Truncate(name string, size int64) (err error) {
+	p, err := h.resolve(name, true)
+	if err != nil {
+		return
+	}
+	f, err := h.fs.OpenFile(p, os.O_WRONLY, 0)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	return f.Truncate(size)
+}
+
+func (h *Memory) WriteFile(name string, data []byte, perm os.FileMode) (err error) {
+	p, err := h.resolve(name, true)
+	if err != nil {
+		return
+	}
+	if err = h.checkParent("open", p); err != nil {
+		return
+	}
+	return afero.WriteFile(h.fs, p, data, perm)
+}
+
+func (h *Memory) Open(name string) (f io.ReadSeekCloser, err error) {
+	p, err := h.resolve(name, true)
+	if err != nil {
+		return
+	}
+	return h.fs.Open(p)
+}
+
+func (h *Memory) Create(name string, perms fs.FileMode) (out io.WriteCloser, err error) {
+	p, err := h.resolve(name, true)
+	if err != nil {
+		return
+	}
+	if err = h.checkParent("open", p); err != nil {
+		return
+	}
+	f, err := h.fs.OpenFile(p, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perms)
+	if err != nil {
+		return
+	}
+	if err = h.fs.Chmod(p, perms); err != nil {
+		f.Close()
+		return
+	}
+	return f, nil
+}
+
+// command returns the scripted result for cmd
+func (h *Memory) command(cmd *exec.Cmd) MemoryResult {
+	h.mutex.Lock()
+	fn, ok := h.commands[cmd.Path]
+	if !ok {
+		fn, ok = h.commands[path.Base(cmd.Path)]
+	}
+	if !ok {
+		fn, ok = h.commands[""]
+	}
+	h.mutex.Unlock()
+	if !ok {
+		return MemoryResult{}
+	}
+	return fn(h, cmd)
+}
+
+// writeErrfile writes data to errfile, relative to dir, appending if
+// append is true
+func (h *Memory) writeErrfile(errfile, dir string, data []byte, append bool) (err error) {
+	if errfile == "" {
+		return
+	}
+	if !path.IsAbs(errfile) {
+		errfile = path.Join(dir, errfile)
+	}
+	p, err := h.resolve(errfile, true)
+	if err != nil {
+		return
+	}
+	if err = h.checkParent("open", p); err != nil {
+		return
+	}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if append {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	f, err := h.fs.OpenFile(p, flags, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_, err = f.Write(data)
+	return
+}
+
+// Start starts a fake process for cmd, using the scripted result. The
+// scripted stdout and stderr are appended to errfile, if given. Unless
+// the result has a non-zero exit code the process then appears under
+// `/proc` until signalled to terminate or Exit is called.
+func (h *Memory) Start(cmd *exec.Cmd, errfile string) (err error) {
+	result := h.command(cmd)
+	if result.Err != nil {
+		return result.Err
+	}
+	if err = h.writeErrfile(errfile, cmd.Dir, append(result.Stdout, result.Stderr...), true); err != nil {
+		return
+	}
+	if result.ExitCode != 0 {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	pid := h.nextPID
+	h.nextPID++
+	p := &MemoryProcess{
+		PID:     pid,
+		Path:    cmd.Path,
+		Args:    slices.Clone(cmd.Args),
+		Env:     slices.Clone(cmd.Env),
+		Dir:     cmd.Dir,
+		Started: time.Now(),
+		ignore:  result.Ignore,
+	}
+	h.processes[pid] = p
+
+	procdir := fmt.Sprintf("/proc/%d", pid)
+	h.fs.MkdirAll(path.Join(procdir, "fd"), 0555)
+	h.fs.Chtimes(procdir, p.Started, p.Started)
+
+	var cmdline, environ bytes.Buffer
+	for _, a := range p.Args {
+		cmdline.WriteString(a)
+		cmdline.WriteByte(0)
+	}
+	for _, e := range p.Env {
+		environ.WriteString(e)
+		environ.WriteByte(0)
+	}
+	comm := path.Base(cmd.Path)
+	if len(comm) > 15 {
+		comm = comm[:15]
+	}
+	stat := fmt.Sprintf("%d (%s) S 1 %d %d%s\n", pid, comm, pid, pid, strings.Repeat(" 0", 48))
+	status := fmt.Sprintf("Name:\t%s\nState:\tS (sleeping)\nPid:\t%d\nPPid:\t1\nUid:\t%d\t%d\t%d\t%d\nGid:\t%d\t%d\t%d\t%d\nVmRSS:\t0 kB\n",
+		comm, pid, h.uid, h.uid, h.uid, h.uid, h.gid, h.gid, h.gid, h.gid)
+
+	afero.WriteFile(h.fs, path.Join(procdir, "cmdline"), cmdline.Bytes(), 0444)
+	afero.WriteFile(h.fs, path.Join(procdir, "environ"), environ.Bytes(), 0400)
+	afero.WriteFile(h.fs, path.Join(procdir, "stat"), []byte(stat), 0444)
+	afero.WriteFile(h.fs, path.Join(procdir, "status"), []byte(status), 0444)
+	for link, target := range map[string]string{"exe": cmd.Path, "cwd": cmd.Dir} {
+		if f, err := h.fs.Create(path.Join(procdir, link)); err == nil {
+			f.WriteString(target)
+			mem.SetMode(f.(*mem.File).Data(), fs.ModeSymlink|0777)
+			f.Close()
+		}
+	}
+	return
+}
+
+// Run returns the scripted stdout for cmd, writing the scripted stderr
+// to errfile if given. A non-zero exit code is returned as a
+// *MemoryExitError.
+func (h *Memory) Run(cmd *exec.Cmd, errfile string) (output []byte, err error) {
+	result := h.command(cmd)
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	if err = h.writeErrfile(errfile, cmd.Dir, result.Stderr, false); err != nil {
+		return
+	}
+	if result.ExitCode != 0 {
+		return result.Stdout, &MemoryExitError{Code: result.ExitCode}
+	}
+	return result.Stdout, nil
+}
+
+// Signal records signal against the process pid. SIGTERM, SIGINT,
+// SIGQUIT and SIGKILL terminate the process unless ignored in the
+// scripted result, other signals are only recorded. A signal of 0
+// checks if the process exists.
+func (h *Memory) Signal(pid int, signal syscall.Signal) (err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	p, ok := h.processes[pid]
+	if !ok {
+		return os.ErrProcessDone
+	}
+	if signal == 0 {
+		return
+	}
+	p.Signals = append(p.Signals, signal)
+	switch signal {
+	case syscall.SIGKILL:
+		h.exit(pid)
+	case syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT:
+		if !slices.Contains(p.ignore, signal) {
+			h.exit(pid)
+		}
+	}
+	return
+}
+
+// exit removes process pid. The caller must hold the mutex.
+func (h *Memory) exit(pid int) {
+	delete(h.processes, pid)
+	h.fs.RemoveAll(fmt.Sprintf("/proc/%d", pid))
+}
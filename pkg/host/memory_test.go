@@ -0,0 +1,118 @@
+package host
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/sftp"
+)
+
+func TestMemoryFiles(t *testing.T) {
+	h := NewMemory("test")
+
+	if err := h.WriteFile("/opt/geneos/file.txt", []byte("data"), 0644); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("WriteFile without parent directory returned %v", err)
+	}
+	if err := h.MkdirAll("/opt/geneos/packages/gateway/7.0.0", 0775); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.WriteFile("/opt/geneos/packages/gateway/7.0.0/gateway2.linux_64", []byte("binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Symlink("7.0.0", "/opt/geneos/packages/gateway/active_prod"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Symlink("7.0.0", "/opt/geneos/packages/gateway/active_prod"); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Symlink over existing link returned %v", err)
+	}
+
+	if link, err := h.Readlink("/opt/geneos/packages/gateway/active_prod"); err != nil || link != "7.0.0" {
+		t.Errorf("Readlink returned %q, %v", link, err)
+	}
+	if st, err := h.Lstat("/opt/geneos/packages/gateway/active_prod"); err != nil || st.Mode()&fs.ModeSymlink == 0 {
+		t.Errorf("Lstat returned %v, %v", st, err)
+	}
+	if st, err := h.Stat("/opt/geneos/packages/gateway/active_prod"); err != nil || !st.IsDir() {
+		t.Errorf("Stat through link returned %v, %v", st, err)
+	}
+	if b, err := h.ReadFile("/opt/geneos/packages/gateway/active_prod/gateway2.linux_64"); err != nil || string(b) != "binary" {
+		t.Errorf("ReadFile through link returned %q, %v", b, err)
+	}
+
+	paths, err := h.Glob("/opt/geneos/packages/*/active_*")
+	if err != nil || len(paths) != 1 || paths[0] != "/opt/geneos/packages/gateway/active_prod" {
+		t.Errorf("Glob returned %v, %v", paths, err)
+	}
+
+	if err := h.Remove("/opt/geneos/packages/gateway"); err == nil {
+		t.Error("Remove of non-empty directory succeeded")
+	}
+	if err := h.Remove("/opt/geneos/packages/gateway/active_prod"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Stat("/opt/geneos/packages/gateway/7.0.0/gateway2.linux_64"); err != nil {
+		t.Errorf("Remove of link removed target: %v", err)
+	}
+
+	if err := h.Chown("/opt/geneos/packages", 1234, 5678); err != nil {
+		t.Fatal(err)
+	}
+	if st, _ := h.Stat("/opt/geneos/packages"); st.Sys().(*sftp.FileStat).UID != 1234 {
+		t.Errorf("Stat returned owner %d, want 1234", st.Sys().(*sftp.FileStat).UID)
+	}
+}
+
+func TestMemoryProcesses(t *testing.T) {
+	h := NewMemory("test", OnCommand("gateway2.linux_64", func(h *Memory, cmd *exec.Cmd) MemoryResult {
+		return MemoryResult{Stderr: []byte("starting\n"), Ignore: []syscall.Signal{syscall.SIGTERM}}
+	}), OnCommand("false", func(h *Memory, cmd *exec.Cmd) MemoryResult {
+		return MemoryResult{Stdout: []byte("out"), ExitCode: 1}
+	}))
+
+	cmd := &exec.Cmd{
+		Path: "/opt/geneos/packages/gateway/active_prod/gateway2.linux_64",
+		Args: []string{"/opt/geneos/packages/gateway/active_prod/gateway2.linux_64", "test", "-port", "7039"},
+		Env:  []string{"LD_LIBRARY_PATH=/opt/geneos/lib"},
+		Dir:  "/home/geneos",
+	}
+	if err := h.Start(cmd, "gateway.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := h.ReadFile("/home/geneos/gateway.txt"); string(b) != "starting\n" {
+		t.Errorf("errfile contains %q", b)
+	}
+
+	procs := h.Processes()
+	if len(procs) != 1 {
+		t.Fatalf("%d processes running, want 1", len(procs))
+	}
+	pid := procs[0].PID
+	dirs, _ := h.Glob("/proc/[0-9]*")
+	if len(dirs) != 1 {
+		t.Errorf("/proc has %v", dirs)
+	}
+	if exe, err := h.Readlink(fmt.Sprintf("/proc/%d/exe", pid)); err != nil || exe != cmd.Path {
+		t.Errorf("/proc/PID/exe is %q, %v", exe, err)
+	}
+
+	if err := h.Signal(pid, syscall.SIGTERM); err != nil || len(h.Processes()) != 1 {
+		t.Errorf("ignored SIGTERM: %v, %d processes", err, len(h.Processes()))
+	}
+	if err := h.Signal(pid, syscall.SIGKILL); err != nil || len(h.Processes()) != 0 {
+		t.Errorf("SIGKILL: %v, %d processes", err, len(h.Processes()))
+	}
+	if err := h.Signal(pid, 0); err != os.ErrProcessDone {
+		t.Errorf("Signal after exit returned %v", err)
+	}
+
+	out, err := h.Run(&exec.Cmd{Path: "/bin/false"}, "")
+	var exitErr *MemoryExitError
+	if string(out) != "out" || !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Errorf("Run returned %q, %v", out, err)
+	}
+}
@@ -23,10 +23,13 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"net"
+	"net/url"
 	"os"
 	"os/exec"
 	"os/user"
 	"path"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -47,18 +50,21 @@ const userSSHdir = ".ssh"
 
 var sshSessions sync.Map
 var sftpSessions sync.Map
+var sshJumpSessions sync.Map
 
 // An SSHRemote a type that satisfies the Host interface for SSH
 // attached remote hosts
 type SSHRemote struct {
-	name        string
-	username    string
-	hostname    string
-	port        uint16
-	password    *memguard.Enclave // cannot use config.Plaintext because of import loop
-	keys        []string
-	failed      error
-	lastAttempt time.Time
+	name         string
+	username     string
+	hostname     string
+	port         uint16
+	password     *memguard.Enclave // cannot use config.Plaintext because of import loop
+	keys         []string
+	jumps        []*SSHRemote
+	proxyCommand string
+	failed       error
+	lastAttempt  time.Time
 }
 
 func NewSSHRemote(name string, options ...any) Host {
@@ -121,6 +127,35 @@ func PrivateKeyFiles(paths ...string) SSHOptions {
 	}
 }
 
+// JumpHost adds a jump host, configured by options, that connections
+// are made through, in the same way as the OpenSSH ProxyJump option.
+// Repeat for each jump host in the order they should be connected.
+// Each jump host has its own username, password and private key files
+// and defaults to port 22 and the local username.
+func JumpHost(options ...SSHOptions) SSHOptions {
+	return func(s *SSHRemote) {
+		j := &SSHRemote{}
+		evalOptions(j)
+		for _, opt := range options {
+			opt(j)
+		}
+		j.name = j.hostname
+		s.jumps = append(s.jumps, j)
+	}
+}
+
+// ProxyCommand sets a command to run to connect to the remote host, or
+// to the first jump host, in the same way as the OpenSSH ProxyCommand
+// option. The command is run using the shell and must connect its
+// standard input and output to the SSH server. The tokens `%h`, `%p`,
+// `%r` and `%n` are replaced by the hostname, port, username and the
+// original hostname before any `~/.ssh/config` HostName is applied.
+func ProxyCommand(command string) SSHOptions {
+	return func(s *SSHRemote) {
+		s.proxyCommand = command
+	}
+}
+
 func (h *SSHRemote) Username() string {
 	return h.username
 }
@@ -161,14 +196,21 @@ func readSSHkeys(passphrase *memguard.Enclave, homedir string, files ...string)
 }
 
 // sshConnect does the work of connecting to the given remote by
-// assembling the authentication methods and dialling. dest is in the
-// format of `HOST|IP[:PORT]` where PORT defaults to 22. username is the
-// remote login to use and if empty defaults to the local username as
-// found by [user.Current]
-func sshConnect(dest, username string, password *memguard.Enclave, keyfiles ...string) (client *ssh.Client, err error) {
+// assembling the authentication methods and starting an SSH client
+// connection over conn, which is closed on failure. dest is in the
+// format of `HOST|IP[:PORT]` and is used to check the host key.
+// username is the remote login to use and if empty defaults to the
+// local username as found by [user.Current]
+func sshConnect(conn net.Conn, dest, username string, password *memguard.Enclave, keyfiles ...string) (client *ssh.Client, err error) {
 	var authmethods []ssh.AuthMethod
 	var homedir string
 
+	defer func() {
+		if err != nil {
+			conn.Close()
+		}
+	}()
+
 	var u *user.User
 	u, err = user.Current()
 	if err != nil {
@@ -217,13 +259,213 @@ func sshConnect(dest, username string, password *memguard.Enclave, keyfiles ...s
 		HostKeyAlgorithms: kh.HostKeyAlgorithms(dest),
 		Timeout:           5 * time.Second,
 	}
-	client, err = ssh.Dial("tcp", dest, config)
-	if err != nil && knownhosts.IsHostKeyChanged(err) {
-		log.Fatal().Msgf("host key has changed for %s", dest)
+
+	c, chans, reqs, err := sshHandshake(conn, dest, config)
+	if err != nil {
+		if knownhosts.IsHostKeyChanged(err) {
+			log.Fatal().Msgf("host key has changed for %s", dest)
+		}
+		return
+	}
+	client = ssh.NewClient(c, chans, reqs)
+	return
+}
+
+// sshHandshake runs ssh.NewClientConn, which has no timeout of its
+// own, over conn and closes conn if it does not complete within
+// config.Timeout. A timer is used instead of a deadline as neither
+// proxy command connections nor channels through jump hosts support
+// deadlines.
+func sshHandshake(conn net.Conn, dest string, config *ssh.ClientConfig) (c ssh.Conn, chans <-chan ssh.NewChannel, reqs <-chan *ssh.Request, err error) {
+	timer := time.AfterFunc(config.Timeout, func() { conn.Close() })
+	c, chans, reqs, err = ssh.NewClientConn(conn, dest, config)
+	if !timer.Stop() {
+		// the timer fired, so conn is closed even if the handshake
+		// completed at the same time
+		if err == nil {
+			c.Close()
+		}
+		return nil, nil, nil, fmt.Errorf("ssh handshake with %s: %w", dest, os.ErrDeadlineExceeded)
+	}
+	return
+}
+
+// resolve returns a copy of h with any settings from the user's
+// `~/.ssh/config` for the hostname applied. The HostName and
+// IdentityFile settings are always used, while User and Port are only
+// used if h has the default local username or port 22. ProxyJump and
+// ProxyCommand are only used if h has no jump hosts or proxy command of
+// its own. The alias, the original hostname, is also returned.
+func (h *SSHRemote) resolve(homedir, localuser string, jumps bool) (r *SSHRemote, alias string) {
+	r = &SSHRemote{}
+	*r = *h
+	alias = h.hostname
+	if r.port == 0 {
+		r.port = 22
+	}
+
+	cf := readSSHConfig(homedir, alias)
+	if cf.hostname != "" {
+		r.hostname = expandSSHTokens(cf.hostname, alias, alias, "", "")
+	}
+	if cf.user != "" && (r.username == "" || r.username == localuser) {
+		r.username = cf.user
+	}
+	if cf.port != "" && r.port == 22 {
+		if p, err := strconv.ParseUint(cf.port, 10, 16); err == nil {
+			r.port = uint16(p)
+		}
+	}
+	r.keys = append(slices.Clone(r.keys), cf.identityFiles...)
+
+	if !jumps || len(r.jumps) > 0 || r.proxyCommand != "" {
+		return
+	}
+	if cf.proxyCommand != "" && cf.proxyCommand != "none" {
+		r.proxyCommand = cf.proxyCommand
+	}
+	if cf.proxyJump != "" && cf.proxyJump != "none" && r.proxyCommand == "" {
+		for _, j := range strings.Split(cf.proxyJump, ",") {
+			jump := &SSHRemote{username: localuser}
+			if u, err := url.Parse("ssh://" + strings.TrimPrefix(j, "ssh://")); err == nil {
+				jump.hostname = u.Hostname()
+				if u.User.Username() != "" {
+					jump.username = u.User.Username()
+				}
+				if p, err := strconv.ParseUint(u.Port(), 10, 16); err == nil {
+					jump.port = uint16(p)
+				}
+			}
+			jump.name = jump.hostname
+			r.jumps = append(r.jumps, jump)
+		}
+	}
+	return
+}
+
+// connect dials h through any jump hosts and proxy command and returns
+// the client for h and the clients for the jump hosts, which must be
+// closed after the client for h
+func (h *SSHRemote) connect() (client *ssh.Client, jumpClients []*ssh.Client, err error) {
+	var homedir, localuser string
+	if u, err := user.Current(); err == nil {
+		homedir, localuser = u.HomeDir, u.Username
+	}
+	if d, err := os.UserHomeDir(); err == nil {
+		homedir = d
+	}
+
+	target, alias := h.resolve(homedir, localuser, true)
+	hops := []*SSHRemote{}
+	aliases := []string{}
+	for _, j := range target.jumps {
+		r, a := j.resolve(homedir, localuser, false)
+		hops = append(hops, r)
+		aliases = append(aliases, a)
+	}
+	hops = append(hops, target)
+	aliases = append(aliases, alias)
+
+	defer func() {
+		if err != nil {
+			for i := len(jumpClients) - 1; i >= 0; i-- {
+				jumpClients[i].Close()
+			}
+			jumpClients = nil
+		}
+	}()
+
+	for i, hop := range hops {
+		if hop.hostname == "" {
+			return nil, jumpClients, fmt.Errorf("%w hostname not set for jump host %d of %s", ErrInvalidArgs, i+1, h)
+		}
+		port := strconv.Itoa(int(hop.port))
+		dest := net.JoinHostPort(hop.hostname, port)
+
+		var conn net.Conn
+		switch {
+		case i > 0:
+			conn, err = jumpClients[i-1].Dial("tcp", dest)
+		case target.proxyCommand != "":
+			conn, err = dialProxyCommand(expandSSHTokens(target.proxyCommand, aliases[i], hop.hostname, port, hop.username), dest)
+		default:
+			conn, err = net.DialTimeout("tcp", dest, 5*time.Second)
+		}
+		if err != nil {
+			if i < len(hops)-1 {
+				err = fmt.Errorf("jump host %s: %w", dest, err)
+			}
+			return
+		}
+
+		var c *ssh.Client
+		if c, err = sshConnect(conn, dest, hop.username, hop.password, hop.keys...); err != nil {
+			if i < len(hops)-1 {
+				err = fmt.Errorf("jump host %s: %w", dest, err)
+			}
+			return
+		}
+		if i == len(hops)-1 {
+			client = c
+		} else {
+			jumpClients = append(jumpClients, c)
+		}
 	}
 	return
 }
 
+// proxyConn is a net.Conn using the standard input and output of a
+// ProxyCommand
+type proxyConn struct {
+	cmd  *exec.Cmd
+	dest proxyAddr
+	io.Reader
+	io.WriteCloser
+}
+
+var _ net.Conn = (*proxyConn)(nil)
+
+// dialProxyCommand starts command and returns a net.Conn connected to
+// its standard input and output. dest is used as the remote address of
+// the connection for host key checking.
+func dialProxyCommand(command, dest string) (conn net.Conn, err error) {
+	cmd := proxyCommand(command)
+	cmd.Stderr = os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("proxy command %q: %w", command, err)
+	}
+	return &proxyConn{cmd: cmd, dest: proxyAddr(dest), Reader: out, WriteCloser: in}, nil
+}
+
+func (p *proxyConn) Close() error {
+	p.WriteCloser.Close()
+	if p.cmd.Process != nil {
+		p.cmd.Process.Kill()
+	}
+	p.cmd.Wait()
+	return nil
+}
+
+func (p *proxyConn) LocalAddr() net.Addr                { return proxyAddr("localhost:0") }
+func (p *proxyConn) RemoteAddr() net.Addr               { return p.dest }
+func (p *proxyConn) SetDeadline(t time.Time) error      { return nil }
+func (p *proxyConn) SetReadDeadline(t time.Time) error  { return nil }
+func (p *proxyConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// proxyAddr is the `HOST:PORT` address of a ProxyCommand connection
+type proxyAddr string
+
+func (a proxyAddr) Network() string { return "tcp" }
+func (a proxyAddr) String() string  { return string(a) }
+
 // Dial connects to a remote host using ssh and returns an *ssh.Client
 // on success. Each connection is cached and returned if found without
 // checking if it is still valid. To remove a session call Close()
@@ -241,21 +483,21 @@ func (h *SSHRemote) Dial() (sc *ssh.Client, err error) {
 	if h.hostname == "" {
 		return nil, fmt.Errorf("%w hostname not set for remote %s", ErrInvalidArgs, h)
 	}
-	if h.port == 0 {
-		h.port = 22
-	}
 
-	dest := fmt.Sprintf("%s:%d", h.hostname, h.port)
 	if val, ok := sshSessions.Load(h.name); ok {
 		sc = val.(*ssh.Client)
 	} else {
-		sc, err = sshConnect(dest, h.username, h.password, h.keys...)
+		var jumpClients []*ssh.Client
+		sc, jumpClients, err = h.connect()
 		if err != nil {
 			h.failed = err
 			h.lastAttempt = time.Now()
 			return sc, fmt.Errorf("%w (note: you MUST add remote keys manually to known_hosts)", err)
 		}
 		sshSessions.Store(h.name, sc)
+		if len(jumpClients) > 0 {
+			sshJumpSessions.Store(h.name, jumpClients)
+		}
 	}
 	return
 }
@@ -274,6 +516,14 @@ func (h *SSHRemote) Close() {
 		s.Close()
 		sshSessions.Delete(h.name)
 	}
+
+	// close jump hosts in reverse order after the connection through them
+	if val, ok := sshJumpSessions.LoadAndDelete(h.name); ok {
+		jumpClients := val.([]*ssh.Client)
+		for i := len(jumpClients) - 1; i >= 0; i-- {
+			jumpClients[i].Close()
+		}
+	}
 }
 
 // DialSFTP connects to the remote host using SSH and returns an
@@ -575,6 +825,14 @@ func (h *SSHRemote) TempDir() string {
 	return "/tmp"
 }
 
+func (h *SSHRemote) Truncate(name string, size int64) error {
+	if s, err := h.DialSFTP(); err != nil {
+		return err
+	} else {
+		return s.Truncate(name, size)
+	}
+}
+
 func (h *SSHRemote) LastError() error {
 	// if the failure was a while back, try again (XXX crude)
 	if h.failed != nil && !h.lastAttempt.IsZero() && time.Since(h.lastAttempt) > 5*time.Second {
@@ -658,12 +916,13 @@ func (h *SSHRemote) Start(cmd *exec.Cmd, errfile string) (err error) {
 	// we have to convert cmd to a string ourselves as we have to quote any args
 	// with spaces (like "Demo Gateway")
 	//
-	// given this is sent to a shell, we can quote everything blindly ?
+	// given this is sent to a shell, single quote everything so that
+	// arguments like shell scripts are passed through unchanged
 	//
 	// note that cmd.Args already has the command as Args[0], so no Path required
 	var cmdstr = ""
 	for _, a := range cmd.Args {
-		cmdstr = fmt.Sprintf("%s %q", cmdstr, a)
+		cmdstr += " " + ShellQuote(a)
 	}
 	pipe, err := sess.StdinPipe()
 	if err != nil {
@@ -673,11 +932,13 @@ func (h *SSHRemote) Start(cmd *exec.Cmd, errfile string) (err error) {
 	if err = sess.Shell(); err != nil {
 		return
 	}
-	fmt.Fprintf(pipe, "cd %q\n", cmd.Dir)
+	fmt.Fprintf(pipe, "cd %s\n", ShellQuote(cmd.Dir))
+	// environment values are passed as-is, so that the remote shell
+	// expands references like `$PATH` and `~` as it always has
 	for _, e := range cmd.Env {
 		fmt.Fprintln(pipe, "export", e)
 	}
-	fmt.Fprintf(pipe, "%s >> %q 2>&1 &\n", cmdstr, errfile)
+	fmt.Fprintf(pipe, "%s >> %s 2>&1 &\n", cmdstr, ShellQuote(errfile))
 	fmt.Fprintln(pipe, "exit")
 	return sess.Wait()
 }
@@ -699,12 +960,13 @@ func (h *SSHRemote) Run(cmd *exec.Cmd, errfile string) (output []byte, err error
 	// we have to convert cmd to a string ourselves as we have to quote any args
 	// with spaces (like "Demo Gateway")
 	//
-	// given this is sent to a shell, we can quote everything blindly ?
+	// single quotes are used so that the remote shell does not expand
+	// anything in the args or the environment values
 	//
 	// note that cmd.Args hosts the command as Args[0], so no Path required
 	var cmdstr = ""
 	for _, a := range cmd.Args {
-		cmdstr = fmt.Sprintf("%s %q", cmdstr, a)
+		cmdstr += " " + ShellQuote(a)
 	}
 	// pipe, err := sess.StdinPipe()
 	// if err != nil {
@@ -725,9 +987,10 @@ func (h *SSHRemote) Run(cmd *exec.Cmd, errfile string) (output []byte, err error
 
 	envs := []string{}
 	for _, e := range cmd.Env {
-		envs = append(envs, strconv.Quote(e))
+		k, v, _ := strings.Cut(e, "=")
+		envs = append(envs, k+"="+ShellQuote(v))
 	}
-	cmdstr = fmt.Sprintf("cd %q && %s %s", cmd.Dir, strings.Join(cmd.Env, " "), cmdstr)
+	cmdstr = fmt.Sprintf("cd %s && %s %s", ShellQuote(cmd.Dir), strings.Join(envs, " "), cmdstr)
 
 	return sess.Output(cmdstr)
 }
@@ -759,3 +1022,9 @@ func (h *SSHRemote) Uname() (os, arch string, err error) {
 
 	return
 }
+
+// ShellQuote returns s single quoted for use in a POSIX shell command
+// line, such as those run on remote hosts
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
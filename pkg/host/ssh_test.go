@@ -0,0 +1,48 @@
+package host
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// noDeadlineConn is a net.Conn that ignores deadlines, like
+// proxyConn and channels through jump hosts
+type noDeadlineConn struct {
+	net.Conn
+}
+
+func (noDeadlineConn) SetDeadline(t time.Time) error      { return nil }
+func (noDeadlineConn) SetReadDeadline(t time.Time) error  { return nil }
+func (noDeadlineConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func TestSSHHandshakeTimeout(t *testing.T) {
+	// the server end never responds
+	client, server := net.Pipe()
+	defer server.Close()
+
+	config := &ssh.ClientConfig{
+		User:            "geneos",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         100 * time.Millisecond,
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, _, err := sshHandshake(noDeadlineConn{client}, "server1:22", config)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("sshHandshake returned %v, want a deadline exceeded error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("sshHandshake did not time out")
+	}
+}
@@ -22,6 +22,7 @@ package host
 import (
 	"net"
 	"os"
+	"os/exec"
 
 	"golang.org/x/crypto/ssh/agent"
 )
@@ -35,3 +36,8 @@ func sshConnectAgent() (agentClient agent.ExtendedAgent) {
 	}
 	return
 }
+
+// proxyCommand returns the command to run for an SSH ProxyCommand
+func proxyCommand(command string) *exec.Cmd {
+	return exec.Command("/bin/sh", "-c", command)
+}
@@ -20,6 +20,7 @@ package host
 import (
 	"github.com/Microsoft/go-winio"
 	"golang.org/x/crypto/ssh/agent"
+	"os/exec"
 )
 
 func sshConnectAgent() (agentClient agent.ExtendedAgent) {
@@ -31,3 +32,8 @@ func sshConnectAgent() (agentClient agent.ExtendedAgent) {
 	}
 	return
 }
+
+// proxyCommand returns the command to run for an SSH ProxyCommand
+func proxyCommand(command string) *exec.Cmd {
+	return exec.Command("cmd", "/c", command)
+}
@@ -0,0 +1,180 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package host
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// sshConfig holds the subset of the OpenSSH client configuration for a
+// host alias that is used when dialling
+type sshConfig struct {
+	hostname      string
+	user          string
+	port          string
+	identityFiles []string
+	proxyJump     string
+	proxyCommand  string
+}
+
+// readSSHConfig returns the settings from the user's `~/.ssh/config`
+// that apply to alias. As for OpenSSH, the first value found for each
+// keyword is used, except for IdentityFile where all values are
+// collected. `Host` patterns, including negation, and `Include` are
+// supported but `Match` blocks are ignored.
+func readSSHConfig(homedir, alias string) (cf sshConfig) {
+	seen := map[string]bool{}
+	parseSSHConfig(homedir, path.Join(homedir, userSSHdir, "config"), alias, seen, &cf, 0)
+
+	cf.identityFiles = expandSSHConfigPaths(homedir, cf.identityFiles)
+	return
+}
+
+// parseSSHConfig reads the file p, updating cf with the settings that
+// apply to alias. depth limits recursive includes.
+func parseSSHConfig(homedir, p, alias string, seen map[string]bool, cf *sshConfig, depth int) {
+	if depth > 8 {
+		return
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	active := true
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		keyword, value := splitSSHConfigLine(scanner.Text())
+		if keyword == "" {
+			continue
+		}
+
+		switch keyword {
+		case "host":
+			active = matchSSHHost(alias, value)
+			continue
+		case "match":
+			active = false
+			continue
+		}
+		if !active {
+			continue
+		}
+
+		switch keyword {
+		case "include":
+			for _, pattern := range strings.Fields(value) {
+				pattern = expandSSHConfigPaths(homedir, []string{pattern})[0]
+				if !path.IsAbs(filepath.ToSlash(pattern)) {
+					pattern = path.Join(homedir, userSSHdir, pattern)
+				}
+				files, _ := filepath.Glob(pattern)
+				for _, file := range files {
+					parseSSHConfig(homedir, file, alias, seen, cf, depth+1)
+				}
+			}
+		case "identityfile":
+			cf.identityFiles = append(cf.identityFiles, value)
+		default:
+			if seen[keyword] {
+				continue
+			}
+			seen[keyword] = true
+			switch keyword {
+			case "hostname":
+				cf.hostname = value
+			case "user":
+				cf.user = value
+			case "port":
+				cf.port = value
+			case "proxyjump":
+				cf.proxyJump = value
+			case "proxycommand":
+				cf.proxyCommand = value
+			}
+		}
+	}
+}
+
+// splitSSHConfigLine returns the lower-cased keyword and the value of
+// a configuration line, which may be separated by spaces or an `=`.
+// Comments and blank lines return an empty keyword.
+func splitSSHConfigLine(line string) (keyword, value string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+	i := strings.IndexAny(line, " \t=")
+	if i == -1 {
+		return strings.ToLower(line), ""
+	}
+	keyword = strings.ToLower(line[:i])
+	value = strings.TrimLeft(line[i:], " \t")
+	value = strings.TrimPrefix(value, "=")
+	value = strings.TrimSpace(value)
+	if len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+	return
+}
+
+// matchSSHHost returns true if alias matches the list of `Host`
+// patterns. A negated pattern that matches always returns false.
+func matchSSHHost(alias, patterns string) (match bool) {
+	for _, p := range strings.Fields(patterns) {
+		negate := strings.HasPrefix(p, "!")
+		p = strings.TrimPrefix(p, "!")
+		if ok, _ := path.Match(strings.ToLower(p), strings.ToLower(alias)); ok {
+			if negate {
+				return false
+			}
+			match = true
+		}
+	}
+	return
+}
+
+// expandSSHConfigPaths replaces a leading `~` and any `%d` tokens in
+// each path with the user's home directory
+func expandSSHConfigPaths(homedir string, paths []string) (out []string) {
+	for _, p := range paths {
+		p = strings.ReplaceAll(p, "%d", homedir)
+		if p == "~" || strings.HasPrefix(p, "~/") {
+			p = path.Join(homedir, p[1:])
+		}
+		out = append(out, p)
+	}
+	return
+}
+
+// expandSSHTokens replaces the `%h`, `%p`, `%r`, `%n` and `%%` tokens
+// in s, as used in ProxyCommand
+func expandSSHTokens(s, alias, hostname, port, username string) string {
+	return strings.NewReplacer(
+		"%%", "%",
+		"%h", hostname,
+		"%p", port,
+		"%r", username,
+		"%n", alias,
+	).Replace(s)
+}
@@ -0,0 +1,137 @@
+package host
+
+import (
+	"os"
+	"path"
+	"slices"
+	"testing"
+)
+
+func TestSplitSSHConfigLine(t *testing.T) {
+	tests := []struct {
+		line, keyword, value string
+	}{
+		{"", "", ""},
+		{"   ", "", ""},
+		{"# comment", "", ""},
+		{"  # indented comment", "", ""},
+		{"HostName example.com", "hostname", "example.com"},
+		{"\tPort\t2222  ", "port", "2222"},
+		{"User=geneos", "user", "geneos"},
+		{"User = geneos", "user", "geneos"},
+		{`IdentityFile "~/.ssh/my key"`, "identityfile", "~/.ssh/my key"},
+		{`ProxyCommand ssh -W %h:%p bastion`, "proxycommand", "ssh -W %h:%p bastion"},
+		{"Compression", "compression", ""},
+	}
+	for _, tt := range tests {
+		keyword, value := splitSSHConfigLine(tt.line)
+		if keyword != tt.keyword || value != tt.value {
+			t.Errorf("splitSSHConfigLine(%q) = %q, %q, want %q, %q", tt.line, keyword, value, tt.keyword, tt.value)
+		}
+	}
+}
+
+func TestMatchSSHHost(t *testing.T) {
+	tests := []struct {
+		alias, patterns string
+		want            bool
+	}{
+		{"server1", "server1", true},
+		{"SERVER1", "server1", true},
+		{"server1", "server2", false},
+		{"server1", "server?", true},
+		{"web.example.com", "*.example.com", true},
+		{"web.example.org", "*.example.com", false},
+		{"server1", "other server1", true},
+		{"server1", "* !server1", false},
+		{"server2", "* !server1", true},
+		{"server1", "!server1", false},
+		{"server2", "!server1", false},
+		{"server1", "", false},
+	}
+	for _, tt := range tests {
+		if got := matchSSHHost(tt.alias, tt.patterns); got != tt.want {
+			t.Errorf("matchSSHHost(%q, %q) = %v, want %v", tt.alias, tt.patterns, got, tt.want)
+		}
+	}
+}
+
+func TestReadSSHConfig(t *testing.T) {
+	homedir := t.TempDir()
+	sshdir := path.Join(homedir, userSSHdir)
+	if err := os.MkdirAll(path.Join(sshdir, "config.d"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(sshdir, "config"), []byte(`
+# included files are read where the Include appears
+Include config.d/*.conf
+
+Host server1 server2
+    HostName server1.example.com
+    User geneos
+    IdentityFile ~/.ssh/id_server1
+
+Match host server1
+    User ignored
+
+Host *.example.com !bad.example.com
+    Port 2222
+    ProxyJump bastion
+
+Host *
+    User default
+    Port 22
+    IdentityFile %d/.ssh/id_default
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(sshdir, "config.d", "included.conf"), []byte(`
+Host server2
+    HostName=included.example.com
+    ProxyCommand "nc %h %p"
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		alias string
+		want  sshConfig
+	}{
+		{"server1", sshConfig{
+			hostname:      "server1.example.com",
+			user:          "geneos",
+			port:          "22",
+			identityFiles: []string{path.Join(homedir, ".ssh/id_server1"), path.Join(homedir, ".ssh/id_default")},
+		}},
+		{"server2", sshConfig{
+			hostname:      "included.example.com",
+			user:          "geneos",
+			port:          "22",
+			proxyCommand:  "nc %h %p",
+			identityFiles: []string{path.Join(homedir, ".ssh/id_server1"), path.Join(homedir, ".ssh/id_default")},
+		}},
+		{"web.example.com", sshConfig{
+			user:          "default",
+			port:          "2222",
+			proxyJump:     "bastion",
+			identityFiles: []string{path.Join(homedir, ".ssh/id_default")},
+		}},
+		{"bad.example.com", sshConfig{
+			user:          "default",
+			port:          "22",
+			identityFiles: []string{path.Join(homedir, ".ssh/id_default")},
+		}},
+	}
+	for _, tt := range tests {
+		got := readSSHConfig(homedir, tt.alias)
+		if got.hostname != tt.want.hostname || got.user != tt.want.user || got.port != tt.want.port ||
+			got.proxyJump != tt.want.proxyJump || got.proxyCommand != tt.want.proxyCommand ||
+			!slices.Equal(got.identityFiles, tt.want.identityFiles) {
+			t.Errorf("readSSHConfig(%q) = %+v, want %+v", tt.alias, got, tt.want)
+		}
+	}
+
+	if got := readSSHConfig(t.TempDir(), "server1"); got.hostname != "" || len(got.identityFiles) > 0 {
+		t.Errorf("readSSHConfig with no config file = %+v", got)
+	}
+}
@@ -61,6 +61,7 @@ func init() {
 	addCmd.Flags().VarP(&addCmdExtras.Attributes, "attribute", "a", instance.AttributesOptionsText)
 	addCmd.Flags().VarP(&addCmdExtras.Types, "type", "t", instance.TypesOptionsText)
 	addCmd.Flags().VarP(&addCmdExtras.Variables, "variable", "v", instance.VarsOptionsText)
+	addCmd.Flags().VarP(&addCmdExtras.Labels, "label", "L", instance.LabelValuesOptionsText)
 
 	addCmd.Flags().SortFlags = false
 }
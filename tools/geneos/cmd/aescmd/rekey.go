@@ -0,0 +1,488 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aescmd
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/itrs-group/cordial"
+	"github.com/itrs-group/cordial/pkg/config"
+	"github.com/itrs-group/cordial/pkg/host"
+	"github.com/itrs-group/cordial/tools/geneos/cmd"
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+	"github.com/itrs-group/cordial/tools/geneos/internal/instance"
+)
+
+var rekeyCmdKeyfile, rekeyCmdPrevKeyfile, rekeyCmdBackupSuffix string
+var rekeyCmdUser, rekeyCmdDryRun bool
+
+func init() {
+	aesCmd.AddCommand(rekeyCmd)
+
+	rekeyCmd.Flags().StringVarP(&rekeyCmdPrevKeyfile, "prev", "p", "", "Previous key file used to decode existing values. `PATH|URL|-`\nDefaults to each instance's prevkeyfile and the previous\nuser key files")
+	rekeyCmd.Flags().StringVarP(&rekeyCmdKeyfile, "keyfile", "k", string(cmd.DefaultUserKeyfile), "New key file for user configuration and credentials `PATH`")
+	rekeyCmd.Flags().StringVarP(&rekeyCmdBackupSuffix, "backup", "b", "-prev", "Backup changed files with extension given")
+	rekeyCmd.Flags().BoolVar(&rekeyCmdUser, "user", false, "Include user configuration and credentials files when\nTYPE or NAME are given")
+	rekeyCmd.Flags().BoolVarP(&rekeyCmdDryRun, "dry-run", "n", false, "Report what would change without updating any files")
+
+	rekeyCmd.Flags().SortFlags = false
+}
+
+//go:embed _docs/rekey.md
+var rekeyCmdDescription string
+
+var rekeyCmd = &cobra.Command{
+	Use:   "rekey [flags] [TYPE] [NAME...]",
+	Short: "Re-encrypt stored secrets with a new key file",
+	Long:  rekeyCmdDescription,
+	Example: `
+geneos aes new --shared --update
+geneos aes rekey
+geneos aes rekey --dry-run gateway
+geneos aes rekey --prev ~/old-keyfile.aes --user netprobe
+`,
+	SilenceUsage: true,
+	Annotations: map[string]string{
+		cmd.CmdGlobal:        "true",
+		cmd.CmdRequireHome:   "true",
+		cmd.CmdWildcardNames: "true",
+	},
+	RunE: func(command *cobra.Command, args []string) (err error) {
+		ct, names := cmd.ParseTypeNames(command)
+		h := geneos.GetHost(cmd.Hostname)
+
+		var prev *config.KeyValues
+		if rekeyCmdPrevKeyfile != "" {
+			if prev, err = geneos.ReadKeyValues(rekeyCmdPrevKeyfile, "Paste previous AES key file contents, end with newline and CTRL+D:"); err != nil {
+				return
+			}
+		}
+
+		var files []*rekeyFile
+
+		// instances first, prepared in parallel. any error aborts the
+		// whole operation before anything is written
+		responses := instance.Do(h, ct, names, rekeyInstance, prev)
+		for _, k := range slices.Sorted(maps.Keys(responses)) {
+			r := responses[k]
+			if r.Err != nil {
+				return fmt.Errorf("%s: %w", r.Instance, r.Err)
+			}
+			if f, ok := r.Value.(*rekeyFile); ok {
+				files = append(files, f)
+			}
+		}
+
+		// no args means all instances and the user's own files
+		if len(args) == 0 || rekeyCmdUser {
+			userFiles, err := rekeyUserFiles(prev)
+			if err != nil {
+				return err
+			}
+			files = append(files, userFiles...)
+		}
+
+		var failed []string
+		for _, f := range files {
+			failed = append(failed, f.failed...)
+			if f.changed == 0 {
+				continue
+			}
+			if rekeyCmdDryRun {
+				fmt.Printf("%s: %d value(s) would be re-encrypted in %s\n", f.owner, f.changed, f.h.HostPath(f.path))
+			}
+		}
+
+		if !rekeyCmdDryRun {
+			if err = rekeyCommit(files, rekeyCmdBackupSuffix); err != nil {
+				return
+			}
+			for _, f := range files {
+				if f.changed > 0 {
+					fmt.Printf("%s: %d value(s) re-encrypted in %s, backup in %s\n", f.owner, f.changed, f.h.HostPath(f.path), f.path+rekeyCmdBackupSuffix)
+				}
+			}
+		}
+
+		for _, f := range failed {
+			fmt.Println(f)
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("%d value(s) could not be decoded and were not changed", len(failed))
+		}
+		return
+	},
+}
+
+// encodedValueRE matches both Geneos style `+encs+HEX` values and the
+// expandable `${enc:KEYFILE:+encs+HEX}` form. The optional groups are
+// the keyfile(s) and the closing brace of the expandable form.
+var encodedValueRE = regexp.MustCompile(`(\$\{enc:([^}]*?):)?\+encs\+([0-9A-Fa-f]+)(\})?`)
+
+// rekeyFile is a file that contains encoded values along with the new
+// contents after re-encrypting
+type rekeyFile struct {
+	h       host.Host
+	path    string
+	owner   string
+	mode    fs.FileMode
+	orig    []byte
+	data    []byte
+	changed int
+	failed  []string
+}
+
+// rekeyKey is a key that values may be encoded with, along with the
+// key file path used to refer to it in expandable values, if known
+type rekeyKey struct {
+	kv   *config.KeyValues
+	path string
+}
+
+// matches returns true if ref, a key file reference from an
+// expandable value, refers to k
+func (k rekeyKey) matches(ref string) bool {
+	return k.path != "" && path.Clean(config.ExpandHome(ref)) == path.Clean(config.ExpandHome(k.path))
+}
+
+// rekeyData returns a copy of data with every encoded value that
+// decodes with one of the prev keys re-encoded with next. In the
+// expandable form the keyfile reference is replaced with next.path and
+// is also used to choose which keys to try, if it refers to any of
+// them.
+//
+// A wrong key can decode a value by chance, so each value is decoded
+// with all the keys chosen. A value is only left alone, as already
+// re-keyed, if next alone decodes it and only re-encoded if exactly
+// one plaintext is found using the prev keys. Values that decode with
+// both next and a prev key, with more than one prev key to different
+// plaintexts, with any key to an empty plaintext or with no key at all
+// are left unchanged and returned in failed as `PATH:LINE` strings
+// using name.
+func rekeyData(data []byte, name string, prev []rekeyKey, next rekeyKey) (out []byte, changed int, failed []string) {
+	keyfile := next.path
+	if strings.HasSuffix(name, ".json") {
+		// keyfile paths are inside JSON strings
+		k, _ := json.Marshal(keyfile)
+		keyfile = string(k[1 : len(k)-1])
+	}
+	keys := append([]rekeyKey{next}, prev...)
+
+	last := 0
+	for _, m := range encodedValueRE.FindAllSubmatchIndex(data, -1) {
+		out = append(out, data[last:m[0]]...)
+		last = m[1]
+		ciphertext := data[m[6]:m[7]]
+		line := bytes.Count(data[:m[0]], []byte("\n")) + 1
+
+		plaintext, reason := rekeyValue(ciphertext, next.kv, rekeyCandidates(keys, data, m, name))
+		switch {
+		case reason != "":
+			failed = append(failed, fmt.Sprintf("%s:%d: %s", name, line, reason))
+			out = append(out, data[m[0]:m[1]]...)
+			continue
+		case plaintext == nil:
+			// already encoded with next
+			out = append(out, data[m[0]:m[1]]...)
+			continue
+		}
+
+		e, err := next.kv.Encode(config.NewPlaintext(plaintext))
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s:%d: %s", name, line, err))
+			out = append(out, data[m[0]:m[1]]...)
+			continue
+		}
+		if m[2] != -1 && m[8] != -1 {
+			out = fmt.Appendf(out, "${enc:%s:+encs+%s}", keyfile, e)
+		} else {
+			// plain value, or an incomplete expandable one, keep
+			// everything but the ciphertext
+			out = append(out, data[m[0]:m[6]]...)
+			out = append(out, e...)
+			out = append(out, data[m[7]:m[1]]...)
+		}
+		changed++
+	}
+	out = append(out, data[last:]...)
+	return
+}
+
+// rekeyCandidates returns the keys to try for the encoded value at
+// match m in data. If the value is in the expandable form and its
+// keyfile references refer to any of keys then only those are returned,
+// otherwise all keys are.
+func rekeyCandidates(keys []rekeyKey, data []byte, m []int, name string) (candidates []rekeyKey) {
+	if m[4] == -1 {
+		return keys
+	}
+	refs := string(data[m[4]:m[5]])
+	if strings.HasSuffix(name, ".json") {
+		var r string
+		if err := json.Unmarshal([]byte(`"`+refs+`"`), &r); err == nil {
+			refs = r
+		}
+	}
+	for _, k := range keys {
+		for ref := range strings.SplitSeq(refs, "|") {
+			if k.matches(ref) {
+				candidates = append(candidates, k)
+				break
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return keys
+	}
+	return
+}
+
+// rekeyValue decodes ciphertext with each of keys and returns the
+// plaintext to re-encode with next. plaintext is nil and reason empty
+// if the value is already encoded with next. If the value cannot be
+// safely re-keyed then reason says why.
+func rekeyValue(ciphertext []byte, next *config.KeyValues, keys []rekeyKey) (plaintext []byte, reason string) {
+	var isNext, empty, ambiguous bool
+	for _, k := range keys {
+		p, err := k.kv.Decode(ciphertext)
+		if err != nil {
+			continue
+		}
+		switch {
+		case len(p) == 0:
+			empty = true
+		case k.kv == next:
+			isNext = true
+		case plaintext != nil && !bytes.Equal(plaintext, p):
+			ambiguous = true
+		default:
+			plaintext = p
+		}
+	}
+	switch {
+	case empty:
+		return nil, "decodes to an empty value"
+	case ambiguous:
+		return nil, "decodes with more than one previous key"
+	case isNext && plaintext != nil:
+		return nil, "decodes with both the new and a previous key"
+	case isNext:
+		return nil, ""
+	case plaintext == nil:
+		return nil, "cannot decode value"
+	}
+	return
+}
+
+// rekeyInstance prepares the re-encryption of the encoded values in
+// the configuration of instance i, using the previous key values
+// passed as the first param, if any, and the instance's own
+// prevkeyfile. Values are re-encoded with the instance keyfile. The
+// response Value is a *rekeyFile if the configuration contains any
+// encoded values.
+func rekeyInstance(i geneos.Instance, params ...any) (resp *instance.Response) {
+	resp = instance.NewResponse(i)
+
+	if len(params) == 0 {
+		resp.Err = geneos.ErrInvalidArgs
+		return
+	}
+	prev, _ := params[0].(*config.KeyValues)
+
+	h := i.Host()
+	cf := instance.ComponentFilepath(i)
+	data, err := h.ReadFile(cf)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			// legacy .rc file, nothing to do
+			err = nil
+		}
+		resp.Err = err
+		return
+	}
+	if !encodedValueRE.Match(data) {
+		return
+	}
+	st, err := h.Stat(cf)
+	if err != nil {
+		resp.Err = err
+		return
+	}
+	f := &rekeyFile{
+		h:     h,
+		path:  cf,
+		owner: i.String(),
+		mode:  st.Mode().Perm(),
+		orig:  data,
+		data:  data,
+	}
+	resp.Value = f
+
+	keyfile := instance.PathOf(i, "keyfile")
+	if keyfile == "" {
+		f.failed = append(f.failed, fmt.Sprintf("%s: encoded values found but no keyfile set", h.HostPath(cf)))
+		return
+	}
+	nk := config.KeyFile(keyfile)
+	next, err := nk.Read(h)
+	if err != nil {
+		resp.Err = err
+		return
+	}
+
+	var prevs []rekeyKey
+	if prev != nil {
+		prevs = append(prevs, rekeyKey{prev, rekeyCmdPrevKeyfile})
+	}
+	if p := instance.PathOf(i, "prevkeyfile"); p != "" {
+		pk := config.KeyFile(p)
+		kv, err := pk.Read(h)
+		if err != nil {
+			resp.Err = err
+			return
+		}
+		prevs = append(prevs, rekeyKey{kv, p})
+	}
+
+	f.data, f.changed, f.failed = rekeyData(data, h.HostPath(cf), prevs, rekeyKey{next, config.AbbreviateHome(keyfile)})
+	return
+}
+
+// rekeyUserFiles prepares the re-encryption of the encoded values in
+// the user's configuration, hosts and credentials files. Values are
+// decoded with prev, if not nil, or the previous user key files, if
+// they exist, and re-encoded with the new user key file.
+func rekeyUserFiles(prev *config.KeyValues) (files []*rekeyFile, err error) {
+	var paths []string
+	if confDir, err := config.UserConfigDir(); err == nil {
+		paths = append(paths,
+			path.Join(confDir, cordial.ExecutableName()+".json"),
+			path.Join(confDir, geneos.OldUserHostFile),
+		)
+	}
+	if appDir := config.AppConfigDir(); appDir != "" {
+		dirs, _ := geneos.LOCAL.ReadDir(appDir)
+		for _, d := range dirs {
+			switch path.Ext(d.Name()) {
+			case ".json", ".yaml", ".yml":
+				if d.Type().IsRegular() {
+					paths = append(paths, path.Join(appDir, d.Name()))
+				}
+			}
+		}
+	}
+
+	// keys are only loaded once a file with encoded values is found
+	var next *config.KeyValues
+	var prevs []rekeyKey
+	keyfile := config.ExpandHome(rekeyCmdKeyfile)
+
+	for _, p := range paths {
+		data, err := geneos.LOCAL.ReadFile(p)
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+			continue
+		}
+		if !encodedValueRE.Match(data) {
+			continue
+		}
+		st, err := geneos.LOCAL.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+
+		if next == nil {
+			nk := config.KeyFile(keyfile)
+			if next, err = nk.Read(host.Localhost); err != nil {
+				return nil, err
+			}
+			if prev != nil {
+				prevs = append(prevs, rekeyKey{prev, rekeyCmdPrevKeyfile})
+			}
+			// the backup left by `aes new --user` and the default
+			// previous keyfile for `aes decode`
+			kp := string(cmd.DefaultUserKeyfile)
+			ext := path.Ext(kp)
+			for _, p := range []string{
+				strings.TrimSuffix(kp, ext) + rekeyCmdBackupSuffix + ext,
+				string(aesPrevUserKeyFile),
+			} {
+				pk := config.KeyFile(p)
+				if kv, err := pk.Read(host.Localhost); err == nil {
+					prevs = append(prevs, rekeyKey{kv, p})
+				} else if !errors.Is(err, fs.ErrNotExist) {
+					return nil, err
+				}
+			}
+		}
+
+		f := &rekeyFile{
+			h:     host.Localhost,
+			path:  p,
+			owner: "user",
+			mode:  st.Mode().Perm(),
+			orig:  data,
+		}
+		f.data, f.changed, f.failed = rekeyData(data, p, prevs, rekeyKey{next, config.AbbreviateHome(keyfile)})
+		files = append(files, f)
+	}
+	return
+}
+
+// rekeyCommit writes the changed files as one operation. All original
+// files are first backed up using suffix and, if any update fails, all
+// files already written are restored from the original contents.
+func rekeyCommit(files []*rekeyFile, suffix string) (err error) {
+	files = slices.DeleteFunc(slices.Clone(files), func(f *rekeyFile) bool { return f.changed == 0 })
+
+	for n, f := range files {
+		if err = f.h.WriteFile(f.path+suffix, f.orig, f.mode); err != nil {
+			for _, b := range files[:n] {
+				b.h.Remove(b.path + suffix)
+			}
+			return fmt.Errorf("backup of %s failed, no files changed: %w", f.h.HostPath(f.path), err)
+		}
+	}
+
+	for n, f := range files {
+		if err = f.h.WriteFile(f.path, f.data, f.mode); err != nil {
+			for _, r := range files[:n+1] {
+				if err := r.h.WriteFile(r.path, r.orig, r.mode); err != nil {
+					log.Error().Err(err).Msgf("cannot restore %s, copy the backup %s manually", r.h.HostPath(r.path), r.path+suffix)
+				}
+			}
+			return fmt.Errorf("update of %s failed, all changes reverted: %w", f.h.HostPath(f.path), err)
+		}
+	}
+	return
+}
@@ -0,0 +1,91 @@
+package aescmd
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/itrs-group/cordial/pkg/config"
+)
+
+func TestRekeyDataTwice(t *testing.T) {
+	prev := rekeyKey{config.NewRandomKeyValues(), "old.aes"}
+	next := rekeyKey{config.NewRandomKeyValues(), "new.aes"}
+
+	// enough values that a wrong key decoding by chance is all but
+	// certain, so the keyfile references must be used to choose keys
+	const count = 1000
+	var data []byte
+	for n := range count {
+		e, err := prev.kv.EncodeString(fmt.Sprintf("secret%d", n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = fmt.Appendf(data, "value%d: ${enc:old.aes:+encs+%s}\n", n, e)
+	}
+
+	once, changed, failed := rekeyData(data, "test.yaml", []rekeyKey{prev}, next)
+	if changed != count || len(failed) > 0 {
+		t.Fatalf("first run changed %d of %d values, failed %v", changed, count, failed)
+	}
+
+	twice, changed, failed := rekeyData(once, "test.yaml", []rekeyKey{prev}, next)
+	if changed != 0 || len(failed) > 0 {
+		t.Errorf("second run changed %d values, failed %v", changed, failed)
+	}
+	if !bytes.Equal(once, twice) {
+		t.Error("second run modified already re-keyed data")
+	}
+
+	matches := encodedValueRE.FindAllSubmatch(twice, -1)
+	if len(matches) != count {
+		t.Fatalf("found %d values, want %d", len(matches), count)
+	}
+	for n, m := range matches {
+		if string(m[2]) != "new.aes" {
+			t.Errorf("value %d keyfile is %q", n, m[2])
+		}
+		p, err := next.kv.DecodeString(string(m[3]))
+		if err != nil || p != fmt.Sprintf("secret%d", n) {
+			t.Errorf("value %d decodes to %q, %v", n, p, err)
+		}
+	}
+}
+
+func TestRekeyDataAmbiguous(t *testing.T) {
+	prev := rekeyKey{config.NewRandomKeyValues(), "old.aes"}
+	next := rekeyKey{config.NewRandomKeyValues(), "new.aes"}
+
+	// find plain values, with no keyfile reference, that decode with
+	// both keys or to an empty plaintext with the wrong key
+	var data []byte
+	var wrong int
+	for n := 0; wrong < 5 && n < 100000; n++ {
+		e, err := prev.kv.EncodeString(fmt.Sprintf("secret%d", n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := next.kv.DecodeString(e); err != nil {
+			continue
+		}
+		data = fmt.Appendf(data, "value%d: +encs+%s\n", n, e)
+		wrong++
+	}
+	if wrong == 0 {
+		t.Skip("no value decoded with the wrong key")
+	}
+
+	out, changed, failed := rekeyData(data, "test.yaml", []rekeyKey{prev}, next)
+	if changed != 0 || len(failed) != wrong {
+		t.Errorf("changed %d values and failed %d, want 0 and %d: %v", changed, len(failed), wrong, failed)
+	}
+	if !bytes.Equal(out, data) {
+		t.Error("values that decode with more than one key were changed")
+	}
+	for _, f := range failed {
+		if !strings.Contains(f, "both the new and a previous key") && !strings.Contains(f, "empty value") {
+			t.Errorf("unexpected failure %q", f)
+		}
+	}
+}
@@ -0,0 +1,617 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+	"github.com/itrs-group/cordial/tools/geneos/internal/instance"
+)
+
+var applyCmdFile string
+var applyCmdDryRun, applyCmdNoStart bool
+var applyCmdDays int
+
+func init() {
+	GeneosCmd.AddCommand(applyCmd)
+
+	applyCmd.Flags().StringVarP(&applyCmdFile, "file", "f", "", "Manifest `PATH|URL|-` describing the desired state")
+	applyCmd.Flags().BoolVarP(&applyCmdDryRun, "dry-run", "n", false, "Print the plan but do not make any changes")
+	applyCmd.Flags().BoolVarP(&applyCmdNoStart, "nostart", "N", false, "Do not start or restart any instances")
+	applyCmd.Flags().IntVarP(&applyCmdDays, "days", "D", 365, "Duration in days of certificates created for instances\nwithout `tls-days` in the manifest")
+
+	applyCmd.MarkFlagRequired("file")
+
+	applyCmd.Flags().SortFlags = false
+}
+
+//go:embed _docs/apply.md
+var applyCmdDescription string
+
+var applyCmd = &cobra.Command{
+	Use:     "apply [flags] -f FILE",
+	GroupID: CommandGroupConfig,
+	Short:   "Apply a desired-state manifest",
+	Long:    applyCmdDescription,
+	Example: `
+geneos apply -f estate.yaml --dry-run
+geneos apply -f estate.yaml
+`,
+	SilenceUsage: true,
+	Annotations: map[string]string{
+		CmdGlobal:      "false",
+		CmdRequireHome: "true",
+	},
+	RunE: func(command *cobra.Command, _ []string) (err error) {
+		manifest, err := ReadManifest(applyCmdFile)
+		if err != nil {
+			return
+		}
+
+		plan, err := manifest.Plan(command)
+		if err != nil {
+			return
+		}
+
+		if len(plan) == 0 {
+			fmt.Println("nothing to do, estate matches manifest")
+			return
+		}
+
+		plan.Write(os.Stdout)
+
+		if applyCmdDryRun {
+			return
+		}
+
+		return plan.Apply()
+	},
+}
+
+// Manifest is the desired state of an estate, as read by the `apply`
+// command
+type Manifest struct {
+	Hosts     []ManifestHost     `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+	Packages  []ManifestPackage  `json:"packages,omitempty" yaml:"packages,omitempty"`
+	Instances []ManifestInstance `json:"instances,omitempty" yaml:"instances,omitempty"`
+}
+
+// ManifestHost is a remote host. URL is in the same format as for `host
+// add`
+type ManifestHost struct {
+	Name string `json:"name" yaml:"name"`
+	URL  string `json:"url,omitempty" yaml:"url,omitempty"`
+}
+
+// ManifestPackage is an installed release and the base link that
+// points to it. Version defaults to "latest" which only installs a
+// release if the base link does not exist.
+type ManifestPackage struct {
+	Type    string `json:"type" yaml:"type"`
+	Host    string `json:"host,omitempty" yaml:"host,omitempty"`
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	Base    string `json:"base,omitempty" yaml:"base,omitempty"`
+}
+
+// ManifestInstance is an instance and its settings. The list values
+// use the same formats as the corresponding command line flags for
+// `add` and `set`. If a list is present, even if empty, then it is
+// authoritative and any existing entries not in the manifest are
+// removed.
+type ManifestInstance struct {
+	Type     string            `json:"type" yaml:"type"`
+	Name     string            `json:"name" yaml:"name"`
+	Host     string            `json:"host,omitempty" yaml:"host,omitempty"`
+	Base     string            `json:"base,omitempty" yaml:"base,omitempty"`
+	Port     uint16            `json:"port,omitempty" yaml:"port,omitempty"`
+	Template string            `json:"template,omitempty" yaml:"template,omitempty"`
+	Start    bool              `json:"start,omitempty" yaml:"start,omitempty"`
+	TLS      bool              `json:"tls,omitempty" yaml:"tls,omitempty"`
+	TLSDays  int               `json:"tls-days,omitempty" yaml:"tls-days,omitempty"`
+	Settings map[string]string `json:"settings,omitempty" yaml:"settings,omitempty"`
+
+	Envs       []string `json:"envs,omitempty" yaml:"envs,omitempty"`
+	Includes   []string `json:"includes,omitempty" yaml:"includes,omitempty"`
+	Gateways   []string `json:"gateways,omitempty" yaml:"gateways,omitempty"`
+	Attributes []string `json:"attributes,omitempty" yaml:"attributes,omitempty"`
+	Types      []string `json:"types,omitempty" yaml:"types,omitempty"`
+	Variables  []string `json:"variables,omitempty" yaml:"variables,omitempty"`
+}
+
+// ReadManifest reads and parses the manifest from source, which can
+// be a local file, a URL or `-` for STDIN. JSON manifests are accepted
+// as they are also valid YAML.
+func ReadManifest(source string) (manifest *Manifest, err error) {
+	b, err := geneos.ReadAll(source)
+	if err != nil {
+		return
+	}
+	manifest = &Manifest{}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err = dec.Decode(manifest); err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+	return
+}
+
+// PlanStep is a single change required to converge the estate on the
+// manifest
+type PlanStep struct {
+	Target string
+	Action string
+	Detail string
+	do     func() error
+}
+
+// Plan is the ordered list of steps returned by Manifest.Plan()
+type Plan []PlanStep
+
+// Write outputs the plan as a table to w
+func (plan Plan) Write(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 3, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Target\tAction\tDetail\n")
+	for _, s := range plan {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Target, s.Action, s.Detail)
+	}
+	tw.Flush()
+}
+
+// Apply runs each step in the plan in order, stopping on the first
+// error
+func (plan Plan) Apply() (err error) {
+	for _, s := range plan {
+		log.Debug().Msgf("%s: %s %s", s.Target, s.Action, s.Detail)
+		if err = s.do(); err != nil {
+			if errors.Is(err, geneos.ErrRunning) || errors.Is(err, os.ErrProcessDone) {
+				err = nil
+				continue
+			}
+			return fmt.Errorf("%s: %s: %w", s.Target, s.Action, err)
+		}
+		fmt.Printf("%s: %s done\n", s.Target, s.Action)
+	}
+	return
+}
+
+// Plan compares the manifest with the current state of the hosts,
+// packages and instances and returns the steps required to converge.
+// Hosts are added first, then packages, then instances and finally
+// instances are (re)started.
+//
+// Existing instances are updated in memory while the plan is built so
+// that changes can be detected, but nothing is written until Apply()
+// is called.
+func (manifest *Manifest) Plan(command *cobra.Command) (plan Plan, err error) {
+	var starts Plan
+
+	for _, mh := range manifest.Hosts {
+		if mh.Name == "" {
+			return nil, fmt.Errorf("%w: host with no name", geneos.ErrInvalidArgs)
+		}
+		if _, h := manifestHost(mh.Name); h != nil {
+			continue
+		}
+		args := []string{mh.Name}
+		if mh.URL != "" {
+			args = append(args, mh.URL)
+		}
+		plan = append(plan, PlanStep{
+			Target: "host " + mh.Name,
+			Action: "add",
+			Detail: mh.URL,
+			do: func() error {
+				return RunE(command.Root(), []string{"host", "add"}, args)
+			},
+		})
+	}
+
+	for _, mp := range manifest.Packages {
+		step, ok, err := mp.plan()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			plan = append(plan, step)
+		}
+	}
+
+	for _, mi := range manifest.Instances {
+		steps, start, err := mi.plan()
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, steps...)
+		starts = append(starts, start...)
+	}
+
+	if !applyCmdNoStart {
+		plan = append(plan, starts...)
+	}
+	return
+}
+
+// manifestHost returns the host name, defaulting to localhost, and
+// the host if it is already configured. Hosts that are only added by
+// an earlier step in the plan are returned as nil and must be looked
+// up again when the step is applied.
+func manifestHost(name string) (string, *geneos.Host) {
+	if name == "" {
+		name = geneos.LOCALHOST
+	}
+	h := geneos.GetHost(name)
+	if h == geneos.UNKNOWN || !h.Exists() {
+		return name, nil
+	}
+	return name, h
+}
+
+func (mp ManifestPackage) plan() (step PlanStep, ok bool, err error) {
+	ct := geneos.ParseComponent(mp.Type)
+	if ct == nil {
+		err = fmt.Errorf("%w: unknown package type %q", geneos.ErrInvalidArgs, mp.Type)
+		return
+	}
+	hostname, h := manifestHost(mp.Host)
+	base := mp.Base
+	if base == "" {
+		base = "active_prod"
+	}
+	version := mp.Version
+	if version == "" {
+		version = "latest"
+	}
+
+	current := "unknown"
+	if h != nil {
+		current, _ = geneos.CurrentVersion(h, ct, base)
+	}
+	if current != "unknown" && (version == "latest" || version == current) {
+		return
+	}
+
+	step = PlanStep{
+		Target: fmt.Sprintf("package %s@%s", ct, hostname),
+		Action: "install",
+		Detail: fmt.Sprintf("%s as %s", version, base),
+		do: func() (err error) {
+			h := geneos.GetHost(hostname)
+			if err = geneos.Install(h, ct,
+				geneos.Version(version),
+				geneos.Basename(base),
+			); err != nil && !errors.Is(err, fs.ErrExist) {
+				return
+			}
+			if current == "unknown" {
+				return nil
+			}
+			// an existing base link must be moved to the new release,
+			// restarting any instances using it
+			return geneos.Update(h, ct,
+				geneos.Version(version),
+				geneos.Basename(base),
+				geneos.Force(true),
+				geneos.Restart(instance.Instances(h, ct, instance.FilterParameters("version="+base), instance.IgnoreSelector())...),
+				geneos.StartFunc(instance.Start),
+				geneos.StopFunc(instance.Stop),
+				geneos.HookFunc(instance.RunHook),
+			)
+		},
+	}
+	if current != "unknown" {
+		step.Action = "update"
+		step.Detail = fmt.Sprintf("%s from %s to %s", base, current, version)
+	}
+	ok = true
+	return
+}
+
+// values converts the list settings in the manifest into the types
+// used by the `add` and `set` command flags
+func (mi ManifestInstance) values() (set instance.SetConfigValues, err error) {
+	for _, k := range slices.Sorted(maps.Keys(mi.Settings)) {
+		set.Params = append(set.Params, k+"="+mi.Settings[k])
+	}
+	for _, v := range mi.Envs {
+		if err = set.Envs.Set(v); err != nil {
+			return
+		}
+	}
+	for _, v := range mi.Includes {
+		if err = set.Includes.Set(v); err != nil {
+			return
+		}
+	}
+	for _, v := range mi.Gateways {
+		if err = set.Gateways.Set(v); err != nil {
+			return
+		}
+	}
+	for _, v := range mi.Attributes {
+		if err = set.Attributes.Set(v); err != nil {
+			return
+		}
+	}
+	for _, v := range mi.Types {
+		if err = set.Types.Set(v); err != nil {
+			return
+		}
+	}
+	for _, v := range mi.Variables {
+		if err = set.Variables.Set(v); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// unsetValues returns the settings in instance i that are not in the
+// manifest, for those lists that are given in the manifest
+func (mi ManifestInstance) unsetValues(i geneos.Instance, set instance.SetConfigValues) (unset instance.UnsetConfigValues) {
+	cf := i.Config()
+
+	names := func(items []string) (n []string) {
+		for _, v := range items {
+			n = append(n, strings.SplitN(v, "=", 2)[0])
+		}
+		return
+	}
+
+	missing := func(existing, wanted []string) (m []string) {
+	OUTER:
+		for _, e := range existing {
+			for _, w := range wanted {
+				if e == w {
+					continue OUTER
+				}
+			}
+			m = append(m, e)
+		}
+		return
+	}
+
+	if mi.Envs != nil {
+		unset.Envs = missing(names(cf.GetStringSlice("env")), names(set.Envs))
+	}
+	if mi.Attributes != nil {
+		unset.Attributes = missing(names(cf.GetStringSlice("attributes")), names(set.Attributes))
+	}
+	if mi.Types != nil {
+		unset.Types = missing(cf.GetStringSlice("types"), set.Types)
+	}
+	if mi.Includes != nil {
+		for k := range cf.GetStringMap("includes") {
+			if _, ok := set.Includes[k]; !ok {
+				unset.Includes = append(unset.Includes, k)
+			}
+		}
+	}
+	if mi.Gateways != nil {
+		for k := range cf.GetStringMap("gateways") {
+			if _, ok := set.Gateways[k]; !ok {
+				unset.Gateways = append(unset.Gateways, k)
+			}
+		}
+	}
+	if mi.Variables != nil {
+		for k := range cf.GetStringMap("variables") {
+			if _, ok := set.Variables[k]; !ok {
+				unset.Variables = append(unset.Variables, k)
+			}
+		}
+	}
+	return
+}
+
+func (mi ManifestInstance) plan() (steps Plan, starts Plan, err error) {
+	ct := geneos.ParseComponent(mi.Type)
+	if ct == nil {
+		err = fmt.Errorf("%w: unknown component type %q", geneos.ErrInvalidArgs, mi.Type)
+		return
+	}
+	if mi.Name == "" {
+		err = fmt.Errorf("%w: %s instance with no name", geneos.ErrInvalidArgs, ct)
+		return
+	}
+
+	name := mi.Name
+	hostname, h := manifestHost(mi.Host)
+	if n, hn, ok := strings.Cut(name, "@"); ok {
+		name = n
+		hostname, h = manifestHost(hn)
+	}
+	name += "@" + hostname
+
+	set, err := mi.values()
+	if err != nil {
+		return
+	}
+
+	var i geneos.Instance
+	if h != nil {
+		if i, err = instance.Get(ct, name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return
+		}
+		err = nil
+	}
+
+	if i == nil || i.Loaded().IsZero() {
+		steps = append(steps, PlanStep{
+			Target: ct.String() + " " + name,
+			Action: "add",
+			Detail: strings.Join(set.Params, " "),
+			do: func() error {
+				return mi.add(ct, name, set)
+			},
+		})
+		if mi.TLS {
+			steps = append(steps, mi.tlsStep(ct, name))
+		}
+		if mi.Start {
+			starts = append(starts, mi.startStep(ct, name, false))
+		}
+		return
+	}
+
+	before, _ := json.Marshal(i.Config().AllSettings())
+	if mi.Base != "" {
+		i.Config().Set("version", mi.Base)
+	}
+	if mi.Port != 0 {
+		i.Config().Set("port", mi.Port)
+	}
+	instance.UnsetInstanceValues(i, mi.unsetValues(i, set))
+	if err = instance.SetInstanceValues(i, set, ""); err != nil {
+		return
+	}
+	after, _ := json.Marshal(i.Config().AllSettings())
+
+	changed := !bytes.Equal(before, after)
+	if changed {
+		steps = append(steps, PlanStep{
+			Target: i.String(),
+			Action: "set",
+			Detail: "update configuration and rebuild",
+			do: func() error {
+				if err := instance.SaveConfig(i); err != nil {
+					return err
+				}
+				if err := i.Rebuild(false); err != nil && !errors.Is(err, geneos.ErrNotSupported) {
+					return err
+				}
+				return nil
+			},
+		})
+	}
+
+	if mi.TLS {
+		if _, valid, _, err := instance.ReadCert(i); err != nil || !valid {
+			steps = append(steps, mi.tlsStep(ct, name))
+		}
+	}
+
+	if mi.Start && !instance.IsDisabled(i) {
+		running := instance.IsRunning(i)
+		if !running || changed {
+			starts = append(starts, mi.startStep(ct, name, running))
+		}
+	}
+
+	return
+}
+
+// add creates a new instance, following the same steps as the `add`
+// command
+func (mi ManifestInstance) add(ct *geneos.Component, name string, set instance.SetConfigValues) (err error) {
+	_, _, h := instance.SplitName(name, geneos.LOCAL)
+	if err = ct.MakeDirs(h); err != nil {
+		return
+	}
+
+	i, err := instance.Get(ct, name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if !i.Loaded().IsZero() {
+		return geneos.ErrExists
+	}
+
+	if err = i.Add(mi.Template, mi.Port); err != nil {
+		return
+	}
+
+	if mi.Base != "" && mi.Base != "active_prod" {
+		i.Config().Set("version", mi.Base)
+	}
+
+	if err = instance.SetInstanceValues(i, set, ""); err != nil {
+		return
+	}
+	if err = instance.SaveConfig(i); err != nil {
+		return
+	}
+
+	i.Unload()
+	i.Load()
+	if err = i.Rebuild(true); errors.Is(err, geneos.ErrNotSupported) {
+		err = nil
+	}
+	return
+}
+
+func (mi ManifestInstance) tlsStep(ct *geneos.Component, name string) PlanStep {
+	return PlanStep{
+		Target: ct.String() + " " + name,
+		Action: "tls",
+		Detail: "create certificate and key",
+		do: func() error {
+			i, err := instance.Get(ct, name)
+			if err != nil {
+				return err
+			}
+			days := mi.TLSDays
+			if days == 0 {
+				days = applyCmdDays
+			}
+			if days < 1 {
+				return fmt.Errorf("%w: certificate duration must be at least one day", geneos.ErrInvalidArgs)
+			}
+			return instance.CreateCert(i, 24*time.Hour*time.Duration(days)).Err
+		},
+	}
+}
+
+func (mi ManifestInstance) startStep(ct *geneos.Component, name string, restart bool) PlanStep {
+	action := "start"
+	if restart {
+		action = "restart"
+	}
+	return PlanStep{
+		Target: ct.String() + " " + name,
+		Action: action,
+		do: func() error {
+			i, err := instance.Get(ct, name)
+			if err != nil {
+				return err
+			}
+			if restart {
+				if err = instance.Stop(i, false, false); err != nil && !errors.Is(err, os.ErrProcessDone) {
+					return err
+				}
+			}
+			return instance.Start(i)
+		},
+	}
+}
@@ -49,6 +49,7 @@ var copyCmd = &cobra.Command{
 		CmdRequireHome:   "true",
 		CmdWildcardNames: "true",
 		CmdKeepHosts:     "true",
+		CmdNoSelector:    "true",
 	},
 	DisableFlagsInUseLine: true,
 	RunE: func(cmd *cobra.Command, _ []string) (err error) {
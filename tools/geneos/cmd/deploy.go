@@ -118,6 +118,7 @@ var deployCmd = &cobra.Command{
 	Annotations: map[string]string{
 		CmdGlobal:      "false",
 		CmdRequireHome: "false",
+		CmdNoSelector:  "true",
 	},
 	RunE: func(command *cobra.Command, _ []string) (err error) {
 		var name string
@@ -0,0 +1,231 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+	"github.com/itrs-group/cordial/tools/geneos/internal/instance"
+)
+
+var exporterCmdListen, exporterCmdPath string
+
+func init() {
+	GeneosCmd.AddCommand(exporterCmd)
+
+	exporterCmd.Flags().StringVarP(&exporterCmdListen, "listen", "l", ":9720", "Listen on `[ADDR]:PORT`")
+	exporterCmd.Flags().StringVarP(&exporterCmdPath, "path", "p", "/metrics", "Serve metrics on URL `PATH`")
+
+	exporterCmd.Flags().SortFlags = false
+}
+
+//go:embed _docs/exporter.md
+var exporterCmdDescription string
+
+var exporterCmd = &cobra.Command{
+	Use:          "exporter [flags] [TYPE] [NAME...]",
+	GroupID:      CommandGroupView,
+	Short:        "Export Instance Metrics For Prometheus",
+	Long:         exporterCmdDescription,
+	SilenceUsage: true,
+	Annotations: map[string]string{
+		CmdGlobal:        "true",
+		CmdRequireHome:   "true",
+		CmdWildcardNames: "true",
+	},
+	RunE: func(cmd *cobra.Command, _ []string) (err error) {
+		ct, names := ParseTypeNames(cmd)
+
+		mux := http.NewServeMux()
+		mux.HandleFunc(exporterCmdPath, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+			writeMetrics(w, geneos.GetHost(Hostname), ct, names)
+		})
+
+		server := &http.Server{
+			Addr:              exporterCmdListen,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			server.Shutdown(shutdown)
+		}()
+
+		log.Info().Msgf("serving metrics on %s%s", exporterCmdListen, exporterCmdPath)
+		if err = server.ListenAndServe(); errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		return
+	},
+}
+
+// exporterMetric describes one metric family. All samples have type,
+// name and host labels.
+type exporterMetric struct {
+	name string
+	kind string
+	help string
+}
+
+var exporterMetrics = []exporterMetric{
+	{"geneos_instance_up", "gauge", "Whether the instance process is running (1) or not (0)."},
+	{"geneos_instance_start_time_seconds", "gauge", "Start time of the instance process since the Unix epoch in seconds."},
+	{"geneos_instance_resident_memory_bytes", "gauge", "Resident memory size of the instance process in bytes."},
+	{"geneos_instance_cpu_seconds_total", "counter", "Total user and system CPU time used by the instance process in seconds."},
+	{"geneos_instance_open_files", "gauge", "Number of regular files open by the instance process."},
+	{"geneos_instance_listening_port", "gauge", "TCP ports the instance process is listening on."},
+	{"geneos_instance_certificate_expiry_seconds", "gauge", "Seconds until the instance certificate expires. Negative if expired."},
+	{"geneos_instance_version_info", "gauge", "Installed and active release versions for the instance."},
+	{"geneos_instance_version_current", "gauge", "Whether the instance process is running the installed release (1) or not (0)."},
+}
+
+// exporterSample is a single sample for the metric family name
+type exporterSample struct {
+	name   string
+	labels []string
+	value  float64
+}
+
+// writeMetrics collects metrics for all the matching instances and
+// writes them to w in the Prometheus text exposition format
+func writeMetrics(w io.Writer, h *geneos.Host, ct *geneos.Component, names []string) {
+	start := time.Now()
+	responses := instance.Do(h, ct, names, exporterInstance)
+
+	samples := map[string][]string{}
+	for _, k := range slices.Sorted(maps.Keys(responses)) {
+		r := responses[k]
+		if r.Err != nil {
+			log.Debug().Err(r.Err).Msgf("%s", r.Instance)
+		}
+		s, ok := r.Value.([]exporterSample)
+		if !ok {
+			continue
+		}
+		common := []string{"type", r.Instance.Type().String(), "name", r.Instance.Name(), "host", r.Instance.Host().String()}
+		for _, sample := range s {
+			samples[sample.name] = append(samples[sample.name], fmt.Sprintf("%s{%s} %v", sample.name, exporterLabels(append(common, sample.labels...)), sample.value))
+		}
+	}
+
+	var b bytes.Buffer
+	for _, m := range exporterMetrics {
+		if len(samples[m.name]) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, s := range samples[m.name] {
+			fmt.Fprintln(&b, s)
+		}
+	}
+	fmt.Fprintf(&b, "# HELP geneos_exporter_scrape_duration_seconds Time taken to collect all instance metrics.\n# TYPE geneos_exporter_scrape_duration_seconds gauge\n")
+	fmt.Fprintf(&b, "geneos_exporter_scrape_duration_seconds %v\n", time.Since(start).Seconds())
+	b.WriteTo(w)
+}
+
+// exporterLabels formats pairs of label names and values, escaping
+// values as required by the exposition format
+func exporterLabels(pairs []string) string {
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	labels := []string{}
+	for n := 0; n+1 < len(pairs); n += 2 {
+		labels = append(labels, fmt.Sprintf(`%s="%s"`, pairs[n], escape.Replace(pairs[n+1])))
+	}
+	return strings.Join(labels, ",")
+}
+
+// exporterInstance collects the samples for instance i and returns
+// them in the response Value as a slice of exporterSample
+func exporterInstance(i geneos.Instance, _ ...any) (resp *instance.Response) {
+	resp = instance.NewResponse(i)
+
+	if instance.IsDisabled(i) {
+		return
+	}
+
+	samples := []exporterSample{}
+	add := func(name string, value float64, labels ...string) {
+		samples = append(samples, exporterSample{name: name, labels: labels, value: value})
+	}
+	defer func() { resp.Value = samples }()
+
+	base, installed, _ := instance.Version(i)
+	if pkgtype := i.Config().GetString("pkgtype"); pkgtype != "" {
+		base = path.Join(pkgtype, base)
+	}
+
+	if cert, _, _, err := instance.ReadCert(i); err == nil && cert != nil {
+		add("geneos_instance_certificate_expiry_seconds", time.Until(cert.NotAfter).Truncate(time.Second).Seconds())
+	}
+
+	pid, _, _, starttime, err := instance.GetPIDInfo(i)
+	if err != nil {
+		add("geneos_instance_up", 0)
+		add("geneos_instance_version_info", 1, "base", base, "installed", installed, "active", "")
+		return
+	}
+	add("geneos_instance_up", 1)
+	add("geneos_instance_start_time_seconds", float64(starttime.Unix()))
+
+	if rss, cpu, err := instance.ProcessUsage(i, pid); err == nil {
+		add("geneos_instance_resident_memory_bytes", float64(rss))
+		add("geneos_instance_cpu_seconds_total", cpu.Seconds())
+	} else {
+		resp.Err = err
+	}
+
+	add("geneos_instance_open_files", float64(len(instance.Files(i))))
+
+	for _, port := range instance.ListeningPorts(i) {
+		add("geneos_instance_listening_port", 1, "port", fmt.Sprint(port))
+	}
+
+	_, _, active, _ := instance.LiveVersion(i, pid)
+	add("geneos_instance_version_info", 1, "base", base, "installed", installed, "active", active)
+	current := 0.0
+	if active == installed {
+		current = 1
+	}
+	add("geneos_instance_version_current", current)
+
+	return
+}
@@ -0,0 +1,334 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/itrs-group/cordial/pkg/commands"
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+	"github.com/itrs-group/cordial/tools/geneos/internal/instance"
+)
+
+var healthCmdJSON, healthCmdIndent, healthCmdCSV bool
+var healthCmdExpiry int
+var healthCmdStale time.Duration
+var healthCmdLines int
+
+func init() {
+	GeneosCmd.AddCommand(healthCmd)
+
+	healthCmd.Flags().IntVarP(&healthCmdExpiry, "expiry", "E", 30, "Warn if certificates expire within `DAYS`")
+	healthCmd.Flags().DurationVarP(&healthCmdStale, "stale", "S", time.Hour, "Warn if the log file has not been written to for `DURATION`")
+	healthCmd.Flags().IntVarP(&healthCmdLines, "lines", "n", 200, "Number of `LINES` at the end of the log file to check for errors")
+
+	healthCmd.Flags().BoolVarP(&healthCmdJSON, "json", "j", false, "Output JSON")
+	healthCmd.Flags().BoolVarP(&healthCmdIndent, "pretty", "i", false, "Output indented JSON")
+	healthCmd.Flags().BoolVarP(&healthCmdCSV, "csv", "c", false, "Output CSV")
+
+	healthCmd.Flags().SortFlags = false
+}
+
+//go:embed _docs/health.md
+var healthCmdDescription string
+
+var healthCmd = &cobra.Command{
+	Use:          "health [flags] [TYPE] [NAME...]",
+	GroupID:      CommandGroupView,
+	Short:        "Check Instance Health",
+	Long:         healthCmdDescription,
+	SilenceUsage: true,
+	Annotations: map[string]string{
+		CmdGlobal:        "true",
+		CmdRequireHome:   "true",
+		CmdWildcardNames: "true",
+	},
+	RunE: func(command *cobra.Command, _ []string) (err error) {
+		ct, names := ParseTypeNames(command)
+
+		responses := instance.Do(geneos.GetHost(Hostname), ct, names, healthInstance)
+
+		switch {
+		case healthCmdJSON, healthCmdIndent:
+			responses.Write(os.Stdout, instance.WriterIndent(healthCmdIndent))
+		case healthCmdCSV:
+			w := csv.NewWriter(os.Stdout)
+			w.Write([]string{"Type", "Name", "Host", "Check", "Result", "Detail"})
+			for _, r := range responses {
+				for _, c := range r.Value.([]healthCheck) {
+					r.Rows = append(r.Rows, []string{c.Type, c.Name, c.Host, c.Check, c.Result, c.Detail})
+				}
+			}
+			responses.Write(w)
+		default:
+			w := tabwriter.NewWriter(os.Stdout, 3, 8, 2, ' ', 0)
+			fmt.Fprintf(w, "Type\tName\tHost\tCheck\tResult\tDetail\n")
+			for _, r := range responses {
+				for _, c := range r.Value.([]healthCheck) {
+					r.Lines = append(r.Lines, fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s", c.Type, c.Name, c.Host, c.Check, c.Result, c.Detail))
+				}
+			}
+			responses.Write(w)
+		}
+
+		var failed int
+		for _, r := range responses {
+			if slices.ContainsFunc(r.Value.([]healthCheck), func(c healthCheck) bool { return c.Result == healthFail }) {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d instance(s) failed health checks", failed)
+		}
+		return
+	},
+}
+
+// health check results
+const (
+	healthPass = "pass"
+	healthWarn = "warn"
+	healthFail = "fail"
+	healthSkip = "skip"
+)
+
+type healthCheck struct {
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Host   string `json:"host"`
+	Check  string `json:"check"`
+	Result string `json:"result"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// healthChecks is the list of checks run against each instance, in
+// order. A check is only run if applies is nil or returns true.
+var healthChecks = []struct {
+	name    string
+	applies func(i geneos.Instance) bool
+	check   func(i geneos.Instance) (result, detail string)
+}{
+	{"process", nil, healthProcess},
+	{"ports", func(i geneos.Instance) bool { return i.Config().GetInt("port") != 0 }, healthPorts},
+	{"certificate", func(i geneos.Instance) bool { return instance.FileOf(i, "certificate") != "" }, healthCertificate},
+	{"log", nil, healthLog},
+	{"gateway-api", func(i geneos.Instance) bool { return instance.IsA(i, "gateway") }, healthGatewayPing},
+}
+
+// healthInstance runs all the applicable health checks for instance i
+// and returns them as a slice of healthCheck in the response Value
+func healthInstance(i geneos.Instance, _ ...any) (resp *instance.Response) {
+	resp = instance.NewResponse(i)
+
+	checks := []healthCheck{}
+	add := func(check, result, detail string) {
+		checks = append(checks, healthCheck{
+			Type:   i.Type().String(),
+			Name:   i.Name(),
+			Host:   i.Host().String(),
+			Check:  check,
+			Result: result,
+			Detail: detail,
+		})
+	}
+
+	if instance.IsDisabled(i) {
+		add("process", healthSkip, "disabled")
+		resp.Value = checks
+		return
+	}
+
+	for _, c := range healthChecks {
+		if c.applies != nil && !c.applies(i) {
+			continue
+		}
+		result, detail := c.check(i)
+		add(c.name, result, detail)
+	}
+	resp.Value = checks
+	return
+}
+
+func healthProcess(i geneos.Instance) (result, detail string) {
+	pid, err := instance.GetPID(i)
+	if err != nil {
+		return healthFail, "not running"
+	}
+	return healthPass, fmt.Sprintf("PID %d", pid)
+}
+
+func healthPorts(i geneos.Instance) (result, detail string) {
+	port := i.Config().GetInt("port")
+	ports := instance.ListeningPorts(i)
+	if !slices.Contains(ports, port) {
+		return healthFail, fmt.Sprintf("not listening on port %d", port)
+	}
+	return healthPass, fmt.Sprintf("listening on %s", strings.Join(instance.ListeningPortsStrings(i), ","))
+}
+
+func healthCertificate(i geneos.Instance) (result, detail string) {
+	cert, valid, _, err := instance.ReadCert(i)
+	if err != nil {
+		return healthFail, err.Error()
+	}
+	if !valid {
+		return healthFail, fmt.Sprintf("certificate not valid (expires %s)", cert.NotAfter.Format(time.RFC3339))
+	}
+	remaining := time.Until(cert.NotAfter)
+	if remaining < time.Duration(healthCmdExpiry)*24*time.Hour {
+		return healthWarn, fmt.Sprintf("expires in %d days", int(remaining.Hours()/24))
+	}
+	return healthPass, fmt.Sprintf("expires %s", cert.NotAfter.Format(time.RFC3339))
+}
+
+var healthLogErrorRE = regexp.MustCompile(`\b(ERROR|FATAL)\b`)
+
+func healthLog(i geneos.Instance) (result, detail string) {
+	logfile := instance.LogFilePath(i)
+	st, err := i.Host().Stat(logfile)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return healthWarn, "log file not found"
+		}
+		return healthFail, err.Error()
+	}
+
+	result = healthPass
+	if age := time.Since(st.ModTime()); instance.IsRunning(i) && age > healthCmdStale {
+		result = healthWarn
+		detail = fmt.Sprintf("not updated for %s", age.Truncate(time.Second))
+	}
+
+	f, err := i.Host().Open(logfile)
+	if err != nil {
+		return healthFail, err.Error()
+	}
+	defer f.Close()
+	text, err := tailLines(f, healthCmdLines)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return healthFail, err.Error()
+	}
+
+	var errorCount, fatalCount int
+	var last string
+	for _, line := range strings.Split(text, "\n") {
+		switch healthLogErrorRE.FindString(line) {
+		case "FATAL":
+			fatalCount++
+			last = line
+		case "ERROR":
+			errorCount++
+			last = line
+		}
+	}
+
+	switch {
+	case fatalCount > 0:
+		return healthFail, fmt.Sprintf("%d FATAL, %d ERROR in last %d lines, last: %s", fatalCount, errorCount, healthCmdLines, strings.TrimSpace(last))
+	case errorCount > 0:
+		return healthWarn, fmt.Sprintf("%d ERROR in last %d lines, last: %s", errorCount, healthCmdLines, strings.TrimSpace(last))
+	}
+	return
+}
+
+func healthGatewayPing(i geneos.Instance) (result, detail string) {
+	if !instance.IsRunning(i) {
+		return healthFail, "not running"
+	}
+	username, password := gatewayCredentials(i, "", nil)
+	start := time.Now()
+	if _, err := commands.DialGateway(gatewayURL(i),
+		commands.AllowInsecureCertificates(true),
+		commands.SetBasicAuth(username, password),
+	); err != nil {
+		return healthFail, err.Error()
+	}
+	return healthPass, fmt.Sprintf("REST API answered in %s", time.Since(start).Truncate(time.Millisecond))
+}
+
+// HealthCheck runs the process, ports and log checks against instance
+// i and returns a description of each check that fails. Only log lines
+// with a timestamp after since are checked and, unlike the `health`
+// command, any ERROR is a failure. It is used to decide if a staged
+// package update can continue.
+func HealthCheck(i geneos.Instance, since time.Time) (failures []string) {
+	if result, detail := healthProcess(i); result == healthFail {
+		return []string{fmt.Sprintf("%s: process: %s", i, detail)}
+	}
+	if i.Config().GetInt("port") != 0 {
+		if result, detail := healthPorts(i); result == healthFail {
+			failures = append(failures, fmt.Sprintf("%s: ports: %s", i, detail))
+		}
+	}
+	if detail := healthLogSince(i, since); detail != "" {
+		failures = append(failures, fmt.Sprintf("%s: log: %s", i, detail))
+	}
+	return
+}
+
+// healthLogSince returns a description of any ERROR or FATAL lines in
+// the end of the log file for instance i that are timestamped after
+// since, or an empty string if there are none
+func healthLogSince(i geneos.Instance, since time.Time) (detail string) {
+	f, err := i.Host().Open(instance.LogFilePath(i))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return
+		}
+		return err.Error()
+	}
+	defer f.Close()
+	text, err := tailLines(f, healthCmdLines)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err.Error()
+	}
+
+	var count int
+	var last string
+	var timestamp time.Time
+	for _, line := range strings.Split(text, "\n") {
+		// continuation lines take the timestamp of the line before
+		if t, ok := logTimestamp(line); ok {
+			timestamp = t
+		}
+		if timestamp.Before(since) {
+			continue
+		}
+		if healthLogErrorRE.MatchString(line) {
+			count++
+			last = line
+		}
+	}
+	if count > 0 {
+		return fmt.Sprintf("%d new ERROR or FATAL lines, last: %s", count, strings.TrimSpace(last))
+	}
+	return
+}
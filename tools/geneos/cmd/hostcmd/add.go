@@ -39,6 +39,9 @@ var addCmdInit, addCmdPrompt bool
 var addCmdPassword *config.Plaintext
 var addCmdKeyfile config.KeyFile
 var addCmdPrivateKeyfiles PrivateKeyFiles
+var addCmdJumps JumpHosts
+var addCmdJumpPrompt bool
+var addCmdProxyCommand string
 
 type PrivateKeyFiles []string
 
@@ -65,6 +68,7 @@ func init() {
 	addCmd.Flags().VarP(addCmdPassword, "password", "P", "Password")
 	addCmd.Flags().VarP(&addCmdKeyfile, "keyfile", "k", "Keyfile for encryption of stored password")
 	addCmd.Flags().VarP(&addCmdPrivateKeyfiles, "privatekey", "i", "Private key file")
+	addJumpFlags(addCmd.Flags(), &addCmdJumps, &addCmdJumpPrompt, &addCmdProxyCommand)
 
 	addCmd.Flags().SortFlags = false
 }
@@ -80,6 +84,7 @@ var addCmd = &cobra.Command{
 geneos host add server1
 geneos host add ssh://server2:50122
 geneos host add remote1 ssh://server.example.com/opt/geneos
+geneos host add remote2 ssh://geneos@10.1.2.3 -J admin@bastion.example.com --jump-privatekey ~/.ssh/bastion_ed25519
 `, "|", "`"),
 
 	SilenceUsage: true,
@@ -188,13 +193,19 @@ geneos host add remote1 ssh://server.example.com/opt/geneos
 			hostcf.Set("privatekeys", []string(addCmdPrivateKeyfiles))
 		}
 
-		h := geneos.NewHost(name,
-			host.Hostname(hostcf.GetString("hostname")),
-			host.Username(hostcf.GetString("username")),
-			host.Port(uint16(hostcf.GetInt("port"))),
-			host.Password(pw.Enclave),
-			host.PrivateKeyFiles(hostcf.GetStringSlice("privatekeys")...),
-		)
+		if len(addCmdJumps) > 0 || addCmdJumpPrompt {
+			var jumps []interface{}
+			if jumps, err = addCmdJumps.settings(&addCmdKeyfile, addCmdJumpPrompt); err != nil {
+				return
+			}
+			hostcf.Set("jumphosts", jumps)
+		}
+
+		if addCmdProxyCommand != "" {
+			hostcf.Set("proxycommand", addCmdProxyCommand)
+		}
+
+		h := geneos.NewHost(name, geneos.SSHOptions(hostcf)...)
 
 		h.MergeConfigMap(hostcf.AllSettings())
 
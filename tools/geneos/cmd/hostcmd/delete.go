@@ -80,7 +80,7 @@ var deleteCmd = &cobra.Command{
 		for _, h := range hosts {
 			// stop and/or delete instances on host
 			if deleteCmdStop {
-				for _, c := range instance.Instances(h, nil) {
+				for _, c := range instance.Instances(h, nil, instance.IgnoreSelector()) {
 					if err = instance.Stop(c, deleteCmdForce, false); err != nil && !errors.Is(err, os.ErrProcessDone) {
 						return err
 					}
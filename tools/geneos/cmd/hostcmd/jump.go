@@ -0,0 +1,168 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostcmd
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"github.com/itrs-group/cordial/pkg/config"
+	"github.com/itrs-group/cordial/pkg/host"
+)
+
+// jumpHost is a jump host given on the command line
+type jumpHost struct {
+	hostname    string
+	port        int
+	username    string
+	password    *config.Plaintext
+	privatekeys []string
+}
+
+// JumpHosts is a list of jump hosts, in the order they are connected
+// through, set with repeated `--jump` flags
+type JumpHosts []*jumpHost
+
+func (j *JumpHosts) String() string {
+	return ""
+}
+
+// Set parses value as `[ssh://][USER@]HOST[:PORT]`
+func (j *JumpHosts) Set(value string) error {
+	u, err := url.Parse("ssh://" + strings.TrimPrefix(value, "ssh://"))
+	if err != nil || u.Hostname() == "" {
+		return fmt.Errorf("invalid jump host %q", value)
+	}
+	var port int
+	if u.Port() != "" {
+		if port, err = strconv.Atoi(u.Port()); err != nil {
+			return fmt.Errorf("invalid port in jump host %q", value)
+		}
+	}
+	*j = append(*j, &jumpHost{
+		hostname: u.Hostname(),
+		port:     port,
+		username: u.User.Username(),
+	})
+	return nil
+}
+
+func (j *JumpHosts) Type() string {
+	return "[USER@]HOST[:PORT]"
+}
+
+// jumpHostPrivateKeys adds private key files to the last jump host
+type jumpHostPrivateKeys struct {
+	jumps *JumpHosts
+}
+
+func (k jumpHostPrivateKeys) String() string {
+	return ""
+}
+
+func (k jumpHostPrivateKeys) Set(value string) error {
+	if len(*k.jumps) == 0 {
+		return errors.New("must follow a --jump")
+	}
+	j := (*k.jumps)[len(*k.jumps)-1]
+	j.privatekeys = append(j.privatekeys, value)
+	return nil
+}
+
+func (k jumpHostPrivateKeys) Type() string {
+	return "PATH"
+}
+
+// jumpHostPassword sets the password of the last jump host
+type jumpHostPassword struct {
+	jumps *JumpHosts
+}
+
+func (p jumpHostPassword) String() string {
+	return ""
+}
+
+func (p jumpHostPassword) Set(value string) error {
+	if len(*p.jumps) == 0 {
+		return errors.New("must follow a --jump")
+	}
+	(*p.jumps)[len(*p.jumps)-1].password = config.NewPlaintext([]byte(value))
+	return nil
+}
+
+func (p jumpHostPassword) Type() string {
+	return "PASSWORD"
+}
+
+// addJumpFlags adds the jump host and proxy command flags to flags
+func addJumpFlags(flags *pflag.FlagSet, jumps *JumpHosts, prompt *bool, proxyCommand *string) {
+	flags.VarP(jumps, "jump", "J", "Connect through jump host\n(Repeat as required, in the order to connect)")
+	flags.Var(jumpHostPrivateKeys{jumps}, "jump-privatekey", "Private key file for the preceding --jump host\n(Repeat as required)")
+	flags.Var(jumpHostPassword{jumps}, "jump-password", "Password for the preceding --jump host")
+	flags.BoolVar(prompt, "jump-prompt", false, "Prompt for passwords for all --jump hosts")
+	flags.StringVar(proxyCommand, "proxy-command", "", "Connect using the output of `COMMAND`, as for SSH ProxyCommand")
+}
+
+// settings returns the jump hosts in the format used in the host
+// configuration, with any passwords encoded with keyfile. If prompt is
+// true then the user is asked for a password for each jump host.
+func (j JumpHosts) settings(keyfile *config.KeyFile, prompt bool) (jumps []interface{}, err error) {
+	for _, jump := range j {
+		m := map[string]interface{}{
+			"hostname": jump.hostname,
+		}
+		if jump.port != 0 {
+			m["port"] = jump.port
+		}
+		if jump.username != "" {
+			m["username"] = jump.username
+		}
+		if len(jump.privatekeys) > 0 {
+			m["privatekeys"] = jump.privatekeys
+		}
+
+		pw := jump.password
+		if prompt {
+			if pw, err = config.ReadPasswordInput(true, 3, "Password for jump host "+jump.hostname, "Re-enter password"); err != nil {
+				return
+			}
+		}
+		if !pw.IsNil() && pw.Size() > 0 {
+			var crc uint32
+			var created bool
+			if crc, created, err = keyfile.ReadOrCreate(host.Localhost, true); err != nil {
+				return
+			}
+			if created {
+				fmt.Printf("%s created, checksum %08X\n", keyfile, crc)
+			}
+			var password string
+			if password, err = keyfile.Encode(host.Localhost, pw, true); err != nil {
+				return
+			}
+			m["password"] = password
+		}
+		jumps = append(jumps, m)
+	}
+	return
+}
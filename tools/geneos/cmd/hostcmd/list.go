@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/spf13/cobra"
@@ -41,6 +42,8 @@ type listCmdType struct {
 	Flags     string
 	Port      int64
 	Directory string
+	Tags      map[string]string
+	Groups    []string
 }
 
 var listCmdShowHidden, listCmdJSON, listCmdIndent, listCmdCSV bool
@@ -85,12 +88,12 @@ var listCmd = &cobra.Command{
 			fmt.Println(string(b))
 		case listCmdCSV:
 			hostListCSVWriter := csv.NewWriter(os.Stdout)
-			hostListCSVWriter.Write([]string{"Name", "Username", "Hostname", "Flags", "Port", "Directory"})
+			hostListCSVWriter.Write([]string{"Name", "Username", "Hostname", "Flags", "Port", "Directory", "Tags", "Groups"})
 			err = loopHosts(hostListInstanceCSVHosts, hostListCSVWriter, listCmdShowHidden)
 			hostListCSVWriter.Flush()
 		default:
 			hostListTabWriter := tabwriter.NewWriter(os.Stdout, 3, 8, 2, ' ', 0)
-			fmt.Fprintf(hostListTabWriter, "Name\tUsername\tHostname\tFlags\tPort\tDirectory\n")
+			fmt.Fprintf(hostListTabWriter, "Name\tUsername\tHostname\tFlags\tPort\tDirectory\tTags\tGroups\n")
 			err = loopHosts(hostListInstancePlainHosts, hostListTabWriter, listCmdShowHidden)
 			hostListTabWriter.Flush()
 		}
@@ -117,7 +120,15 @@ func hostListInstancePlainHosts(h *geneos.Host, w any) (err error) {
 	if username == "" {
 		username = "-"
 	}
-	fmt.Fprintf(w.(io.Writer), "%s\t%s\t%s\t%s\t%d\t%s\n", h.GetString("name"), username, h.GetString("hostname"), flags, h.GetInt("port", config.Default(22)), h.GetString(cordial.ExecutableName()))
+	tags := h.TagsString()
+	if tags == "" {
+		tags = "-"
+	}
+	groups := strings.Join(h.Groups(), ",")
+	if groups == "" {
+		groups = "-"
+	}
+	fmt.Fprintf(w.(io.Writer), "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n", h.GetString("name"), username, h.GetString("hostname"), flags, h.GetInt("port", config.Default(22)), h.GetString(cordial.ExecutableName()), tags, groups)
 	return
 }
 
@@ -129,7 +140,7 @@ func hostListInstanceCSVHosts(h *geneos.Host, w any) (err error) {
 	username := h.GetString("username")
 
 	c := w.(*csv.Writer)
-	c.Write([]string{h.String(), username, h.GetString("hostname"), flags, fmt.Sprint(h.GetInt("port", config.Default(22))), h.GetString(cordial.ExecutableName())})
+	c.Write([]string{h.String(), username, h.GetString("hostname"), flags, fmt.Sprint(h.GetInt("port", config.Default(22))), h.GetString(cordial.ExecutableName()), h.TagsString(), strings.Join(h.Groups(), ",")})
 	return
 }
 
@@ -140,6 +151,6 @@ func hostListInstanceJSONHosts(h *geneos.Host, w any) (err error) {
 	}
 	username := h.GetString("username")
 
-	listCmdEntries = append(listCmdEntries, listCmdType{h.String(), username, h.GetString("hostname"), flags, h.GetInt64("port", config.Default(22)), h.GetString(cordial.ExecutableName())})
+	listCmdEntries = append(listCmdEntries, listCmdType{h.String(), username, h.GetString("hostname"), flags, h.GetInt64("port", config.Default(22)), h.GetString(cordial.ExecutableName()), h.Tags(), h.Groups()})
 	return
 }
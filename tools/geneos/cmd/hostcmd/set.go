@@ -20,6 +20,7 @@ package hostcmd
 import (
 	_ "embed"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -28,12 +29,18 @@ import (
 	"github.com/itrs-group/cordial/pkg/host"
 	"github.com/itrs-group/cordial/tools/geneos/cmd"
 	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+	"github.com/itrs-group/cordial/tools/geneos/internal/instance"
 )
 
 var setCmdPrompt bool
 var setCmdPassword *config.Plaintext
 var setCmdKeyfile config.KeyFile
 var setCmdPrivateKeyfiles PrivateKeyFiles
+var setCmdJumps JumpHosts
+var setCmdJumpPrompt bool
+var setCmdProxyCommand string
+var setCmdTags instance.NameValues
+var setCmdGroups []string
 
 func init() {
 	hostCmd.AddCommand(setCmd)
@@ -44,6 +51,9 @@ func init() {
 	setCmd.Flags().VarP(setCmdPassword, "password", "P", "password")
 	setCmd.Flags().VarP(&setCmdKeyfile, "keyfile", "k", "Keyfile")
 	setCmd.Flags().VarP(&setCmdPrivateKeyfiles, "privatekey", "i", "Private key file")
+	addJumpFlags(setCmd.Flags(), &setCmdJumps, &setCmdJumpPrompt, &setCmdProxyCommand)
+	setCmd.Flags().VarP(&setCmdTags, "tag", "T", "Set tag `KEY=VALUE` for host selectors\n(Repeat as required)")
+	setCmd.Flags().StringArrayVarP(&setCmdGroups, "group", "g", nil, "Add host to group `NAME` for host selectors\n(Repeat as required)")
 
 	setCmd.Flags().SortFlags = false
 }
@@ -52,9 +62,14 @@ func init() {
 var setCmdDescription string
 
 var setCmd = &cobra.Command{
-	Use:                   "set [flags] [NAME...] [KEY=VALUE...]",
-	Short:                 "Set host configuration value",
-	Long:                  setCmdDescription,
+	Use:   "set [flags] [NAME...] [KEY=VALUE...]",
+	Short: "Set host configuration value",
+	Long:  setCmdDescription,
+	Example: strings.ReplaceAll(`
+geneos host set remote1 -J admin@bastion1 -J bastion2:2222 --jump-privatekey ~/.ssh/bastion2
+geneos host set remote2 --proxy-command "ssh -W %h:%p bastion.example.com"
+geneos host set remote1 remote2 -T env=prod -T dc=ldn -g web
+`, "|", "`"),
 	SilenceUsage:          true,
 	DisableFlagsInUseLine: true,
 	Annotations: map[string]string{
@@ -101,6 +116,20 @@ var setCmd = &cobra.Command{
 			}
 		}
 
+		for _, t := range setCmdTags {
+			if k, _, ok := strings.Cut(t, "="); !ok || k == "" {
+				return fmt.Errorf("%w: tag %q must be in the form KEY=VALUE", geneos.ErrInvalidArgs, t)
+			}
+		}
+
+		// jump hosts replace any existing list
+		var jumps []interface{}
+		if len(setCmdJumps) > 0 || setCmdJumpPrompt {
+			if jumps, err = setCmdJumps.settings(&setCmdKeyfile, setCmdJumpPrompt); err != nil {
+				return
+			}
+		}
+
 		for _, h := range hosts {
 			for _, set := range params {
 				if !strings.Contains(set, "=") {
@@ -118,6 +147,29 @@ var setCmd = &cobra.Command{
 			if len(setCmdPrivateKeyfiles) > 0 {
 				h.Set("privatekeys", append(h.GetStringSlice("privatekeys"), setCmdPrivateKeyfiles...))
 			}
+
+			if len(jumps) > 0 {
+				h.Set("jumphosts", jumps)
+			}
+
+			if setCmdProxyCommand != "" {
+				h.Set("proxycommand", setCmdProxyCommand)
+			}
+
+			if len(setCmdTags) > 0 {
+				tags := h.Tags()
+				for _, t := range setCmdTags {
+					k, v, _ := strings.Cut(t, "=")
+					tags[strings.ToLower(k)] = v
+				}
+				h.Set("tags", tags)
+			}
+
+			if len(setCmdGroups) > 0 {
+				groups := append(h.Groups(), setCmdGroups...)
+				slices.Sort(groups)
+				h.Set("groups", slices.Compact(groups))
+			}
 		}
 
 		return geneos.SaveHostConfig()
@@ -34,12 +34,16 @@ import (
 var unsetCmdWarned bool
 var unsetCmdKeys instance.UnsetValues
 var unsetCmdPrivateKeyfiles PrivateKeyFiles
+var unsetCmdTags []string
+var unsetCmdGroups []string
 
 func init() {
 	hostCmd.AddCommand(unsetCmd)
 
 	unsetCmd.Flags().VarP(&unsetCmdKeys, "key", "k", "Unset configuration parameter `KEY`\n(Repeat as required)")
 	unsetCmd.Flags().VarP(&unsetCmdPrivateKeyfiles, "privatekey", "i", "Private key file")
+	unsetCmd.Flags().StringArrayVarP(&unsetCmdTags, "tag", "T", nil, "Remove tag `KEY`\n(Repeat as required)")
+	unsetCmd.Flags().StringArrayVarP(&unsetCmdGroups, "group", "g", nil, "Remove host from group `NAME`\n(Repeat as required)")
 
 	unsetCmd.Flags().SortFlags = false
 }
@@ -53,6 +57,7 @@ var unsetCmd = &cobra.Command{
 	Long:  unsetCmdDescription,
 	Example: strings.ReplaceAll(`
 geneos host unset rem2 -i /path/to/id_rsa
+geneos host unset rem2 -T dc -g web
 `, "|", "`"),
 	SilenceUsage:          true,
 	DisableFlagsInUseLine: true,
@@ -69,11 +74,14 @@ geneos host unset rem2 -i /path/to/id_rsa
 		}
 		_, args := cmd.ParseTypeNames(command)
 
-		hosts = geneos.RemoteHosts(false)
-		for _, a := range args {
-			h := geneos.GetHost(a)
-			if h.Exists() {
-				hosts = append(hosts, h)
+		if len(args) == 0 {
+			hosts = geneos.RemoteHosts(false)
+		} else {
+			for _, a := range args {
+				h := geneos.GetHost(a)
+				if h.Exists() {
+					hosts = append(hosts, h)
+				}
 			}
 		}
 		if len(hosts) == 0 {
@@ -98,6 +106,20 @@ geneos host unset rem2 -i /path/to/id_rsa
 				log.Debug().Msgf("host %s settings %#v", h, settings)
 			}
 
+			if len(unsetCmdTags) > 0 {
+				tags := h.Tags()
+				for _, k := range unsetCmdTags {
+					delete(tags, strings.ToLower(strings.SplitN(k, "=", 2)[0]))
+				}
+				h.Set("tags", tags)
+			}
+
+			if len(unsetCmdGroups) > 0 {
+				h.Set("groups", slices.DeleteFunc(h.Groups(), func(g string) bool {
+					return slices.Contains(unsetCmdGroups, g)
+				}))
+			}
+
 			if len(unsetCmdPrivateKeyfiles) > 0 {
 				keys := h.GetStringSlice("privatekeys")
 				if len(keys) == 0 {
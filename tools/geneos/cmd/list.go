@@ -31,19 +31,21 @@ import (
 )
 
 type listCmdType struct {
-	Type      string `json:"type,omitempty"`
-	Name      string `json:"name,omitempty"`
-	Host      string `json:"host,omitempty"`
-	Disabled  bool   `json:"disabled"`
-	Protected bool   `json:"protected"`
-	AutoStart bool   `json:"autostart"`
-	TLS       bool   `json:"tls"`
-	Port      int64  `json:"port,omitempty"`
-	Version   string `json:"version,omitempty"`
-	Home      string `json:"home,omitempty"`
+	Type      string            `json:"type,omitempty"`
+	Name      string            `json:"name,omitempty"`
+	Host      string            `json:"host,omitempty"`
+	Disabled  bool              `json:"disabled"`
+	Protected bool              `json:"protected"`
+	AutoStart bool              `json:"autostart"`
+	TLS       bool              `json:"tls"`
+	Port      int64             `json:"port,omitempty"`
+	Version   string            `json:"version,omitempty"`
+	Home      string            `json:"home,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
 }
 
 var listCmdJSON, listCmdCSV, listCmdIndent bool
+var listCmdLabels []string
 
 func init() {
 	GeneosCmd.AddCommand(listCmd)
@@ -51,6 +53,7 @@ func init() {
 	listCmd.PersistentFlags().BoolVarP(&listCmdJSON, "json", "j", false, "Output JSON")
 	listCmd.PersistentFlags().BoolVarP(&listCmdIndent, "pretty", "i", false, "Output indented JSON")
 	listCmd.PersistentFlags().BoolVarP(&listCmdCSV, "csv", "c", false, "Output CSV")
+	listCmd.Flags().StringSliceVarP(&listCmdLabels, "labels", "L", nil, "Show the labels `KEY,...` as extra columns")
 
 	listCmd.Flags().SortFlags = false
 }
@@ -77,11 +80,11 @@ var listCmd = &cobra.Command{
 			instance.Do(geneos.GetHost(Hostname), ct, names, listInstanceJSON).Write(os.Stdout, instance.WriterIndent(listCmdIndent))
 		case listCmdCSV:
 			listCSVWriter := csv.NewWriter(os.Stdout)
-			listCSVWriter.Write([]string{"Type", "Name", "Host", "Disabled", "Protected", "AutoStart", "TLS", "Port", "Version", "Home"})
+			listCSVWriter.Write(append([]string{"Type", "Name", "Host", "Disabled", "Protected", "AutoStart", "TLS", "Port", "Version", "Home"}, listCmdLabels...))
 			instance.Do(geneos.GetHost(Hostname), ct, names, listInstanceCSV).Write(listCSVWriter)
 		default:
 			listTabWriter := tabwriter.NewWriter(os.Stdout, 3, 8, 2, ' ', 0)
-			fmt.Fprintf(listTabWriter, "Type\tName\tHost\tFlags\tPort\tVersion\tHome\n")
+			fmt.Fprintf(listTabWriter, "Type\tName\tHost\tFlags\tPort\tVersion\tHome%s\n", labelHeadings(listCmdLabels))
 			instance.Do(geneos.GetHost(Hostname), ct, names, listInstancePlain).Write(listTabWriter)
 		}
 		if err == os.ErrNotExist {
@@ -116,6 +119,9 @@ func listInstancePlain(i geneos.Instance, _ ...any) (resp *instance.Response) {
 	}
 
 	resp.Line = fmt.Sprintf("%s\t%s\t%s\t%s\t%d\t%s:%s\t%s", i.Type(), i.Name(), i.Host(), flags, i.Config().GetInt("port"), base, underlying, i.Home())
+	for _, l := range instance.LabelColumns(i, listCmdLabels, "-") {
+		resp.Line += "\t" + l
+	}
 	return
 }
 
@@ -140,7 +146,8 @@ func listInstanceCSV(i geneos.Instance, _ ...any) (resp *instance.Response) {
 		tls = "Y"
 	}
 	base, underlying, _ := instance.Version(i)
-	resp.Rows = append(resp.Rows, []string{i.Type().String(), i.Name(), i.Host().String(), disabled, protected, autostart, tls, fmt.Sprint(i.Config().GetInt("port")), fmt.Sprintf("%s:%s", base, underlying), i.Home()})
+	row := []string{i.Type().String(), i.Name(), i.Host().String(), disabled, protected, autostart, tls, fmt.Sprint(i.Config().GetInt("port")), fmt.Sprintf("%s:%s", base, underlying), i.Home()}
+	resp.Rows = append(resp.Rows, append(row, instance.LabelColumns(i, listCmdLabels, "")...))
 	return
 }
 
@@ -159,6 +166,16 @@ func listInstanceJSON(i geneos.Instance, _ ...any) (resp *instance.Response) {
 		Port:      i.Config().GetInt64("port"),
 		Version:   fmt.Sprintf("%s:%s", base, underlying),
 		Home:      i.Home(),
+		Labels:    instance.Labels(i),
+	}
+	return
+}
+
+// labelHeadings returns the label keys as extra tab separated column
+// headings
+func labelHeadings(keys []string) (headings string) {
+	for _, k := range keys {
+		headings += "\t" + k
 	}
 	return
 }
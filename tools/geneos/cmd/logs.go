@@ -39,8 +39,10 @@ import (
 )
 
 var logCmdLines int
-var logCmdStderr, logCmdNoNormal, logCmdCALog, logCmdFollow, logCmdCat bool
+var logCmdStderr, logCmdNoNormal, logCmdCALog, logCmdFollow, logCmdCat, logCmdRotated bool
 var logCmdMatch, logCmdIgnore string
+var logCmdRegex, logCmdMerge bool
+var logCmdSince, logCmdUntil, logCmdLevel string
 
 type files struct {
 	instance geneos.Instance
@@ -57,6 +59,7 @@ func init() {
 	logsCmd.Flags().BoolVarP(&logCmdFollow, "follow", "f", false, "Follow file")
 	logsCmd.Flags().IntVarP(&logCmdLines, "lines", "n", 10, "Lines to tail")
 	logsCmd.Flags().BoolVarP(&logCmdCat, "cat", "c", false, "Output whole file")
+	logsCmd.Flags().BoolVarP(&logCmdRotated, "rotated", "R", false, "Include rotated log files, oldest first. Implies --cat")
 
 	logsCmd.Flags().BoolVarP(&logCmdStderr, "stderr", "E", false, "Show STDERR output files")
 	logsCmd.Flags().BoolVarP(&logCmdNoNormal, "no-stdout", "N", false, "Do not show STDOUT log files")
@@ -64,9 +67,18 @@ func init() {
 
 	logsCmd.Flags().StringVarP(&logCmdMatch, "match", "g", "", "Match lines with STRING")
 	logsCmd.Flags().StringVarP(&logCmdIgnore, "ignore", "v", "", "Match lines without STRING")
+	logsCmd.Flags().BoolVarP(&logCmdRegex, "regex", "x", false, "Treat --match and --ignore STRING as regular expressions")
+
+	logsCmd.Flags().StringVarP(&logCmdSince, "since", "S", "", "Only show lines logged at or after `TIME`.\nTIME can be a timestamp, a date, a time today or a duration ago, e.g. 2h")
+	logsCmd.Flags().StringVarP(&logCmdUntil, "until", "U", "", "Only show lines logged at or before `TIME`")
+	logsCmd.Flags().StringVarP(&logCmdLevel, "level", "l", "", "Only show lines with a severity of `LEVEL` or higher,\ne.g. ERROR, WARN or INFO")
+
+	logsCmd.Flags().BoolVarP(&logCmdMerge, "merge", "M", false, "Merge lines from all instances in time order,\nprefixed with the instance name")
 
 	logsCmd.MarkFlagsMutuallyExclusive("match", "ignore")
+	logsCmd.MarkFlagsMutuallyExclusive("merge", "follow")
 	logsCmd.MarkFlagsMutuallyExclusive("cat", "follow")
+	logsCmd.MarkFlagsMutuallyExclusive("rotated", "follow")
 
 	logsCmd.Flags().SortFlags = false
 
@@ -97,12 +109,24 @@ var logsCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, _ []string) (err error) {
 		ct, names := ParseTypeNames(cmd)
 
-		// if we have match or exclude with other defaults, then turn on logcat
-		if (logCmdMatch != "" || logCmdIgnore != "") && !logCmdFollow {
+		if err = setupLogFilters(); err != nil {
+			return
+		}
+
+		// if we have any filters with other defaults, then turn on logcat
+		if logFiltering() && !logCmdFollow {
+			logCmdCat = true
+		}
+
+		if logCmdRotated {
 			logCmdCat = true
 		}
 
 		switch {
+		case logCmdMerge && logCmdCat:
+			writeMergedLogs(os.Stdout, instance.Do(geneos.GetHost(Hostname), ct, names, logCatInstance))
+		case logCmdMerge:
+			writeMergedLogs(os.Stdout, instance.Do(geneos.GetHost(Hostname), ct, names, logTailInstance))
 		case logCmdCat:
 			instance.Do(geneos.GetHost(Hostname), ct, names, logCatInstance).Write(os.Stdout)
 		case logCmdFollow:
@@ -276,30 +300,20 @@ func isLineSep(r rune) bool {
 }
 
 func filterOutputStrings(i geneos.Instance, path string, r io.Reader) (lines []string) {
-	switch {
-	case logCmdMatch != "":
-		scanner := bufio.NewScanner(r)
-		for scanner.Scan() {
-			line := scanner.Text()
-			if strings.Contains(line, logCmdMatch) {
-				lines = append(lines, line)
-			}
-		}
-	case logCmdIgnore != "":
-		scanner := bufio.NewScanner(r)
-		for scanner.Scan() {
-			line := scanner.Text()
-			if !strings.Contains(line, logCmdIgnore) {
-				lines = append(lines, line)
-			}
-		}
-	default:
-		scanner := bufio.NewScanner(r)
-		for scanner.Scan() {
-			lines = append(lines, scanner.Text())
+	lf := newLogFilter()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if lf.include(line) {
+			lines = append(lines, line)
 		}
 	}
 
+	// merged output is prefixed with the instance name instead
+	if logCmdMerge {
+		return
+	}
+
 	// if we read any lines, check for header change
 	header := outHeaderString(i, path)
 	lines = append(header, lines...)
@@ -308,20 +322,12 @@ func filterOutputStrings(i geneos.Instance, path string, r io.Reader) (lines []s
 
 func filterOutput(i geneos.Instance, path string, reader io.ReadSeeker) (sz int64) {
 	switch {
-	case logCmdMatch != "":
-		scanner := bufio.NewScanner(reader)
-		for scanner.Scan() {
-			line := scanner.Text()
-			if strings.Contains(line, logCmdMatch) {
-				outHeader(i, path)
-				fmt.Println(line)
-			}
-		}
-	case logCmdIgnore != "":
+	case logFiltering():
+		lf := newLogFilter()
 		scanner := bufio.NewScanner(reader)
 		for scanner.Scan() {
 			line := scanner.Text()
-			if !strings.Contains(line, logCmdIgnore) {
+			if lf.include(line) {
 				outHeader(i, path)
 				fmt.Println(line)
 			}
@@ -371,16 +377,28 @@ func logCatInstance(i geneos.Instance, _ ...any) (resp *instance.Response) {
 }
 
 func logCatInstanceFile(i geneos.Instance, logfile string) (lines []string, err error) {
-	r, err := i.Host().Open(logfile)
+	if logCmdRotated {
+		generations := instance.LogGenerations(i, logfile)
+		for n := len(generations) - 1; n >= 0; n-- {
+			r, err := instance.OpenLog(i, generations[n])
+			if err != nil {
+				return lines, err
+			}
+			lines = append(lines, filterOutputStrings(i, generations[n], r)...)
+			r.Close()
+		}
+	}
+
+	r, err := instance.OpenLog(i, logfile)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
-			lines = []string{fmt.Sprintf("===> %s log file not found <===\n", i)}
+			lines = append(lines, fmt.Sprintf("===> %s log file not found <===\n", i))
 			return
 		}
 		return
 	}
 	defer r.Close()
-	lines = filterOutputStrings(i, logfile, r)
+	lines = append(lines, filterOutputStrings(i, logfile, r)...)
 
 	return
 }
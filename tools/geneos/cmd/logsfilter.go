@@ -0,0 +1,234 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/itrs-group/cordial/tools/geneos/internal/instance"
+)
+
+// compiled filters, set up by setupLogFilters
+var logCmdMatchRE, logCmdIgnoreRE *regexp.Regexp
+var logCmdSinceTime, logCmdUntilTime time.Time
+var logCmdMinSeverity = -1
+
+// logTimeLayouts are the timestamp formats found at the start of lines
+// in Geneos component logs, most common first
+var logTimeLayouts = []string{
+	"2006-01-02 15:04:05.000-0700", // gateway, netprobe, licd
+	"2006-01-02 15:04:05.000",
+	"2006-01-02 15:04:05,000", // java components, log4j default
+	"2006-01-02 15:04:05",
+	"Mon Jan _2 15:04:05 2006", // older components
+}
+
+// logSeverities maps severity names to a rank. Lines are shown if
+// their rank is at least that of the `--level` given.
+var logSeverities = map[string]int{
+	"TRACE":    0,
+	"DEBUG":    1,
+	"INFO":     2,
+	"NOTICE":   2,
+	"WARN":     3,
+	"WARNING":  3,
+	"ERROR":    4,
+	"CRITICAL": 5,
+	"FATAL":    5,
+}
+
+var logSeverityRE = regexp.MustCompile(`\b(TRACE|DEBUG|INFO|NOTICE|WARN|WARNING|ERROR|CRITICAL|FATAL)\b`)
+
+// setupLogFilters validates and compiles the filter flags
+func setupLogFilters() (err error) {
+	if logCmdMatch != "" {
+		if logCmdMatchRE, err = logCompile(logCmdMatch); err != nil {
+			return
+		}
+	}
+	if logCmdIgnore != "" {
+		if logCmdIgnoreRE, err = logCompile(logCmdIgnore); err != nil {
+			return
+		}
+	}
+	if logCmdSince != "" {
+		if logCmdSinceTime, err = parseLogTime(logCmdSince); err != nil {
+			return
+		}
+	}
+	if logCmdUntil != "" {
+		if logCmdUntilTime, err = parseLogTime(logCmdUntil); err != nil {
+			return
+		}
+	}
+	if logCmdLevel != "" {
+		rank, ok := logSeverities[strings.ToUpper(logCmdLevel)]
+		if !ok {
+			return fmt.Errorf("unknown severity %q, use one of TRACE, DEBUG, INFO, WARN, ERROR or FATAL", logCmdLevel)
+		}
+		logCmdMinSeverity = rank
+	}
+	return
+}
+
+func logCompile(s string) (*regexp.Regexp, error) {
+	if !logCmdRegex {
+		s = regexp.QuoteMeta(s)
+	}
+	return regexp.Compile(s)
+}
+
+// logFiltering returns true if any line filters are in use
+func logFiltering() bool {
+	return logCmdMatchRE != nil || logCmdIgnoreRE != nil || !logCmdSinceTime.IsZero() || !logCmdUntilTime.IsZero() || logCmdMinSeverity >= 0
+}
+
+// parseLogTime parses a time given on the command line. This can be
+// any of the log timestamp formats, RFC3339, a date, a time of day
+// today or a duration before now, e.g. `90m`.
+func parseLogTime(s string) (t time.Time, err error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err = time.Parse(time.RFC3339, s); err == nil {
+		return
+	}
+	for _, layout := range slices.Concat(logTimeLayouts, []string{"2006-01-02 15:04", "2006-01-02"}) {
+		if t, err = time.ParseInLocation(layout, s, time.Local); err == nil {
+			return
+		}
+	}
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if c, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			y, m, d := time.Now().Date()
+			return time.Date(y, m, d, c.Hour(), c.Minute(), c.Second(), 0, time.Local), nil
+		}
+	}
+	return t, fmt.Errorf("cannot parse time %q", s)
+}
+
+// logTimestamp returns the time at the start of line, if any
+func logTimestamp(line string) (t time.Time, ok bool) {
+	line = strings.TrimPrefix(line, "<")
+	for _, layout := range logTimeLayouts {
+		if len(line) < len(layout) {
+			continue
+		}
+		if t, err := time.ParseInLocation(layout, line[:len(layout)], time.Local); err == nil {
+			return t, true
+		}
+	}
+	if field, _, _ := strings.Cut(line, " "); len(field) > 0 && field[0] >= '0' && field[0] <= '9' {
+		if t, err := time.Parse(time.RFC3339Nano, field); err == nil {
+			return t, true
+		}
+	}
+	return
+}
+
+// logSeverity returns the rank of the first severity name found near
+// the start of line, or -1 if there is none
+func logSeverity(line string) int {
+	if len(line) > 80 {
+		line = line[:80]
+	}
+	if s := logSeverityRE.FindString(line); s != "" {
+		return logSeverities[s]
+	}
+	return -1
+}
+
+// logFilter holds the state needed to filter the lines of one log
+// file. Lines without a timestamp, such as stack traces, are treated as
+// continuations of the last line with a timestamp.
+type logFilter struct {
+	timestamp time.Time
+	severity  int
+}
+
+func newLogFilter() *logFilter {
+	return &logFilter{severity: -1}
+}
+
+// include returns true if line passes all the filters
+func (lf *logFilter) include(line string) bool {
+	if t, ok := logTimestamp(line); ok {
+		lf.timestamp = t
+		lf.severity = logSeverity(line)
+	}
+
+	if !logCmdSinceTime.IsZero() && (lf.timestamp.IsZero() || lf.timestamp.Before(logCmdSinceTime)) {
+		return false
+	}
+	if !logCmdUntilTime.IsZero() && (lf.timestamp.IsZero() || lf.timestamp.After(logCmdUntilTime)) {
+		return false
+	}
+	if logCmdMinSeverity >= 0 && lf.severity < logCmdMinSeverity {
+		return false
+	}
+
+	switch {
+	case logCmdMatchRE != nil:
+		return logCmdMatchRE.MatchString(line)
+	case logCmdIgnoreRE != nil:
+		return !logCmdIgnoreRE.MatchString(line)
+	default:
+		return true
+	}
+}
+
+// writeMergedLogs writes the lines from all responses to w sorted by
+// timestamp, each prefixed with the instance name. Lines without a
+// timestamp take the timestamp of the line before so that multi-line
+// entries stay together. Errors are written to STDERR.
+func writeMergedLogs(w io.Writer, responses instance.Responses) {
+	type entry struct {
+		timestamp time.Time
+		line      string
+	}
+	var entries []entry
+
+	for _, k := range slices.Sorted(maps.Keys(responses)) {
+		r := responses[k]
+		if r.Err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", r.Instance, r.Err)
+		}
+		var last time.Time
+		for _, line := range r.Lines {
+			if t, ok := logTimestamp(line); ok {
+				last = t
+			}
+			entries = append(entries, entry{last, r.Instance.String() + " " + strings.TrimSuffix(line, "\n")})
+		}
+	}
+
+	sort.SliceStable(entries, func(a, b int) bool {
+		return entries[a].timestamp.Before(entries[b].timestamp)
+	})
+	for _, e := range entries {
+		fmt.Fprintln(w, e.line)
+	}
+}
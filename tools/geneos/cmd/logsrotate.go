@@ -0,0 +1,76 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+	"github.com/itrs-group/cordial/tools/geneos/internal/instance"
+)
+
+var logsRotateCmdForce bool
+
+func init() {
+	logsCmd.AddCommand(logsRotateCmd)
+
+	logsRotateCmd.Flags().BoolVarP(&logsRotateCmdForce, "force", "F", false, "Rotate logs regardless of size")
+
+	logsRotateCmd.Flags().SortFlags = false
+}
+
+//go:embed _docs/logsrotate.md
+var logsRotateCmdDescription string
+
+var logsRotateCmd = &cobra.Command{
+	Use:          "rotate [flags] [TYPE] [NAME...]",
+	Short:        "Rotate Instance Logs",
+	Long:         logsRotateCmdDescription,
+	SilenceUsage: true,
+	Annotations: map[string]string{
+		CmdGlobal:        "true",
+		CmdRequireHome:   "true",
+		CmdWildcardNames: "true",
+	},
+	RunE: func(cmd *cobra.Command, _ []string) (err error) {
+		ct, names := ParseTypeNames(cmd)
+		instance.Do(geneos.GetHost(Hostname), ct, names, logsRotateInstance).Write(os.Stdout)
+		return
+	},
+}
+
+func logsRotateInstance(i geneos.Instance, _ ...any) (resp *instance.Response) {
+	resp = instance.NewResponse(i)
+
+	policy := instance.LogRotateSettings(i)
+	for _, logfile := range instance.LogFiles(i) {
+		rotated, err := instance.RotateLog(i, logfile, policy, logsRotateCmdForce)
+		if err != nil {
+			resp.Err = fmt.Errorf("%s: %w", logfile, err)
+			return
+		}
+		if rotated {
+			resp.Completed = append(resp.Completed, fmt.Sprintf("%s rotated", i.Host().HostPath(logfile)))
+		}
+	}
+	return
+}
@@ -53,6 +53,11 @@ const (
 	// CmdGlobal should be "true" if an empty list of instances should
 	// mean all instances.
 	CmdGlobal = "global"
+
+	// CmdNoSelector should be "true" if the command cannot be limited
+	// to the instances matching the `--selector` option, which is then
+	// rejected
+	CmdNoSelector = "noselector"
 )
 
 // validNameRE is the test for what is a potentially valid instance name
@@ -39,6 +39,8 @@ import (
 var installCmdLocal, installCmdNoSave, installCmdUpdate, installCmdForce, installCmdNexus, installCmdSnapshot bool
 var installCmdBase, installCmdOverride, installCmdVersion, installCmdUsername, installCmdPwFile string
 var installCmdDownloadOnly, installCmdAllTypes bool
+var installCmdChecksums, installCmdSignature, installCmdPubkey string
+var installCmdRequireChecksum bool
 var installCmdPassword *config.Plaintext
 
 func init() {
@@ -72,6 +74,11 @@ func init() {
 
 	installCmd.Flags().BoolVarP(&installCmdAllTypes, "all", "A", false, "Install all types available, not just those types already installed")
 
+	installCmd.Flags().StringVarP(&installCmdChecksums, "checksums", "C", "", "Verify archives against SHA-256 checksum manifest in `FILE|URL`.\nDefaults to configuration value in download::checksums")
+	installCmd.Flags().StringVar(&installCmdSignature, "signature", "", "Detached signature of the checksum manifest in `FILE|URL`")
+	installCmd.Flags().StringVar(&installCmdPubkey, "pubkey", "", "PEM public key to verify the signature in `FILE|URL`")
+	installCmd.Flags().BoolVar(&installCmdRequireChecksum, "verify", false, "Refuse to install archives without a checksum")
+
 	installCmd.Flags().SortFlags = false
 }
 
@@ -91,6 +98,7 @@ geneos install netprobe -b active_dev -U
 	Annotations: map[string]string{
 		cmd.CmdGlobal:      "false",
 		cmd.CmdRequireHome: "false",
+		cmd.CmdNoSelector:  "true",
 	},
 	RunE: func(command *cobra.Command, _ []string) (err error) {
 		if installCmdDownloadOnly {
@@ -151,6 +159,7 @@ geneos install netprobe -b active_dev -U
 				geneos.NoSave(true),
 				geneos.OverrideVersion(installCmdOverride),
 			}
+			options = append(options, checksumOptions()...)
 
 			var installed bool
 			// work through command line params and try to install each
@@ -254,6 +263,7 @@ geneos install netprobe -b active_dev -U
 			geneos.Username(installCmdUsername),
 			geneos.DownloadOnly(installCmdDownloadOnly),
 		}
+		options = append(options, checksumOptions()...)
 
 		if installCmdDownloadOnly {
 			archive := "."
@@ -301,7 +311,8 @@ geneos install netprobe -b active_dev -U
 			options = append(options,
 				geneos.Restart(instances...),
 				geneos.StartFunc(instance.Start),
-				geneos.StopFunc(instance.Stop))
+				geneos.StopFunc(instance.Stop),
+				geneos.HookFunc(instance.RunHook))
 		}
 
 		log.Debug().Msgf("installing %q version of %s to %s host(s)", installCmdVersion, ct, cmd.Hostname)
@@ -358,3 +369,19 @@ func Install(h *geneos.Host, ct *geneos.Component, options ...geneos.PackageOpti
 	}
 	return
 }
+
+// checksumOptions returns the package options for archive verification
+// from the command line flags. Unset flags leave the defaults from the
+// configuration.
+func checksumOptions() (options []geneos.PackageOptions) {
+	if installCmdChecksums != "" {
+		options = append(options, geneos.ChecksumManifest(installCmdChecksums))
+	}
+	if installCmdSignature != "" {
+		options = append(options, geneos.ChecksumSignature(installCmdSignature, installCmdPubkey))
+	}
+	if installCmdRequireChecksum {
+		options = append(options, geneos.RequireChecksum(true))
+	}
+	return
+}
@@ -0,0 +1,247 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkgcmd
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/itrs-group/cordial/tools/geneos/cmd"
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+	"github.com/itrs-group/cordial/tools/geneos/internal/instance"
+)
+
+var pruneCmdKeep int
+var pruneCmdDryRun, pruneCmdKeepDownloads bool
+
+func init() {
+	packageCmd.AddCommand(pruneCmd)
+
+	pruneCmd.Flags().IntVarP(&pruneCmdKeep, "keep", "k", 1, "Keep the latest `N` unused releases of each component on each host")
+	pruneCmd.Flags().BoolVarP(&pruneCmdDryRun, "dry-run", "n", false, "Only list the releases and archives that would be removed")
+	pruneCmd.Flags().BoolVarP(&pruneCmdKeepDownloads, "keep-downloads", "K", false, "Do not remove downloaded archives of removed releases")
+
+	pruneCmd.Flags().SortFlags = false
+}
+
+//go:embed _docs/prune.md
+var pruneCmdDescription string
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune [flags] [TYPE]",
+	Short: "Remove unused Geneos releases",
+	Long:  pruneCmdDescription,
+	Example: strings.ReplaceAll(`
+geneos package prune --dry-run
+geneos package prune --keep 2 gateway
+`, "|", "`"),
+	SilenceUsage: true,
+	Annotations: map[string]string{
+		cmd.CmdGlobal:      "false",
+		cmd.CmdRequireHome: "true",
+		cmd.CmdNoSelector:  "true",
+	},
+	RunE: func(command *cobra.Command, _ []string) (err error) {
+		ct, _ := cmd.ParseTypeNames(command)
+		h := geneos.GetHost(cmd.Hostname)
+
+		if pruneCmdKeep < 0 {
+			return fmt.Errorf("--keep must not be negative (%w)", geneos.ErrInvalidArgs)
+		}
+
+		verb := "removed"
+		if pruneCmdDryRun {
+			verb = "would remove"
+		}
+
+		// pruned records the releases removed, by component and then
+		// by host and version, for the archive clean-up at the end
+		pruned := map[*geneos.Component]map[string]bool{}
+
+		for h := range h.OrList() {
+			instances := instance.Instances(h, nil)
+
+			for ct := range ct.OrList() {
+				if len(ct.PackageTypes) > 0 {
+					log.Debug().Msgf("skipping %s as has related types, prune those instead", ct)
+					continue
+				}
+
+				releases, err := geneos.GetReleases(h, ct)
+				if err != nil {
+					log.Error().Err(err).Msgf("%s: cannot get %s releases", h, ct)
+					continue
+				}
+
+				used, running := pruneReferences(h, ct, instances)
+
+				// releases are sorted oldest first, walk newest first
+				// so the first unused ones are kept
+				kept := 0
+				for n := len(releases) - 1; n >= 0; n-- {
+					r := releases[n]
+					switch {
+					case len(used[r.Version]) > 0:
+						log.Debug().Msgf("%s %s on %s used by %v, keeping", ct, r.Version, h, used[r.Version])
+						continue
+					case len(r.Links) > 0:
+						log.Debug().Msgf("%s %s on %s is linked from %v, keeping", ct, r.Version, h, r.Links)
+						continue
+					case kept < pruneCmdKeep:
+						kept++
+						continue
+					}
+
+					if len(running[r.Version]) > 0 {
+						fmt.Printf("not removing %s release %s on %s, used by running instances %v\n", ct, r.Version, h, running[r.Version])
+						continue
+					}
+
+					if !pruneCmdDryRun {
+						if err = h.RemoveAll(r.Path); err != nil {
+							log.Error().Err(err).Msgf("cannot remove %s", h.HostPath(r.Path))
+							continue
+						}
+						if err = h.Remove(r.Path + geneos.ChecksumExtension); err != nil && !errors.Is(err, fs.ErrNotExist) {
+							log.Error().Err(err).Msgf("cannot remove %s", h.HostPath(r.Path+geneos.ChecksumExtension))
+						}
+					}
+					fmt.Printf("%s %s release %s from %s:%s\n", verb, ct, r.Version, h, path.Dir(r.Path))
+
+					if pruned[ct] == nil {
+						pruned[ct] = map[string]bool{}
+					}
+					pruned[ct][h.String()+":"+r.Version] = true
+				}
+			}
+		}
+
+		if !pruneCmdKeepDownloads {
+			for ct, removed := range pruned {
+				pruneArchives(ct, removed, verb)
+			}
+		}
+
+		return nil
+	},
+}
+
+// pruneReferences returns the instances on host h that use each
+// release of component ct, by version. used includes every instance
+// whose base link resolves to the release and running includes those
+// instances with a running process that was started from the release,
+// which may be different to the current base link after an update
+// without a restart.
+func pruneReferences(h *geneos.Host, ct *geneos.Component, instances []geneos.Instance) (used, running map[string][]string) {
+	used = map[string][]string{}
+	running = map[string][]string{}
+
+	basedir := h.PathTo("packages", ct.String())
+	for _, i := range instances {
+		if path.Dir(instance.BaseVersion(i)) != basedir {
+			continue
+		}
+		if _, version, err := instance.Version(i); err == nil {
+			used[version] = append(used[version], i.String())
+		} else {
+			log.Debug().Err(err).Msgf("%s: cannot resolve base version", i)
+		}
+
+		pid, err := instance.GetPID(i)
+		if err != nil {
+			continue
+		}
+		_, version, actual, err := instance.LiveVersion(i, pid)
+		if err != nil || actual == "unknown" {
+			// play safe and assume the process uses the current base
+			actual = version
+		}
+		if actual != "" {
+			running[actual] = append(running[actual], i.String())
+		}
+	}
+	return
+}
+
+// pruneArchives removes the downloaded archives for component ct that
+// match a version in removed, unless that version is still installed on
+// any configured host. removed is keyed on "HOST:VERSION".
+func pruneArchives(ct *geneos.Component, removed map[string]bool, verb string) {
+	downloads := geneos.LOCAL.PathTo("packages", "downloads")
+
+	versions := map[string]bool{}
+	for k := range removed {
+		_, version, _ := strings.Cut(k, ":")
+		versions[version] = true
+	}
+
+	// do not remove archives for versions still installed anywhere and
+	// collect the platform IDs of all hosts to find platform specific
+	// archives
+	platforms := map[string]bool{"": true}
+	for h := range geneos.ALL.OrList() {
+		platforms[h.GetString(h.Join("osinfo", "platform_id"))] = true
+		releases, err := geneos.GetReleases(h, ct)
+		if err != nil {
+			log.Debug().Err(err).Msgf("%s", h)
+			continue
+		}
+		for _, r := range releases {
+			if !removed[h.String()+":"+r.Version] {
+				delete(versions, r.Version)
+			}
+		}
+	}
+
+	archives := map[string]bool{}
+	for platform := range platforms {
+		list, err := geneos.LocalArchives(ct, geneos.LocalArchive(downloads), geneos.SetPlatformID(platform))
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				log.Error().Err(err).Msgf("cannot list archives in %s", downloads)
+			}
+			return
+		}
+		for _, a := range list {
+			archives[a] = true
+		}
+	}
+
+	for _, a := range slices.Sorted(maps.Keys(archives)) {
+		_, version, _, _, err := geneos.FilenameToComponentVersion(ct, a)
+		if err != nil || !versions[version] {
+			continue
+		}
+		if !pruneCmdDryRun {
+			if err = geneos.LOCAL.Remove(path.Join(downloads, a)); err != nil {
+				log.Error().Err(err).Msgf("cannot remove %s", a)
+				continue
+			}
+		}
+		fmt.Printf("%s %s archive %s from %s\n", verb, ct, a, downloads)
+	}
+}
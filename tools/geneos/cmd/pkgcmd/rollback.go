@@ -0,0 +1,213 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkgcmd
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/itrs-group/cordial/tools/geneos/cmd"
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+	"github.com/itrs-group/cordial/tools/geneos/internal/instance"
+)
+
+var rollbackCmdBase string
+var rollbackCmdSteps int
+var rollbackCmdRestart, rollbackCmdForce, rollbackCmdHistory, rollbackCmdJSON bool
+
+func init() {
+	packageCmd.AddCommand(rollbackCmd)
+
+	rollbackCmd.Flags().StringVarP(&rollbackCmdBase, "base", "b", "active_prod", "Base name for the symlink to roll back")
+	rollbackCmd.Flags().IntVarP(&rollbackCmdSteps, "steps", "s", 1, "Roll back `N` recorded updates")
+	rollbackCmd.Flags().BoolVarP(&rollbackCmdRestart, "restart", "R", true, "Restart all instances using the base link")
+	rollbackCmd.Flags().BoolVarP(&rollbackCmdForce, "force", "F", false, "Will also roll back and restart protected instances")
+
+	rollbackCmd.Flags().BoolVarP(&rollbackCmdHistory, "history", "l", false, "List the recorded update history and do not roll back")
+	rollbackCmd.Flags().BoolVarP(&rollbackCmdJSON, "json", "j", false, "Output history as JSON")
+
+	rollbackCmd.Flags().SortFlags = false
+}
+
+//go:embed _docs/rollback.md
+var rollbackCmdDescription string
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback [flags] [TYPE]",
+	Short: "Roll back the active version of installed Geneos packages",
+	Long:  rollbackCmdDescription,
+	Example: strings.ReplaceAll(`
+geneos package rollback gateway
+geneos package rollback netprobe -b active_dev --steps 2
+geneos package rollback --history
+`, "|", "`"),
+	SilenceUsage: true,
+	Annotations: map[string]string{
+		cmd.CmdGlobal:      "false",
+		cmd.CmdRequireHome: "true",
+		cmd.CmdNoSelector:  "true",
+	},
+	RunE: func(command *cobra.Command, _ []string) (err error) {
+		ct, _ := cmd.ParseTypeNames(command)
+		h := geneos.GetHost(cmd.Hostname)
+
+		if rollbackCmdHistory {
+			return rollbackListHistory(h, ct, command.Flags().Changed("base"))
+		}
+
+		if rollbackCmdSteps < 1 {
+			return fmt.Errorf("--steps must be at least 1 (%w)", geneos.ErrInvalidArgs)
+		}
+
+		if len(instance.Instances(h, ct, instance.FilterParameters("protected=true", "version="+rollbackCmdBase))) > 0 && !rollbackCmdForce {
+			fmt.Println("There are one or more protected instances using the current version. Use `--force` to override")
+			return
+		}
+
+		for h := range h.OrList() {
+			for ct := range ct.OrList() {
+				if len(ct.PackageTypes) > 0 {
+					// the history is recorded against the package types
+					continue
+				}
+				if err = rollback(h, ct); err != nil {
+					log.Error().Err(err).Msg("")
+				}
+			}
+		}
+		return nil
+	},
+}
+
+// rollback sets the base link for component ct on host h back to the
+// target before the last rollbackCmdSteps recorded updates
+func rollback(h *geneos.Host, ct *geneos.Component) (err error) {
+	stack, err := geneos.UpdateHistory(h, ct, rollbackCmdBase)
+	if err != nil {
+		return
+	}
+	if len(stack) == 0 {
+		log.Debug().Msgf("no update history for %s %q on %s", ct, rollbackCmdBase, h)
+		return
+	}
+	if rollbackCmdSteps > len(stack) {
+		return fmt.Errorf("%s %q on %s: only %d update(s) recorded, cannot roll back %d", ct, rollbackCmdBase, h, len(stack), rollbackCmdSteps)
+	}
+
+	last := stack[len(stack)-1]
+	target := stack[len(stack)-rollbackCmdSteps].Old
+	if target == "" {
+		return fmt.Errorf("%s %q on %s: no earlier version recorded", ct, rollbackCmdBase, h)
+	}
+
+	basedir := h.PathTo("packages", ct.String())
+	if current, err := h.Readlink(path.Join(basedir, rollbackCmdBase)); err == nil && current != last.New {
+		log.Warn().Msgf("%s %q on %s links to %s but the last recorded update was to %s", ct, rollbackCmdBase, h, current, last.New)
+	}
+	if _, err = h.Stat(path.Join(basedir, target)); err != nil {
+		return fmt.Errorf("%s release %s on %s is no longer installed: %w", ct, target, h, err)
+	}
+
+	// the hooks run for all instances using the base link, even if
+	// they are not restarted
+	affected := []geneos.Instance{}
+	for _, i := range instance.Instances(h, nil) {
+		if i.Config().GetString("version") != rollbackCmdBase {
+			continue
+		}
+		if path.Dir(instance.BaseVersion(i)) != basedir {
+			continue
+		}
+		affected = append(affected, i)
+	}
+
+	instances := []geneos.Instance{}
+	if rollbackCmdRestart {
+		instances = affected
+		log.Debug().Msgf("instances to restart: %v", instances)
+	}
+
+	return geneos.Update(h, ct,
+		geneos.Version(target),
+		geneos.Basename(rollbackCmdBase),
+		geneos.Force(true),
+		geneos.Rollback(rollbackCmdSteps),
+		geneos.Affected(affected...),
+		geneos.Restart(instances...),
+		geneos.StartFunc(instance.Start),
+		geneos.StopFunc(instance.Stop),
+		geneos.HookFunc(instance.RunHook))
+}
+
+type rollbackHistory struct {
+	Host string `json:"host"`
+	geneos.UpdateRecord
+}
+
+// rollbackListHistory writes the recorded update history for all
+// matching hosts and components, oldest first. If filterBase is true
+// then only changes to rollbackCmdBase are included.
+func rollbackListHistory(h *geneos.Host, ct *geneos.Component, filterBase bool) (err error) {
+	var history []rollbackHistory
+	for h := range h.OrList() {
+		records, err := geneos.ReadHistory(h)
+		if err != nil {
+			log.Error().Err(err).Msgf("%s", h)
+			continue
+		}
+		for _, r := range records {
+			if ct != nil && r.Component != ct.String() {
+				continue
+			}
+			if filterBase && r.Base != rollbackCmdBase {
+				continue
+			}
+			history = append(history, rollbackHistory{h.String(), r})
+		}
+	}
+
+	if rollbackCmdJSON {
+		var b []byte
+		if b, err = json.MarshalIndent(history, "", "    "); err != nil {
+			return
+		}
+		fmt.Println(string(b))
+		return
+	}
+
+	historyTabWriter := tabwriter.NewWriter(os.Stdout, 3, 8, 2, ' ', 0)
+	fmt.Fprintf(historyTabWriter, "Time\tHost\tComponent\tBase\tOld\tNew\tUser\tRestarted\n")
+	for _, r := range history {
+		newVersion := r.New
+		if r.Undo > 0 {
+			newVersion += fmt.Sprintf(" (rollback %d)", r.Undo)
+		}
+		fmt.Fprintf(historyTabWriter, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.Time.Local().Format(time.RFC3339), r.Host, r.Component, r.Base, r.Old, newVersion, r.User, strings.Join(r.Restarted, ", "))
+	}
+	return historyTabWriter.Flush()
+}
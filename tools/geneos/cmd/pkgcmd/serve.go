@@ -0,0 +1,210 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkgcmd
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/itrs-group/cordial"
+	"github.com/itrs-group/cordial/pkg/config"
+	"github.com/itrs-group/cordial/tools/geneos/cmd"
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+)
+
+var serveCmdListen, serveCmdDir, serveCmdCert, serveCmdKey, serveCmdAuth string
+
+func init() {
+	packageCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVarP(&serveCmdListen, "listen", "l", ":9721", "Listen on `[ADDR]:PORT`")
+	serveCmd.Flags().StringVar(&serveCmdDir, "dir", "", "Serve release archives from `DIR`. Default is `packages/downloads`")
+	serveCmd.Flags().StringVar(&serveCmdCert, "cert", "", "Serve HTTPS using the PEM certificate in `FILE`")
+	serveCmd.Flags().StringVar(&serveCmdKey, "key", "", "Private key `FILE` for the certificate given with --cert")
+	serveCmd.MarkFlagsRequiredTogether("cert", "key")
+	serveCmd.Flags().StringVarP(&serveCmdAuth, "auth", "a", "", "Require clients to authenticate with the\nusername and password stored for `DOMAIN`")
+
+	serveCmd.Flags().SortFlags = false
+}
+
+//go:embed _docs/serve.md
+var serveCmdDescription string
+
+var serveCmd = &cobra.Command{
+	Use:          "serve [flags]",
+	Short:        "Serve release archives to other hosts",
+	Long:         serveCmdDescription,
+	SilenceUsage: true,
+	Annotations: map[string]string{
+		cmd.CmdGlobal:      "false",
+		cmd.CmdRequireHome: "true",
+	},
+	RunE: func(command *cobra.Command, _ []string) (err error) {
+		dir := serveCmdDir
+		if dir == "" {
+			dir = path.Join(geneos.LocalRoot(), "packages", "downloads")
+		}
+		if st, err := os.Stat(dir); err != nil || !st.IsDir() {
+			return fmt.Errorf("%s: not a directory (%w)", dir, fs.ErrNotExist)
+		}
+
+		var creds *config.Config
+		if serveCmdAuth != "" {
+			creds = config.FindCreds(serveCmdAuth, config.SetAppName(cordial.ExecutableName()))
+			if creds == nil || creds.GetString("username") == "" {
+				return fmt.Errorf("no credentials found for %q, use `geneos login %s` to add them", serveCmdAuth, serveCmdAuth)
+			}
+		}
+
+		server := &http.Server{
+			Addr:              serveCmdListen,
+			Handler:           serveHandler(dir, creds),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			server.Shutdown(shutdown)
+		}()
+
+		if serveCmdCert != "" {
+			log.Info().Msgf("serving %s on https://%s/", dir, serveCmdListen)
+			err = server.ListenAndServeTLS(serveCmdCert, serveCmdKey)
+		} else {
+			log.Info().Msgf("serving %s on http://%s/", dir, serveCmdListen)
+			err = server.ListenAndServe()
+		}
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		return
+	},
+}
+
+// serveAuth is the JSON body POSTed by clients to authenticate, as for
+// the default download site
+type serveAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// serveHandler returns an http.Handler that serves release archives
+// from dir. The last element of the request path is either the name of
+// a file in dir, such as an archive or the checksum manifest, or one
+// of the download base paths for a component, in which case the
+// archive is selected using the query parameters in the same way as
+// the default download site.
+//
+// If creds is not nil then clients must authenticate with its username
+// and password, either using basic authentication or by POSTing them
+// as JSON in the same way as for the default download site.
+func serveHandler(dir string, creds *config.Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodPost {
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		if creds != nil && !serveAuthorized(r, creds) {
+			log.Debug().Msgf("%s %s: unauthorised", r.RemoteAddr, r.URL)
+			w.Header().Set("WWW-Authenticate", `Basic realm="geneos"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		base := path.Base(r.URL.Path)
+		filename := ""
+
+		if name, err := geneos.CleanRelativePath(base); err == nil && name != "." && name != ".." && name != "/" {
+			if st, err := os.Stat(path.Join(dir, name)); err == nil && st.Mode().IsRegular() {
+				filename = name
+			}
+		}
+
+		if filename == "" {
+			ct := geneos.DownloadBaseComponent(base)
+			if ct == nil {
+				log.Debug().Msgf("%s %s: unknown download base %q", r.RemoteAddr, r.URL, base)
+				http.NotFound(w, r)
+				return
+			}
+			var err error
+			if filename, err = geneos.MirrorArchive(ct, dir, r.URL.Query()); err != nil {
+				log.Debug().Err(err).Msgf("%s %s", r.RemoteAddr, r.URL)
+				http.NotFound(w, r)
+				return
+			}
+		}
+
+		f, err := os.Open(path.Join(dir, filename))
+		if err != nil {
+			log.Error().Err(err).Msgf("%s %s", r.RemoteAddr, r.URL)
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+		st, err := f.Stat()
+		if err != nil {
+			log.Error().Err(err).Msgf("%s %s", r.RemoteAddr, r.URL)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		log.Info().Msgf("%s %s: serving %s", r.RemoteAddr, r.URL, filename)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+		http.ServeContent(w, r, filename, st.ModTime(), f)
+	})
+}
+
+// serveAuthorized returns true if the request carries the username and
+// password in creds
+func serveAuthorized(r *http.Request, creds *config.Config) bool {
+	username, password, ok := r.BasicAuth()
+	if !ok && r.Method == http.MethodPost {
+		var auth serveAuth
+		if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 4096)).Decode(&auth); err == nil {
+			username, password, ok = auth.Username, auth.Password, true
+		}
+	}
+	if !ok {
+		return false
+	}
+	u := subtle.ConstantTimeCompare([]byte(username), []byte(creds.GetString("username")))
+	p := subtle.ConstantTimeCompare([]byte(password), creds.GetPassword("password").Bytes())
+	return u&p == 1
+}
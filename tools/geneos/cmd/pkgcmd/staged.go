@@ -0,0 +1,258 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkgcmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/itrs-group/cordial/tools/geneos/cmd"
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+	"github.com/itrs-group/cordial/tools/geneos/internal/instance"
+)
+
+// stage is one step of a staged update. If only is not nil for a host
+// then only those instances are restarted on that host, otherwise all
+// instances using the base link are.
+type stage struct {
+	name  string
+	hosts []*geneos.Host
+	only  map[*geneos.Host][]geneos.Instance
+}
+
+// stagedUpdate updates the base link for component ct to version on the
+// hosts selected by h in stages. Any canary hosts and instances given
+// with `--canary` are updated first, followed by the other hosts in
+// batches of `--batch` hosts. After each stage the restarted instances
+// are health checked for the soak period and if any check fails then
+// the update halts.
+func stagedUpdate(h *geneos.Host, ct *geneos.Component, version string) (err error) {
+	hosts := slices.Collect(h.OrList())
+
+	canary, err := canaryStage(hosts)
+	if err != nil {
+		return
+	}
+
+	stages := []stage{}
+	if len(canary.hosts) > 0 {
+		stages = append(stages, canary)
+	}
+
+	// hosts not in the canary stage, plus canary hosts where only some
+	// instances were restarted, which have the others restarted with
+	// the first batch
+	var remaining []*geneos.Host
+	deferred := map[*geneos.Host][]geneos.Instance{}
+	for _, h := range hosts {
+		if !slices.Contains(canary.hosts, h) {
+			remaining = append(remaining, h)
+			continue
+		}
+		if only, ok := canary.only[h]; ok {
+			for _, i := range updateInstances(h, ct) {
+				if !containsInstance(only, i) {
+					deferred[h] = append(deferred[h], i)
+				}
+			}
+		}
+	}
+
+	size := updateCmdBatch
+	if size <= 0 {
+		size = max(len(remaining), 1)
+	}
+	for n, batch := range slices.Collect(slices.Chunk(remaining, size)) {
+		stages = append(stages, stage{name: fmt.Sprintf("batch %d", n+1), hosts: batch})
+	}
+	if len(deferred) > 0 {
+		if len(stages) == 1 {
+			stages = append(stages, stage{name: "batch 1"})
+		}
+		first := &stages[1]
+		first.only = map[*geneos.Host][]geneos.Instance{}
+		for _, h := range hosts {
+			if instances, ok := deferred[h]; ok {
+				first.hosts = append(first.hosts, h)
+				first.only[h] = instances
+			}
+		}
+	}
+
+	var done []string
+	for _, s := range stages {
+		fmt.Printf("%s: updating %s on %s\n", s.name, ct, hostNames(s.hosts))
+
+		since := time.Now()
+		var check []geneos.Instance
+		for _, h := range s.hosts {
+			instances := updateInstances(h, ct)
+			if only, ok := s.only[h]; ok {
+				instances = slices.DeleteFunc(instances, func(i geneos.Instance) bool { return !containsInstance(only, i) })
+			}
+			for _, i := range instances {
+				if instance.IsRunning(i) {
+					check = append(check, i)
+				}
+			}
+
+			if err = geneos.Update(h, ct,
+				geneos.Version(version),
+				geneos.Basename(updateCmdBase),
+				geneos.Force(true),
+				geneos.Affected(baseInstances(h, ct)...),
+				geneos.Restart(instances...),
+				geneos.StartFunc(instance.Start),
+				geneos.StopFunc(instance.Stop),
+				geneos.HookFunc(instance.RunHook)); err != nil {
+				return stagedHalt(s, done, err)
+			}
+
+			// the base link on a canary host has already been updated,
+			// so Update does not restart the instances deferred to the
+			// first batch
+			if _, ok := deferred[h]; ok && s.name != canary.name {
+				for _, i := range instances {
+					if !instance.IsRunning(i) {
+						continue
+					}
+					if err = instance.Stop(i, updateCmdForce, false); err != nil {
+						return stagedHalt(s, done, err)
+					}
+					if err = instance.Start(i); err != nil {
+						return stagedHalt(s, done, err)
+					}
+				}
+			}
+		}
+
+		if err = soak(check, since); err != nil {
+			return stagedHalt(s, done, err)
+		}
+		done = append(done, s.name)
+	}
+	fmt.Printf("staged update of %s complete\n", ct)
+	return
+}
+
+// canaryStage returns the canary stage from the names given with
+// `--canary`. Each name is either a host or an instance in the form
+// `[TYPE:]NAME[@HOST]`. Instances only restart themselves on their
+// host, others using the same base link are restarted with the first
+// batch.
+func canaryStage(hosts []*geneos.Host) (s stage, err error) {
+	s = stage{name: "canary", only: map[*geneos.Host][]geneos.Instance{}}
+	all := map[*geneos.Host]bool{}
+
+	for _, name := range updateCmdCanary {
+		if h := geneos.GetHost(name); !strings.ContainsAny(name, ":@") && h.Exists() {
+			if !slices.Contains(hosts, h) {
+				return s, fmt.Errorf("canary host %q is not one of the selected hosts (%w)", name, geneos.ErrInvalidArgs)
+			}
+			all[h] = true
+			if !slices.Contains(s.hosts, h) {
+				s.hosts = append(s.hosts, h)
+			}
+			continue
+		}
+
+		ict, _, ih := instance.SplitName(name, geneos.ALL)
+		instances := instance.Instances(ih, ict, instance.FilterNames(name))
+		if len(instances) == 0 {
+			return s, fmt.Errorf("canary %q is neither a host nor an instance (%w)", name, geneos.ErrInvalidArgs)
+		}
+		for _, i := range instances {
+			h := i.Host()
+			if !slices.Contains(hosts, h) {
+				return s, fmt.Errorf("canary instance %s is not on one of the selected hosts (%w)", i, geneos.ErrInvalidArgs)
+			}
+			s.only[h] = append(s.only[h], i)
+			if !slices.Contains(s.hosts, h) {
+				s.hosts = append(s.hosts, h)
+			}
+		}
+	}
+
+	// a host named in full overrides instances on the same host
+	for h := range all {
+		delete(s.only, h)
+	}
+	return
+}
+
+// soak runs health checks against instances every `--interval` until
+// the `--soak` period has passed, returning an error describing the
+// failures as soon as any check fails. Log errors are only counted if
+// they are after since.
+func soak(instances []geneos.Instance, since time.Time) error {
+	if len(instances) == 0 {
+		fmt.Println("no running instances to health check")
+		return nil
+	}
+
+	fmt.Printf("health checking %d instance(s) for %s\n", len(instances), updateCmdSoak)
+	deadline := time.Now().Add(updateCmdSoak)
+	for {
+		wait := min(updateCmdInterval, time.Until(deadline))
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+
+		var failures []string
+		for _, i := range instances {
+			failures = append(failures, cmd.HealthCheck(i, since)...)
+		}
+		if len(failures) > 0 {
+			return fmt.Errorf("health checks failed:\n\t%s", strings.Join(failures, "\n\t"))
+		}
+		log.Debug().Msgf("%d instance(s) healthy", len(instances))
+
+		if !time.Now().Before(deadline) {
+			return nil
+		}
+	}
+}
+
+// stagedHalt returns an error for a staged update that failed in stage
+// s after the stages in done completed
+func stagedHalt(s stage, done []string, err error) error {
+	completed := "none"
+	if len(done) > 0 {
+		completed = strings.Join(done, ", ")
+	}
+	return fmt.Errorf("staged update halted in %s on %s (completed stages: %s), use `geneos package rollback` to revert updated hosts: %w",
+		s.name, hostNames(s.hosts), completed, err)
+}
+
+// containsInstance returns true if instances includes one with the
+// same full name as i
+func containsInstance(instances []geneos.Instance, i geneos.Instance) bool {
+	return slices.ContainsFunc(instances, func(c geneos.Instance) bool { return c.String() == i.String() })
+}
+
+func hostNames(hosts []*geneos.Host) string {
+	names := []string{}
+	for _, h := range hosts {
+		names = append(names, h.String())
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,54 @@
+package pkgcmd
+
+import (
+	"path"
+	"testing"
+
+	"github.com/itrs-group/cordial"
+	"github.com/itrs-group/cordial/pkg/host"
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+)
+
+func TestStagedUpdateHalts(t *testing.T) {
+	ct := &geneos.Component{Name: "stagetest"}
+	for _, name := range []string{"stage1", "stage2"} {
+		h := geneos.NewHost(name, host.NewMemory(name))
+		defer h.Delete()
+		h.Valid()
+		h.Set(cordial.ExecutableName(), "/opt/geneos")
+		h.Set("groups", []string{"stagetest"})
+
+		basedir := h.PathTo("packages", ct.String())
+		for _, v := range []string{"1.0.0", "2.0.0"} {
+			if err := h.MkdirAll(path.Join(basedir, v), 0775); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if name == "stage1" {
+			// a non-empty directory in place of the base link cannot
+			// be removed, so the update on this host fails
+			if err := h.MkdirAll(path.Join(basedir, "active_prod", "dir"), 0775); err != nil {
+				t.Fatal(err)
+			}
+		} else if err := h.Symlink("1.0.0", path.Join(basedir, "active_prod")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := geneos.SelectHosts("@stagetest"); err != nil {
+		t.Fatal(err)
+	}
+	defer geneos.SelectHosts("")
+
+	updateCmdBase, updateCmdBatch, updateCmdRestart = "active_prod", 1, false
+	defer func() { updateCmdBatch, updateCmdRestart = 0, true }()
+
+	if err := stagedUpdate(geneos.ALL, ct, "2.0.0"); err == nil {
+		t.Fatal("stagedUpdate succeeded with a failing first stage")
+	}
+
+	h := geneos.GetHost("stage2")
+	if link, err := h.Readlink(h.PathTo("packages", ct.String(), "active_prod")); err != nil || link != "1.0.0" {
+		t.Errorf("second stage host updated after first stage failed, base link is %q, %v", link, err)
+	}
+}
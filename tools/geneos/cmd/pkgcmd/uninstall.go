@@ -67,6 +67,7 @@ geneos uninstall --version 5.14.1
 	Annotations: map[string]string{
 		cmd.CmdGlobal:      "false",
 		cmd.CmdRequireHome: "true",
+		cmd.CmdNoSelector:  "true",
 	},
 	RunE: func(command *cobra.Command, _ []string) (err error) {
 		ct, args := cmd.ParseTypeNames(command)
@@ -185,11 +186,16 @@ geneos uninstall --version 5.14.1
 						instance.Stop(c, true, false)
 						stopped = append(stopped, c)
 					}
-					// remove the release
-					if err = h.RemoveAll(path.Join(basedir, release.Version)); err != nil {
+					// remove the release and the checksums recorded when
+					// it was installed
+					releasedir := path.Join(basedir, release.Version)
+					if err = h.RemoveAll(releasedir); err != nil {
 						log.Error().Err(err).Msg("")
 						continue
 					}
+					if err := h.Remove(releasedir + geneos.ChecksumExtension); err != nil && !errors.Is(err, fs.ErrNotExist) {
+						log.Error().Err(err).Msgf("cannot remove %s", h.HostPath(releasedir+geneos.ChecksumExtension))
+					}
 					fmt.Printf("removed %s release %s from %s:%s\n", ct, release.Version, h, basedir)
 
 					if len(release.Links) != 0 {
@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"io/fs"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
@@ -34,6 +35,9 @@ import (
 
 var updateCmdBase, updateCmdVersion string
 var updateCmdForce, updateCmdRestart, updateCmdInstall bool
+var updateCmdCanary []string
+var updateCmdBatch int
+var updateCmdSoak, updateCmdInterval time.Duration
 
 func init() {
 	packageCmd.AddCommand(updateCmd)
@@ -48,6 +52,11 @@ func init() {
 
 	updateCmd.Flags().BoolVarP(&updateCmdForce, "force", "F", false, "Will also update and restart protected instances")
 
+	updateCmd.Flags().StringSliceVarP(&updateCmdCanary, "canary", "C", []string{}, "Staged update, starting with canary `HOST`s or instances, comma separated")
+	updateCmd.Flags().IntVarP(&updateCmdBatch, "batch", "N", 0, "Staged update, updating `N` hosts at a time after any canaries")
+	updateCmd.Flags().DurationVar(&updateCmdSoak, "soak", 5*time.Minute, "Staged update, health check period after each stage")
+	updateCmd.Flags().DurationVar(&updateCmdInterval, "interval", 30*time.Second, "Staged update, interval between health checks")
+
 	updateCmd.Flags().SortFlags = false
 }
 
@@ -63,11 +72,13 @@ geneos package update gateway -b active_prod
 geneos package update gateway -b active_dev -V 5.11
 geneos package update
 geneos package update netprobe --version 5.13.2
+geneos package update gateway --canary uat1,gateway:ldn1@prod1 --batch 5
 `, "|", "`"),
 	SilenceUsage: true,
 	Annotations: map[string]string{
 		cmd.CmdGlobal:      "false",
 		cmd.CmdRequireHome: "true",
+		cmd.CmdNoSelector:  "true",
 	},
 	Args: cobra.RangeArgs(0, 2),
 	RunE: func(command *cobra.Command, _ []string) (err error) {
@@ -113,31 +124,46 @@ geneos package update netprobe --version 5.13.2
 			version = args[0]
 		}
 
-		instances := []geneos.Instance{}
-		if updateCmdRestart {
-			for ct := range ct.OrList() {
-				for _, i := range instance.Instances(h, ct) {
-					if i.Config().GetString("version") != updateCmdBase {
-						log.Debug().Msgf("%s base different", i)
-						continue
-					}
-					pkg := i.Config().GetString("pkgtype")
-					if pkg != "" && pkg == ct.String() {
-						instances = append(instances, i)
-						continue
-					}
-					instances = append(instances, i)
-				}
-			}
-			log.Debug().Msgf("instances to restart: %v", instances)
+		if len(updateCmdCanary) > 0 || updateCmdBatch > 0 {
+			return stagedUpdate(h, ct, version)
 		}
 
+		instances := updateInstances(h, ct)
+		log.Debug().Msgf("instances to restart: %v", instances)
+
 		return geneos.Update(h, ct,
 			geneos.Version(version),
 			geneos.Basename(updateCmdBase),
 			geneos.Force(true),
+			geneos.Affected(baseInstances(h, ct)...),
 			geneos.Restart(instances...),
 			geneos.StartFunc(instance.Start),
-			geneos.StopFunc(instance.Stop))
+			geneos.StopFunc(instance.Stop),
+			geneos.HookFunc(instance.RunHook))
 	},
 }
+
+// updateInstances returns the instances on host h of component type ct
+// that use the base link being updated and so should be restarted, or
+// nil if restarts are disabled
+func updateInstances(h *geneos.Host, ct *geneos.Component) (instances []geneos.Instance) {
+	if !updateCmdRestart {
+		return
+	}
+	return baseInstances(h, ct)
+}
+
+// baseInstances returns the instances on host h of component type ct
+// that use the base link being updated, for the update hooks
+func baseInstances(h *geneos.Host, ct *geneos.Component) (instances []geneos.Instance) {
+	for ct := range ct.OrList() {
+		for _, i := range instance.Instances(h, ct) {
+			if i.Config().GetString("version") != updateCmdBase {
+				log.Debug().Msgf("%s base different", i)
+				continue
+			}
+			instances = append(instances, i)
+		}
+	}
+	return
+}
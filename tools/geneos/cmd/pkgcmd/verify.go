@@ -0,0 +1,240 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkgcmd
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/itrs-group/cordial/tools/geneos/cmd"
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+)
+
+var verifyCmdArchivesOnly, verifyCmdInstalledOnly, verifyCmdJSON, verifyCmdIndent bool
+var verifyCmdArchives, verifyCmdChecksums, verifyCmdSignature, verifyCmdPubkey string
+
+func init() {
+	packageCmd.AddCommand(verifyCmd)
+
+	verifyCmd.Flags().BoolVarP(&verifyCmdArchivesOnly, "archives", "a", false, "Only verify downloaded archives")
+	verifyCmd.Flags().BoolVarP(&verifyCmdInstalledOnly, "installed", "I", false, "Only verify installed releases")
+	verifyCmd.MarkFlagsMutuallyExclusive("archives", "installed")
+
+	verifyCmd.Flags().StringVar(&verifyCmdArchives, "dir", "", "Archive `DIR`ectory to verify. Default is `packages/downloads`")
+	verifyCmd.Flags().StringVarP(&verifyCmdChecksums, "checksums", "C", "", "Verify archives against checksum manifest in `FILE|URL`")
+	verifyCmd.Flags().StringVar(&verifyCmdSignature, "signature", "", "Detached signature of the checksum manifest in `FILE|URL`")
+	verifyCmd.Flags().StringVar(&verifyCmdPubkey, "pubkey", "", "PEM public key to verify the signature in `FILE|URL`")
+
+	verifyCmd.Flags().BoolVarP(&verifyCmdJSON, "json", "j", false, "Output JSON")
+	verifyCmd.Flags().BoolVarP(&verifyCmdIndent, "pretty", "i", false, "Output indented JSON")
+
+	verifyCmd.Flags().SortFlags = false
+}
+
+//go:embed _docs/verify.md
+var verifyCmdDescription string
+
+var verifyCmd = &cobra.Command{
+	Use:          "verify [flags] [TYPE]",
+	Short:        "Verify release archives and installed releases",
+	Long:         verifyCmdDescription,
+	SilenceUsage: true,
+	Annotations: map[string]string{
+		cmd.CmdGlobal:      "false",
+		cmd.CmdRequireHome: "true",
+	},
+	RunE: func(command *cobra.Command, _ []string) (err error) {
+		ct, _ := cmd.ParseTypeNames(command)
+		h := geneos.GetHost(cmd.Hostname)
+
+		results := []verifyResult{}
+
+		if !verifyCmdInstalledOnly {
+			r, err := verifyArchives(ct)
+			if err != nil {
+				return err
+			}
+			results = append(results, r...)
+		}
+
+		if !verifyCmdArchivesOnly {
+			for h := range h.OrList() {
+				for ct := range ct.OrList() {
+					releases, err := geneos.GetReleases(h, ct)
+					if err != nil {
+						return err
+					}
+					for _, r := range releases {
+						results = append(results, verifyRelease(h, ct, r))
+					}
+				}
+			}
+		}
+
+		switch {
+		case verifyCmdJSON, verifyCmdIndent:
+			var b []byte
+			if verifyCmdIndent {
+				b, err = json.MarshalIndent(results, "", "    ")
+			} else {
+				b, err = json.Marshal(results)
+			}
+			if err != nil {
+				return
+			}
+			fmt.Println(string(b))
+		default:
+			verifyTabWriter := tabwriter.NewWriter(os.Stdout, 3, 8, 2, ' ', 0)
+			fmt.Fprintf(verifyTabWriter, "Component\tHost\tRelease\tResult\tDetail\n")
+			for _, r := range results {
+				fmt.Fprintf(verifyTabWriter, "%s\t%s\t%s\t%s\t%s\n", r.Component, r.Host, r.Release, r.Result, r.Detail)
+			}
+			verifyTabWriter.Flush()
+		}
+
+		var failed int
+		for _, r := range results {
+			if r.Result == verifyFailed {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d archive(s) or release(s) failed verification", failed)
+		}
+		return
+	},
+}
+
+const (
+	verifyOK      = "ok"
+	verifyFailed  = "FAILED"
+	verifyUnknown = "no checksums"
+)
+
+type verifyResult struct {
+	Component string `json:"component,omitempty"`
+	Host      string `json:"host"`
+	Release   string `json:"release"`
+	Result    string `json:"result"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// verifyArchives checks the local archives, limited to those for
+// component ct if not nil
+func verifyArchives(ct *geneos.Component) (results []verifyResult, err error) {
+	dir := verifyCmdArchives
+	if dir == "" {
+		dir = path.Join(geneos.LocalRoot(), "packages", "downloads")
+	}
+
+	options := []geneos.PackageOptions{}
+	if verifyCmdChecksums != "" {
+		options = append(options, geneos.ChecksumManifest(verifyCmdChecksums))
+	}
+	if verifyCmdSignature != "" {
+		options = append(options, geneos.ChecksumSignature(verifyCmdSignature, verifyCmdPubkey))
+	}
+
+	checked, err := geneos.VerifyArchives(dir, options...)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		return
+	}
+
+	var wanted []string
+	if ct != nil {
+		if wanted, err = geneos.LocalArchives(ct, geneos.LocalArchive(dir)); err != nil {
+			return
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(checked)) {
+		if ct != nil && !slices.Contains(wanted, name) {
+			continue
+		}
+		r := verifyResult{
+			Host:    geneos.LOCALHOST,
+			Release: path.Join(dir, name),
+			Result:  verifyOK,
+		}
+		if nct, _, _, _, err := geneos.FilenameToComponentVersion(ct, name); err == nil && nct != nil {
+			r.Component = nct.String()
+		}
+		switch err := checked[name]; {
+		case err == nil:
+		case errors.Is(err, geneos.ErrNoChecksum):
+			r.Result = verifyUnknown
+		default:
+			r.Result = verifyFailed
+			r.Detail = err.Error()
+		}
+		results = append(results, r)
+	}
+	return
+}
+
+// verifyRelease checks an installed release against the checksums
+// recorded when it was unpacked
+func verifyRelease(h *geneos.Host, ct *geneos.Component, release geneos.ReleaseDetails) (r verifyResult) {
+	r = verifyResult{
+		Component: ct.String(),
+		Host:      h.String(),
+		Release:   release.Version,
+		Result:    verifyOK,
+	}
+	changed, missing, err := geneos.VerifyRelease(h, release.Path)
+	switch {
+	case errors.Is(err, geneos.ErrNoChecksum):
+		r.Result = verifyUnknown
+		r.Detail = "installed before checksums were recorded"
+	case err != nil:
+		r.Result = verifyFailed
+		r.Detail = err.Error()
+	case len(changed) > 0 || len(missing) > 0:
+		r.Result = verifyFailed
+		var details []string
+		if len(changed) > 0 {
+			details = append(details, fmt.Sprintf("%d changed (%s)", len(changed), verifyExamples(changed)))
+		}
+		if len(missing) > 0 {
+			details = append(details, fmt.Sprintf("%d missing (%s)", len(missing), verifyExamples(missing)))
+		}
+		r.Detail = strings.Join(details, ", ")
+	}
+	return
+}
+
+// verifyExamples returns up to the first three file names in files
+func verifyExamples(files []string) string {
+	if len(files) > 3 {
+		return strings.Join(files[:3], ", ") + ", ..."
+	}
+	return strings.Join(files, ", ")
+}
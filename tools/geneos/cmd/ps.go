@@ -37,20 +37,23 @@ import (
 )
 
 type psType struct {
-	Type      string `json:"type,omitempty"`
-	Name      string `json:"name,omitempty"`
-	Host      string `json:"host,omitempty"`
-	PID       string `json:"pid,omitempty"`
-	Ports     []int  `json:"ports,omitempty"`
-	User      string `json:"user,omitempty"`
-	Group     string `json:"group,omitempty"`
-	Starttime string `json:"starttime,omitempty"`
-	Version   string `json:"version,omitempty"`
-	Home      string `json:"home,omitempty"`
+	Type      string            `json:"type,omitempty"`
+	Name      string            `json:"name,omitempty"`
+	Host      string            `json:"host,omitempty"`
+	PID       string            `json:"pid,omitempty"`
+	Ports     []int             `json:"ports,omitempty"`
+	User      string            `json:"user,omitempty"`
+	Group     string            `json:"group,omitempty"`
+	Starttime string            `json:"starttime,omitempty"`
+	Version   string            `json:"version,omitempty"`
+	Home      string            `json:"home,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Limits    *instance.Limits  `json:"limits,omitempty"`
 	// Live      bool   `json:"live,omitempty"`
 }
 
 var psCmdLong, psCmdShowFiles, psCmdJSON, psCmdIndent, psCmdCSV, psCmdNoLookups bool
+var psCmdLabels []string
 
 func init() {
 	GeneosCmd.AddCommand(psCmd)
@@ -58,8 +61,9 @@ func init() {
 	psCmd.Flags().BoolVarP(&psCmdShowFiles, "files", "f", false, "Show open files")
 	psCmd.Flags().MarkHidden("files")
 
-	psCmd.Flags().BoolVarP(&psCmdLong, "long", "l", false, "Show more output (remote ports etc.)")
+	psCmd.Flags().BoolVarP(&psCmdLong, "long", "l", false, "Show more output (remote ports, resource limits etc.)")
 	psCmd.Flags().BoolVarP(&psCmdNoLookups, "nolookup", "n", false, "No lookups for user/groups")
+	psCmd.Flags().StringSliceVarP(&psCmdLabels, "labels", "L", nil, "Show the labels `KEY,...` as extra columns")
 
 	psCmd.Flags().BoolVarP(&psCmdJSON, "json", "j", false, "Output JSON")
 	psCmd.Flags().BoolVarP(&psCmdIndent, "pretty", "i", false, "Output indented JSON")
@@ -98,11 +102,19 @@ func CommandPS(ct *geneos.Component, names []string, params []string) {
 		instance.Do(geneos.GetHost(Hostname), ct, names, psInstanceJSON).Write(os.Stdout, instance.WriterIndent(psCmdIndent))
 	case psCmdCSV:
 		psCSVWriter := csv.NewWriter(os.Stdout)
-		psCSVWriter.Write([]string{"Type", "Name", "Host", "PID", "Ports", "User", "Group", "Starttime", "Version", "Home"})
+		headings := []string{"Type", "Name", "Host", "PID", "Ports", "User", "Group", "Starttime", "Version", "Home"}
+		if psCmdLong {
+			headings = append(headings, "Limits")
+		}
+		psCSVWriter.Write(append(headings, psCmdLabels...))
 		instance.Do(geneos.GetHost(Hostname), ct, names, psInstanceCSV).Write(psCSVWriter)
 	default:
 		psTabWriter := tabwriter.NewWriter(os.Stdout, 3, 8, 2, ' ', 0)
-		fmt.Fprintf(psTabWriter, "Type\tName\tHost\tPID\tPorts\tUser\tGroup\tStarttime\tVersion\tHome\n")
+		var limits string
+		if psCmdLong {
+			limits = "\tLimits"
+		}
+		fmt.Fprintf(psTabWriter, "Type\tName\tHost\tPID\tPorts\tUser\tGroup\tStarttime\tVersion\tHome%s%s\n", limits, labelHeadings(psCmdLabels))
 		instance.Do(geneos.GetHost(Hostname), ct, names, psInstancePlain).Write(psTabWriter)
 	}
 }
@@ -150,6 +162,12 @@ func psInstancePlain(i geneos.Instance, _ ...any) (resp *instance.Response) {
 	}
 
 	resp.Line = fmt.Sprintf("%s\t%s\t%s\t%d\t[%s]\t%s\t%s\t%s\t%s%s%s\t%s", i.Type(), i.Name(), i.Host(), pid, portlist, username, groupname, mtime.Local().Format(time.RFC3339), base, uptodate, actual, i.Home())
+	if psCmdLong {
+		resp.Line += "\t" + psLimits(i, pid, "-")
+	}
+	for _, l := range instance.LabelColumns(i, psCmdLabels, "-") {
+		resp.Line += "\t" + l
+	}
 
 	if psCmdShowFiles {
 		resp.Lines = listOpenFiles(i)
@@ -196,7 +214,11 @@ func psInstanceCSV(i geneos.Instance, _ ...any) (resp *instance.Response) {
 	if underlying != actual {
 		uptodate = "<>"
 	}
-	resp.Rows = append(resp.Rows, []string{i.Type().String(), i.Name(), i.Host().String(), fmt.Sprint(pid), portlist, username, groupname, mtime.Local().Format(time.RFC3339), fmt.Sprintf("%s%s%s", base, uptodate, actual), i.Home()})
+	row := []string{i.Type().String(), i.Name(), i.Host().String(), fmt.Sprint(pid), portlist, username, groupname, mtime.Local().Format(time.RFC3339), fmt.Sprintf("%s%s%s", base, uptodate, actual), i.Home()}
+	if psCmdLong {
+		row = append(row, psLimits(i, pid, ""))
+	}
+	resp.Rows = append(resp.Rows, append(row, instance.LabelColumns(i, psCmdLabels, "")...))
 
 	return
 }
@@ -240,6 +262,13 @@ func psInstanceJSON(i geneos.Instance, _ ...any) (resp *instance.Response) {
 		uptodate = "<>"
 	}
 
+	var limits *instance.Limits
+	if psCmdLong {
+		if l, err := instance.ProcessLimits(i, pid); err == nil {
+			limits = &l
+		}
+	}
+
 	resp.Value = psType{
 		Type:      i.Type().String(),
 		Name:      i.Name(),
@@ -251,11 +280,23 @@ func psInstanceJSON(i geneos.Instance, _ ...any) (resp *instance.Response) {
 		Starttime: mtime.Local().Format(time.RFC3339),
 		Version:   fmt.Sprintf("%s%s%s", base, uptodate, actual),
 		Home:      i.Home(),
+		Labels:    instance.Labels(i),
+		Limits:    limits,
 	}
 
 	return
 }
 
+// psLimits returns the resource limits of process pid for instance i
+// as a string, or empty if they cannot be read
+func psLimits(i geneos.Instance, pid int, empty string) string {
+	limits, err := instance.ProcessLimits(i, pid)
+	if err != nil {
+		return empty
+	}
+	return limits.String()
+}
+
 func live(i geneos.Instance) bool {
 	cf := i.Config()
 	h := i.Host()
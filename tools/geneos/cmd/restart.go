@@ -20,6 +20,7 @@ package cmd
 import (
 	_ "embed"
 	"os"
+	"time"
 
 	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
 	"github.com/itrs-group/cordial/tools/geneos/internal/instance"
@@ -30,6 +31,7 @@ import (
 var restartCmdAll, restartCmdKill, restartCmdForce, restartCmdLogs bool
 var restartCmdExtras string
 var restartCmdEnvs instance.NameValues
+var restartCmdWait time.Duration
 
 func init() {
 	GeneosCmd.AddCommand(restartCmd)
@@ -41,6 +43,8 @@ func init() {
 	restartCmd.Flags().StringVarP(&restartCmdExtras, "extras", "x", "", "Extra args passed to process, split on spaces and quoting ignored")
 	restartCmd.Flags().VarP(&restartCmdEnvs, "env", "e", "Extra environment variable (Repeat as required)")
 
+	restartCmd.Flags().DurationVarP(&restartCmdWait, "wait", "w", 60*time.Second, "Wait up to `DURATION` for each start order tier to be\nlistening before starting the next. Zero to not wait")
+
 	restartCmd.Flags().BoolVarP(&restartCmdLogs, "log", "l", false, "Run 'logs -f' after starting instance(s)")
 
 	restartCmd.Flags().SortFlags = false
@@ -62,9 +66,22 @@ var restartCmd = &cobra.Command{
 	},
 	Run: func(cmd *cobra.Command, _ []string) {
 		ct, names := ParseTypeNames(cmd)
-		instance.Do(geneos.GetHost(Hostname), ct, names, func(i geneos.Instance, a ...any) (resp *instance.Response) {
+		h := geneos.GetHost(Hostname)
+
+		// stop everything in reverse start order first, then start in
+		// start order, so that dependencies come up before dependants
+		stopped := instance.DoInOrder(h, ct, names, true, 0, func(i geneos.Instance, a ...any) (resp *instance.Response) {
 			resp = instance.NewResponse(i)
 			resp.Err = instance.Stop(i, restartCmdForce, false)
+			return
+		})
+
+		instance.DoInOrder(h, ct, names, false, restartCmdWait, func(i geneos.Instance, a ...any) (resp *instance.Response) {
+			resp, ok := stopped[i.String()]
+			if !ok {
+				resp = instance.NewResponse(i)
+				resp.Err = os.ErrProcessDone
+			}
 			if resp.Err == nil || restartCmdAll {
 				resp.Err = instance.Start(i, instance.StartingExtras(restartCmdExtras), instance.StartingEnvs(restartCmdEnvs))
 			}
@@ -30,6 +30,7 @@ import (
 	"github.com/itrs-group/cordial"
 	"github.com/itrs-group/cordial/pkg/config"
 	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+	"github.com/itrs-group/cordial/tools/geneos/internal/instance"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -49,6 +50,9 @@ var UserKeyFile config.KeyFile
 
 var debug, quiet bool
 
+// selector is the label selector from the `--selector` option
+var selector string
+
 // DefaultUserKeyfile is the path to the user's key file as a
 // config.Keyfile type
 var DefaultUserKeyfile = config.KeyFile(
@@ -82,7 +86,9 @@ func init() {
 			config.IgnoreUserConfDir(),
 			config.IgnoreWorkingDir())+
 		")")
-	GeneosCmd.PersistentFlags().StringVarP(&Hostname, "host", "H", "all", "Limit actions to `HOSTNAME` (not for commands given instance@host parameters)")
+	GeneosCmd.PersistentFlags().StringVarP(&Hostname, "host", "H", "all", "Limit actions to `HOSTNAME` or hosts matching a selector,\ne.g. env=prod,dc!=ldn or @group (not for commands given instance@host parameters)")
+	GeneosCmd.PersistentFlags().StringVar(&selector, "selector", "", "Limit actions to instances with labels matching `SELECTOR`,\ne.g. team=fx,tier!=dev")
+	GeneosCmd.PersistentFlags().IntVar(&instance.MaxParallel, "parallel", 0, "Limit concurrent actions on remote hosts to `N`, 0 for no limit")
 	GeneosCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "enable extra debug output")
 	GeneosCmd.PersistentFlags().MarkHidden("debug")
 	GeneosCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "quiet mode")
@@ -244,6 +250,22 @@ geneos restart
 			command.SetUsageTemplate(" ")
 			return GeneosUnsetError
 		}
+
+		// a host selector limits "all" to the matching hosts
+		if geneos.IsHostSelector(Hostname) {
+			if err = geneos.SelectHosts(Hostname); err != nil {
+				return
+			}
+			Hostname = geneos.ALLHOSTS
+		}
+
+		if selector != "" && command.Annotations[CmdNoSelector] == "true" {
+			return fmt.Errorf("%w: --selector cannot be used with %q", geneos.ErrInvalidArgs, command.CommandPath())
+		}
+		if instance.Selector, err = instance.ParseSelector(selector); err != nil {
+			return
+		}
+
 		if command.Name() == "help" {
 			// don't parse args if the command is a help
 			return nil
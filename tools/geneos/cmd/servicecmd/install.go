@@ -0,0 +1,190 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package servicecmd
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/itrs-group/cordial/tools/geneos/cmd"
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+	"github.com/itrs-group/cordial/tools/geneos/internal/instance"
+)
+
+var installCmdUser, installCmdStart bool
+
+func init() {
+	serviceCmd.AddCommand(installCmd)
+
+	installCmd.Flags().BoolVarP(&installCmdUser, "user", "u", false, "Install systemd user units instead of system units")
+	installCmd.Flags().BoolVarP(&installCmdStart, "start", "S", false, "Start instances through systemd after installing.\nInstances already running are stopped first")
+
+	installCmd.Flags().SortFlags = false
+}
+
+//go:embed _docs/install.md
+var installCmdDescription string
+
+var installCmd = &cobra.Command{
+	Use:   "install [flags] [TYPE] [NAME...]",
+	Short: "Install systemd units for instances",
+	Long:  installCmdDescription,
+	Example: `
+geneos service install
+geneos service install gateway -S
+geneos service install --user netprobe localhost
+`,
+	SilenceUsage: true,
+	Annotations: map[string]string{
+		cmd.CmdGlobal:        "true",
+		cmd.CmdRequireHome:   "true",
+		cmd.CmdWildcardNames: "true",
+	},
+	RunE: func(command *cobra.Command, _ []string) (err error) {
+		ct, names := cmd.ParseTypeNames(command)
+		h := geneos.GetHost(cmd.Hostname)
+
+		responses := instance.Do(h, ct, names, installUnit)
+
+		// per host: target unit, reload and enable
+		hosts := map[*geneos.Host][]string{}
+		for _, r := range responses {
+			if r.Err == nil {
+				hosts[r.Instance.Host()] = append(hosts[r.Instance.Host()], instance.ServiceName(r.Instance))
+			}
+		}
+		for h, units := range hosts {
+			if err = enableUnits(h, installCmdUser, units); err != nil {
+				fmt.Printf("%s: %s\n", h, err)
+			}
+		}
+
+		if installCmdStart {
+			for _, r := range responses {
+				if r.Err != nil {
+					continue
+				}
+				i := r.Instance
+				if instance.IsRunning(i) {
+					if serviceActive(i) {
+						continue
+					}
+					// running outside systemd
+					if r.Err = stopUnmanaged(i); r.Err != nil {
+						continue
+					}
+				}
+				if r.Err = instance.Start(i); r.Err != nil {
+					continue
+				}
+				r.Completed = append(r.Completed, "started")
+			}
+		}
+
+		responses.Write(os.Stdout)
+		return nil
+	},
+}
+
+// installUnit writes the unit and environment files for instance i and
+// marks the instance as managed by systemd
+func installUnit(i geneos.Instance, _ ...any) (resp *instance.Response) {
+	resp = instance.NewResponse(i)
+
+	if instance.IsDisabled(i) {
+		resp.Err = geneos.ErrDisabled
+		return
+	}
+
+	// order after instances on the same host that start earlier
+	var after []geneos.Instance
+	for _, a := range instance.Instances(i.Host(), nil, instance.IgnoreSelector()) {
+		if instance.StartOrder(a) < instance.StartOrder(i) {
+			after = append(after, a)
+		}
+	}
+
+	unit, env, err := instance.ServiceUnit(i, installCmdUser, after)
+	if err != nil {
+		resp.Err = err
+		return
+	}
+
+	dir := instance.ServiceUnitDir(i.Host(), installCmdUser)
+	if err = i.Host().MkdirAll(dir, 0755); err != nil {
+		resp.Err = err
+		return
+	}
+
+	if resp.Err = i.Host().WriteFile(instance.ServiceEnvFile(i), env, 0600); resp.Err != nil {
+		return
+	}
+
+	name := instance.ServiceName(i)
+	if resp.Err = i.Host().WriteFile(path.Join(dir, name), unit, 0644); resp.Err != nil {
+		if errors.Is(resp.Err, os.ErrPermission) && !installCmdUser {
+			resp.Err = fmt.Errorf("%w: writing system units requires root, try `--user`", resp.Err)
+		}
+		return
+	}
+
+	cf := i.Config()
+	cf.Set("service", name)
+	cf.Set("serviceuser", installCmdUser)
+	if resp.Err = instance.SaveConfig(i); resp.Err != nil {
+		return
+	}
+
+	resp.Completed = append(resp.Completed, fmt.Sprintf("unit %s installed in %s", name, dir))
+	return
+}
+
+// enableUnits writes the target unit on host h, reloads systemd and
+// enables the target and units
+func enableUnits(h *geneos.Host, user bool, units []string) (err error) {
+	dir := instance.ServiceUnitDir(h, user)
+	if err = h.WriteFile(path.Join(dir, instance.ServiceTarget), instance.ServiceTargetUnit(user), 0644); err != nil {
+		return
+	}
+	if _, err = instance.Systemctl(h, user, "daemon-reload"); err != nil {
+		return
+	}
+	_, err = instance.Systemctl(h, user, append([]string{"enable", instance.ServiceTarget}, units...)...)
+	return
+}
+
+// serviceActive returns true if the unit for instance i is active
+func serviceActive(i geneos.Instance) bool {
+	out, _ := instance.Systemctl(i.Host(), i.Config().GetBool("serviceuser"), "is-active", i.Config().GetString("service"))
+	return strings.TrimSpace(string(out)) == "active"
+}
+
+// stopUnmanaged stops an instance that was started outside systemd,
+// before it was marked as managed
+func stopUnmanaged(i geneos.Instance) (err error) {
+	service := i.Config().GetString("service")
+	i.Config().Set("service", "")
+	defer i.Config().Set("service", service)
+	return instance.Stop(i, true, false)
+}
@@ -0,0 +1,160 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package servicecmd
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+
+	"github.com/spf13/cobra"
+
+	"github.com/itrs-group/cordial/tools/geneos/cmd"
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+	"github.com/itrs-group/cordial/tools/geneos/internal/instance"
+)
+
+var removeCmdStart bool
+
+func init() {
+	serviceCmd.AddCommand(removeCmd)
+
+	removeCmd.Flags().BoolVarP(&removeCmdStart, "start", "S", false, "Start instances again, outside systemd, after removing units")
+
+	removeCmd.Flags().SortFlags = false
+}
+
+//go:embed _docs/remove.md
+var removeCmdDescription string
+
+var removeCmd = &cobra.Command{
+	Use:     "remove [flags] [TYPE] [NAME...]",
+	Aliases: []string{"rm", "uninstall"},
+	Short:   "Remove systemd units for instances",
+	Long:    removeCmdDescription,
+	Example: `
+geneos service remove
+geneos service remove gateway -S
+`,
+	SilenceUsage: true,
+	Annotations: map[string]string{
+		cmd.CmdGlobal:        "true",
+		cmd.CmdRequireHome:   "true",
+		cmd.CmdWildcardNames: "true",
+	},
+	RunE: func(command *cobra.Command, _ []string) (err error) {
+		ct, names := cmd.ParseTypeNames(command)
+		h := geneos.GetHost(cmd.Hostname)
+
+		responses := instance.Do(h, ct, names, removeUnit)
+
+		// reload systemd once per host and user/system
+		type reload struct {
+			h    *geneos.Host
+			user bool
+		}
+		reloads := map[reload]bool{}
+		for _, r := range responses {
+			if r.Err == nil && r.Value != nil {
+				reloads[reload{r.Instance.Host(), r.Value.(bool)}] = true
+			}
+			r.Value = nil
+		}
+		for r := range reloads {
+			if _, err = instance.Systemctl(r.h, r.user, "daemon-reload"); err != nil {
+				fmt.Printf("%s: %s\n", r.h, err)
+			}
+		}
+
+		if removeCmdStart {
+			for _, r := range responses {
+				if r.Err != nil || len(r.Completed) == 0 {
+					continue
+				}
+				if r.Err = instance.Start(r.Instance); r.Err == nil {
+					r.Completed = append(r.Completed, "started")
+				}
+			}
+		}
+
+		responses.Write(os.Stdout)
+		return nil
+	},
+}
+
+// removeUnit stops, disables and removes the unit for instance i and
+// clears the managed settings. The response Value is set to the
+// `serviceuser` setting so that the caller can reload the right
+// systemd instance.
+func removeUnit(i geneos.Instance, _ ...any) (resp *instance.Response) {
+	resp = instance.NewResponse(i)
+
+	if !instance.IsServiceManaged(i) {
+		resp.Line = "not managed by systemd"
+		return
+	}
+
+	cf := i.Config()
+	name := cf.GetString("service")
+	user := cf.GetBool("serviceuser")
+
+	if instance.IsRunning(i) {
+		if resp.Err = instance.Stop(i, true, false); resp.Err != nil {
+			return
+		}
+		resp.Completed = append(resp.Completed, "stopped")
+	}
+
+	if _, resp.Err = instance.Systemctl(i.Host(), user, "disable", name); resp.Err != nil {
+		return
+	}
+
+	for _, file := range []string{
+		path.Join(instance.ServiceUnitDir(i.Host(), user), name),
+		instance.ServiceEnvFile(i),
+	} {
+		if err := i.Host().Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			resp.Err = err
+			return
+		}
+	}
+
+	settings := cf.AllSettings()
+	instance.DeleteSettingFromMap(i, settings, "service")
+	instance.DeleteSettingFromMap(i, settings, "serviceuser")
+	if resp.Err = instance.SaveConfig(i, settings); resp.Err != nil {
+		return
+	}
+
+	// the saved settings are a copy, so reload the instance to drop the
+	// managed settings from the in-memory config before any `--start`
+	i.Unload()
+	reloaded, err := instance.Get(i.Type(), i.Name()+"@"+i.Host().String())
+	if err != nil {
+		resp.Err = err
+		return
+	}
+	resp.Instance = reloaded
+
+	resp.Value = user
+	resp.Completed = append(resp.Completed, fmt.Sprintf("unit %s removed", name))
+	return
+}
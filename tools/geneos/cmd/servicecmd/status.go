@@ -0,0 +1,135 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package servicecmd
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/itrs-group/cordial/tools/geneos/cmd"
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+	"github.com/itrs-group/cordial/tools/geneos/internal/instance"
+)
+
+var statusCmdJSON, statusCmdIndent, statusCmdCSV bool
+
+func init() {
+	serviceCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().BoolVarP(&statusCmdJSON, "json", "j", false, "Output JSON")
+	statusCmd.Flags().BoolVarP(&statusCmdIndent, "pretty", "i", false, "Output indented JSON")
+	statusCmd.Flags().BoolVarP(&statusCmdCSV, "csv", "c", false, "Output CSV")
+
+	statusCmd.Flags().SortFlags = false
+}
+
+//go:embed _docs/status.md
+var statusCmdDescription string
+
+var statusCmd = &cobra.Command{
+	Use:          "status [flags] [TYPE] [NAME...]",
+	Aliases:      []string{"ls", "list"},
+	Short:        "Show systemd unit status for instances",
+	Long:         statusCmdDescription,
+	SilenceUsage: true,
+	Annotations: map[string]string{
+		cmd.CmdGlobal:        "true",
+		cmd.CmdRequireHome:   "true",
+		cmd.CmdWildcardNames: "true",
+	},
+	RunE: func(command *cobra.Command, _ []string) (err error) {
+		ct, names := cmd.ParseTypeNames(command)
+		h := geneos.GetHost(cmd.Hostname)
+
+		switch {
+		case statusCmdJSON, statusCmdIndent:
+			instance.Do(h, ct, names, unitStatus).Write(os.Stdout, instance.WriterIndent(statusCmdIndent))
+		case statusCmdCSV:
+			w := csv.NewWriter(os.Stdout)
+			w.Write([]string{"Type", "Name", "Host", "Unit", "Enabled", "Active", "PID"})
+			instance.Do(h, ct, names, unitStatus).Write(w)
+		default:
+			w := tabwriter.NewWriter(os.Stdout, 3, 8, 2, ' ', 0)
+			fmt.Fprintf(w, "Type\tName\tHost\tUnit\tEnabled\tActive\tPID\n")
+			instance.Do(h, ct, names, unitStatus).Write(w)
+		}
+		return
+	},
+}
+
+type unitStatusType struct {
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Host    string `json:"host"`
+	Unit    string `json:"unit,omitempty"`
+	Enabled string `json:"enabled,omitempty"`
+	Active  string `json:"active,omitempty"`
+	PID     string `json:"pid,omitempty"`
+}
+
+func unitStatus(i geneos.Instance, _ ...any) (resp *instance.Response) {
+	resp = instance.NewResponse(i)
+
+	status := unitStatusType{
+		Type:    i.Type().String(),
+		Name:    i.Name(),
+		Host:    i.Host().String(),
+		Unit:    "-",
+		Enabled: "-",
+		Active:  "-",
+		PID:     "-",
+	}
+
+	if instance.IsServiceManaged(i) {
+		status.Unit = i.Config().GetString("service")
+		out, err := instance.Systemctl(i.Host(), i.Config().GetBool("serviceuser"), "show", "--property=UnitFileState,ActiveState,SubState,MainPID", status.Unit)
+		if err != nil {
+			resp.Err = err
+			return
+		}
+		props := map[string]string{}
+		for _, line := range strings.Split(string(out), "\n") {
+			if k, v, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+				props[k] = v
+			}
+		}
+		status.Enabled = props["UnitFileState"]
+		status.Active = props["ActiveState"] + "/" + props["SubState"]
+		if props["MainPID"] != "" && props["MainPID"] != "0" {
+			status.PID = props["MainPID"]
+		}
+	}
+
+	if statusCmdJSON || statusCmdIndent {
+		resp.Value = status
+		return
+	}
+	row := []string{status.Type, status.Name, status.Host, status.Unit, status.Enabled, status.Active, status.PID}
+	if statusCmdCSV {
+		resp.Rows = append(resp.Rows, row)
+		return
+	}
+	resp.Line = strings.Join(row, "\t")
+	return
+}
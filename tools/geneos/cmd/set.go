@@ -49,6 +49,7 @@ func init() {
 	setCmd.Flags().VarP(&setCmdValues.Attributes, "attribute", "a", instance.AttributesOptionsText)
 	setCmd.Flags().VarP(&setCmdValues.Types, "type", "t", instance.TypesOptionsText)
 	setCmd.Flags().VarP(&setCmdValues.Variables, "variable", "v", instance.VarsOptionsText)
+	setCmd.Flags().VarP(&setCmdValues.Labels, "label", "L", instance.LabelValuesOptionsText)
 
 	setCmd.Flags().SortFlags = false
 }
@@ -63,6 +64,7 @@ geneos set gateway MyGateway licdsecure=false
 geneos set infraprobe -e JAVA_HOME=/usr/lib/java8/jre -e TNS_ADMIN=/etc/ora/network/admin
 geneos set -s secret netprobe local1
 geneos set netprobe cloudapps1 -e SOME_CLIENT_ID=abcde -E SOME_CLIENT_SECRET
+geneos set gateway 'FX*' -L team=fx -L tier=prod
 `,
 	SilenceUsage: true,
 	Annotations: map[string]string{
@@ -34,11 +34,13 @@ import (
 )
 
 type showCmdInstanceConfig struct {
-	Name      string `json:"name,omitempty"`
-	Host      string `json:"host,omitempty"`
-	Type      string `json:"type,omitempty"`
-	Disabled  bool   `json:"disabled"`
-	Protected bool   `json:"protected"`
+	Name      string           `json:"name,omitempty"`
+	Host      string           `json:"host,omitempty"`
+	Type      string           `json:"type,omitempty"`
+	Disabled  bool             `json:"disabled"`
+	Protected bool             `json:"protected"`
+	PID       int              `json:"pid,omitempty"`
+	Limits    *instance.Limits `json:"limits,omitempty"`
 }
 
 type showCmdConfig struct {
@@ -263,6 +265,13 @@ func showInstance(i geneos.Instance, _ ...any) (resp *instance.Response) {
 		Configuration: as,
 	}
 
+	if pid, err := instance.GetPID(i); err == nil {
+		cf.Instance.PID = pid
+		if limits, err := instance.ProcessLimits(i, pid); err == nil {
+			cf.Instance.Limits = &limits
+		}
+	}
+
 	resp.Value = cf
 	return
 }
@@ -144,35 +144,7 @@ func snapshotInstance(i geneos.Instance, params ...any) (resp *instance.Response
 			continue
 		}
 
-		// always use auth details in per-instance config, default to
-		// from the command line or user/global config or credentials
-		// file
-		username := i.Config().GetString(config.Join("snapshot", "username"))
-		password := i.Config().GetPassword(config.Join("snapshot", "password"))
-
-		if username == "" {
-			username = snapshotCmdUsername
-		}
-
-		if password.IsNil() {
-			password = snapshotCmdPassword
-		}
-
-		// if username is still unset then look for credentials
-		//
-		// credential domain is gateway:NAME or gateway:* for wildcard
-		if username == "" {
-			creds := config.FindCreds(i.Type().String()+":"+i.Name(), config.SetAppName(cordial.ExecutableName()))
-			if creds != nil {
-				username = creds.GetString("username")
-				password = creds.GetPassword("password")
-			} else {
-				if creds = config.FindCreds(i.Type().String()+":*", config.SetAppName(cordial.ExecutableName())); creds != nil {
-					username = creds.GetString("username")
-					password = creds.GetPassword("password")
-				}
-			}
-		}
+		username, password := gatewayCredentials(i, snapshotCmdUsername, snapshotCmdPassword)
 
 		log.Debug().Msgf("dialling %s", gatewayURL(i))
 		var gw *commands.Connection
@@ -213,6 +185,40 @@ func snapshotInstance(i geneos.Instance, params ...any) (resp *instance.Response
 	return
 }
 
+// gatewayCredentials returns the username and password to use for the
+// REST Command API of gateway i. Auth details in the per-instance
+// config are always used first, defaulting to the username and
+// password passed in and finally the credentials file.
+//
+// The credential domain is gateway:NAME or gateway:* for wildcard
+func gatewayCredentials(i geneos.Instance, defaultUsername string, defaultPassword *config.Plaintext) (username string, password *config.Plaintext) {
+	username = i.Config().GetString(config.Join("snapshot", "username"))
+	password = i.Config().GetPassword(config.Join("snapshot", "password"))
+
+	if username == "" {
+		username = defaultUsername
+	}
+
+	if password.IsNil() {
+		password = defaultPassword
+	}
+
+	// if username is still unset then look for credentials
+	if username == "" {
+		creds := config.FindCreds(i.Type().String()+":"+i.Name(), config.SetAppName(cordial.ExecutableName()))
+		if creds != nil {
+			username = creds.GetString("username")
+			password = creds.GetPassword("password")
+		} else {
+			if creds = config.FindCreds(i.Type().String()+":*", config.SetAppName(cordial.ExecutableName())); creds != nil {
+				username = creds.GetString("username")
+				password = creds.GetPassword("password")
+			}
+		}
+	}
+	return
+}
+
 func gatewayURL(i geneos.Instance) (u *url.URL) {
 	if !instance.IsA(i, "gateway") {
 		return
@@ -20,6 +20,7 @@ package cmd
 import (
 	_ "embed"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -30,6 +31,7 @@ import (
 var startCmdLogs bool
 var startCmdExtras string
 var startCmdEnvs instance.NameValues
+var startCmdWait time.Duration
 
 func init() {
 	GeneosCmd.AddCommand(startCmd)
@@ -37,6 +39,7 @@ func init() {
 	startCmd.Flags().StringVarP(&startCmdExtras, "extras", "x", "", "Extra args passed to process, split on spaces and quoting ignored")
 	startCmd.Flags().VarP(&startCmdEnvs, "env", "e", "Extra environment variable (Repeat as required)")
 	startCmd.Flags().BoolVarP(&startCmdLogs, "log", "l", false, "Follow logs after starting instance")
+	startCmd.Flags().DurationVarP(&startCmdWait, "wait", "w", 60*time.Second, "Wait up to `DURATION` for each start order tier to be\nlistening before starting the next. Zero to not wait")
 	startCmd.Flags().SortFlags = false
 }
 
@@ -70,8 +73,11 @@ var startCmd = &cobra.Command{
 // flag to, well, watch logs while autostart is a flag to indicate if
 // Start() is being called as part of a group of instances - this is for
 // use by autostart checking.
+//
+// Instances are started in tiers by their start order, see
+// instance.DoInOrder
 func Start(ct *geneos.Component, watchlogs bool, autostart bool, names []string, params []string) (err error) {
-	instance.Do(geneos.GetHost(Hostname), ct, names, func(i geneos.Instance, _ ...any) (resp *instance.Response) {
+	instance.DoInOrder(geneos.GetHost(Hostname), ct, names, false, startCmdWait, func(i geneos.Instance, _ ...any) (resp *instance.Response) {
 		resp = instance.NewResponse(i)
 		if instance.IsAutoStart(i) || autostart {
 			resp.Err = instance.Start(i, instance.StartingExtras(startCmdExtras), instance.StartingEnvs(startCmdEnvs))
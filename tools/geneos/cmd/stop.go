@@ -19,8 +19,11 @@ package cmd
 
 import (
 	_ "embed"
+	"errors"
 	"os"
 
+	"github.com/rs/zerolog/log"
+
 	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
 	"github.com/itrs-group/cordial/tools/geneos/internal/instance"
 	"github.com/spf13/cobra"
@@ -53,9 +56,15 @@ var stopCmd = &cobra.Command{
 	},
 	Run: func(cmd *cobra.Command, _ []string) {
 		ct, names := ParseTypeNames(cmd)
-		instance.Do(geneos.GetHost(Hostname), ct, names, func(i geneos.Instance, a ...any) (resp *instance.Response) {
+		instance.DoInOrder(geneos.GetHost(Hostname), ct, names, true, 0, func(i geneos.Instance, a ...any) (resp *instance.Response) {
 			resp = instance.NewResponse(i)
 			resp.Err = instance.Stop(i, stopCmdForce, stopCmdKill)
+			if resp.Err == nil || errors.Is(resp.Err, os.ErrProcessDone) {
+				// tell `supervise` to leave the instance alone
+				if err := instance.MarkStopped(i); err != nil {
+					log.Debug().Err(err).Msgf("%s: cannot mark as stopped", i)
+				}
+			}
 			return
 		}).Write(os.Stdout,
 			instance.WriterShowTimes(),
@@ -0,0 +1,258 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+	"github.com/itrs-group/cordial/tools/geneos/internal/instance"
+)
+
+var superviseCmdInterval, superviseCmdBackoff, superviseCmdMaxBackoff, superviseCmdWindow time.Duration
+var superviseCmdLimit int
+var superviseCmdJournal string
+
+func init() {
+	GeneosCmd.AddCommand(superviseCmd)
+
+	superviseCmd.Flags().DurationVarP(&superviseCmdInterval, "interval", "i", 10*time.Second, "Check instances every `DURATION`")
+	superviseCmd.Flags().DurationVarP(&superviseCmdBackoff, "backoff", "b", 10*time.Second, "Initial delay `DURATION` between restart attempts.\nDoubled after each attempt")
+	superviseCmd.Flags().DurationVarP(&superviseCmdMaxBackoff, "max-backoff", "B", 10*time.Minute, "Maximum delay `DURATION` between restart attempts")
+	superviseCmd.Flags().IntVarP(&superviseCmdLimit, "limit", "L", 5, "Give up on an instance after this many restarts\nwithin the crash-loop window")
+	superviseCmd.Flags().DurationVarP(&superviseCmdWindow, "window", "W", time.Hour, "Crash-loop window `DURATION`")
+	superviseCmd.Flags().StringVarP(&superviseCmdJournal, "journal", "j", "", "Journal file `PATH`. Default is `supervise.journal`\nin the Geneos home directory")
+
+	superviseCmd.Flags().SortFlags = false
+}
+
+//go:embed _docs/supervise.md
+var superviseCmdDescription string
+
+var superviseCmd = &cobra.Command{
+	Use:          "supervise [flags] [TYPE] [NAME...]",
+	GroupID:      CommandGroupProcess,
+	Short:        "Restart Instances That Exit Unexpectedly",
+	Long:         superviseCmdDescription,
+	SilenceUsage: true,
+	Annotations: map[string]string{
+		CmdGlobal:        "true",
+		CmdRequireHome:   "true",
+		CmdWildcardNames: "true",
+	},
+	RunE: func(cmd *cobra.Command, _ []string) (err error) {
+		ct, names := ParseTypeNames(cmd)
+
+		journal := superviseCmdJournal
+		if journal == "" {
+			journal = path.Join(geneos.LocalRoot(), "supervise.journal")
+		}
+		j, err := os.OpenFile(journal, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0664)
+		if err != nil {
+			return
+		}
+		defer j.Close()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		s := &supervisor{
+			journal: json.NewEncoder(j),
+		}
+		s.record(nil, "supervise", fmt.Sprintf("started, checking every %s", superviseCmdInterval), 0, nil)
+		defer s.record(nil, "supervise", "stopped", 0, nil)
+
+		ticker := time.NewTicker(superviseCmdInterval)
+		defer ticker.Stop()
+
+		for {
+			instance.Do(geneos.GetHost(Hostname), ct, names, s.check)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	},
+}
+
+// supervisor holds the state of all the instances being supervised
+type supervisor struct {
+	mutex   sync.Mutex
+	journal *json.Encoder
+	states  sync.Map
+}
+
+// supervisedState is the state of a single supervised instance. It is
+// only ever updated by the goroutine checking the instance.
+type supervisedState struct {
+	pid         int
+	running     time.Time // when last seen starting to run, zero if not running
+	restarts    []time.Time
+	backoff     time.Duration
+	nextAttempt time.Time
+	quiet       string // last "not restarting" reason, to only record it once
+	gaveUp      bool
+}
+
+// journalEntry is one line in the JSON journal
+type journalEntry struct {
+	Time     time.Time `json:"time"`
+	Instance string    `json:"instance,omitempty"`
+	Event    string    `json:"event"`
+	Detail   string    `json:"detail,omitempty"`
+	PID      int       `json:"pid,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// record writes an event to the journal and to STDOUT
+func (s *supervisor) record(i geneos.Instance, event, detail string, pid int, err error) {
+	entry := journalEntry{
+		Time:   time.Now(),
+		Event:  event,
+		Detail: detail,
+		PID:    pid,
+	}
+	if i != nil {
+		entry.Instance = i.String()
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.journal.Encode(entry); err != nil {
+		log.Error().Err(err).Msg("cannot write to journal")
+	}
+	line := fmt.Sprintf("%s %s", entry.Time.Format(time.RFC3339), event)
+	if i != nil {
+		line = fmt.Sprintf("%s %s: %s", entry.Time.Format(time.RFC3339), i, event)
+	}
+	if detail != "" {
+		line += " " + detail
+	}
+	if err != nil {
+		line += ": " + err.Error()
+	}
+	fmt.Println(line)
+}
+
+// quietly records a reason for not restarting an instance, but only
+// once until the reason changes
+func (s *supervisor) quietly(i geneos.Instance, st *supervisedState, reason string) {
+	if st.quiet == reason {
+		return
+	}
+	st.quiet = reason
+	s.record(i, "skipped", reason, 0, nil)
+}
+
+// check is called for each matching instance on every interval
+func (s *supervisor) check(i geneos.Instance, _ ...any) (resp *instance.Response) {
+	resp = instance.NewResponse(i)
+
+	v, _ := s.states.LoadOrStore(i.String(), &supervisedState{backoff: superviseCmdBackoff})
+	st := v.(*supervisedState)
+
+	if instance.IsDisabled(i) {
+		s.quietly(i, st, "disabled")
+		return
+	}
+
+	if pid, err := instance.GetPID(i); err == nil {
+		now := time.Now()
+		if st.running.IsZero() || pid != st.pid {
+			s.record(i, "running", "", pid, nil)
+			st.running = now
+			st.pid = pid
+			st.quiet = ""
+			st.gaveUp = false
+		}
+		// reset backoff once the instance has stayed up
+		if now.Sub(st.running) > superviseCmdWindow {
+			st.backoff = superviseCmdBackoff
+			st.restarts = nil
+		}
+		return
+	}
+
+	if !st.running.IsZero() {
+		// seen running before but not now
+		if instance.IsStopped(i) {
+			s.record(i, "stopped", "by user", st.pid, nil)
+		} else {
+			s.record(i, "exited", "", st.pid, nil)
+		}
+		st.running = time.Time{}
+	}
+
+	switch {
+	case instance.IsStopped(i):
+		s.quietly(i, st, "stopped by user")
+		return
+	case !instance.IsAutoStart(i):
+		s.quietly(i, st, "autostart not set")
+		return
+	case instance.IsProtected(i):
+		s.quietly(i, st, "protected")
+		return
+	case st.gaveUp:
+		return
+	case time.Now().Before(st.nextAttempt):
+		return
+	}
+
+	// drop restarts outside the crash-loop window
+	now := time.Now()
+	for len(st.restarts) > 0 && now.Sub(st.restarts[0]) > superviseCmdWindow {
+		st.restarts = st.restarts[1:]
+	}
+	if superviseCmdLimit > 0 && len(st.restarts) >= superviseCmdLimit {
+		st.gaveUp = true
+		s.record(i, "crashloop", fmt.Sprintf("%d restarts in %s, giving up until it is started manually", len(st.restarts), superviseCmdWindow), 0, nil)
+		return
+	}
+
+	st.restarts = append(st.restarts, now)
+	st.nextAttempt = now.Add(st.backoff)
+	st.backoff = min(st.backoff*2, superviseCmdMaxBackoff)
+	st.quiet = ""
+
+	if resp.Err = instance.Start(i); resp.Err != nil {
+		s.record(i, "restart", fmt.Sprintf("attempt %d failed, next attempt after %s", len(st.restarts), st.nextAttempt.Format(time.RFC3339)), 0, resp.Err)
+		return
+	}
+	pid, _ := instance.GetPID(i)
+	s.record(i, "restart", fmt.Sprintf("attempt %d", len(st.restarts)), pid, nil)
+	st.running = time.Now()
+	st.pid = pid
+	return
+}
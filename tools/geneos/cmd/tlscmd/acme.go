@@ -0,0 +1,477 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tlscmd
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/awnumar/memguard"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/pflag"
+	"golang.org/x/crypto/acme"
+
+	"github.com/itrs-group/cordial"
+	"github.com/itrs-group/cordial/pkg/config"
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+	"github.com/itrs-group/cordial/tools/geneos/internal/instance"
+)
+
+// ACMEAccountKey is the name of the file, in the user's configuration
+// directory, that holds the private key for the ACME account
+const ACMEAccountKey = "acme-account.key"
+
+// acmeTimeout is the maximum time to wait for an order to complete,
+// including challenge validation
+const acmeTimeout = 5 * time.Minute
+
+// acmeOptions are the ACME flags of a command. Each command that can
+// use an ACME server has its own set.
+type acmeOptions struct {
+	directory string
+	challenge string
+	hook      string
+	listen    string
+	email     string
+	ca        string
+}
+
+// flags adds the ACME flags to the flagset, bound to a
+func (a *acmeOptions) flags(flags *pflag.FlagSet) {
+	flags.StringVar(&a.directory, "acme", "", "Request certificates from the ACME server with directory `URL`\ninstead of using the signing certificate")
+	flags.StringVar(&a.challenge, "challenge", "", "ACME challenge `TYPE`, either http-01 or dns-01\n(default from config tls::acme::challenge or http-01)")
+	flags.StringVar(&a.hook, "hook", "", "`SCRIPT` to run to present and clean-up ACME challenges\n(default from config tls::acme::hook)")
+	flags.StringVar(&a.listen, "acme-listen", "", "Listen on `ADDR` to answer http-01 challenges if no hook is given\n(default from config tls::acme::listen or :80)")
+	flags.StringVar(&a.email, "email", "", "Contact `EMAIL` for ACME account registration\n(default from config tls::acme::email)")
+	flags.StringVar(&a.ca, "acme-ca", "", "Trust the CA certificates in `FILE` for the ACME server, as well as the system roots\n(default from config tls::acme::cacert)")
+}
+
+// acmeSetting returns the value of flag if set, otherwise the value of
+// the tls::acme::NAME setting in the global config or def
+func acmeSetting(flag, name, def string) string {
+	if flag != "" {
+		return flag
+	}
+	return config.GetString(config.Join("tls", "acme", name), config.Default(def))
+}
+
+var acmeClientOnce struct {
+	sync.Mutex
+	client *acme.Client
+}
+
+// acmeClient returns an ACME client for the directory URL in a,
+// registering an account on first use. The account key is
+// loaded from, or created and saved to, the user's configuration
+// directory. If there are credentials for the directory URL in the
+// credentials store then they are used for External Account Binding,
+// with the username as the key ID and the password as the base64url
+// encoded HMAC key.
+func acmeClient(ctx context.Context, a *acmeOptions) (client *acme.Client, err error) {
+	acmeClientOnce.Lock()
+	defer acmeClientOnce.Unlock()
+
+	if acmeClientOnce.client != nil {
+		return acmeClientOnce.client, nil
+	}
+
+	confDir := config.AppConfigDir()
+	if confDir == "" {
+		return nil, config.ErrNoUserConfigDir
+	}
+
+	keyfile := path.Join(confDir, ACMEAccountKey)
+	der, err := config.ReadPrivateKey(geneos.LOCAL, keyfile)
+	if errors.Is(err, fs.ErrNotExist) {
+		if der, err = config.NewPrivateKey("ecdsa"); err != nil {
+			return
+		}
+		if err = config.WritePrivateKey(geneos.LOCAL, keyfile, der); err != nil {
+			return
+		}
+		log.Debug().Msgf("created ACME account key %s", keyfile)
+	}
+	if err != nil {
+		return
+	}
+	key, _, err := config.ParseKey(der)
+	if err != nil {
+		return
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("ACME account key %s cannot be used for signing", keyfile)
+	}
+
+	httpClient, err := acmeHTTPClient(a)
+	if err != nil {
+		return
+	}
+
+	client = &acme.Client{
+		Key:          signer,
+		HTTPClient:   httpClient,
+		DirectoryURL: a.directory,
+		UserAgent:    cordial.ExecutableName() + "/" + cordial.VERSION,
+	}
+
+	account := &acme.Account{}
+	if email := acmeSetting(a.email, "email", ""); email != "" {
+		account.Contact = []string{"mailto:" + email}
+	}
+
+	if creds := config.FindCreds(a.directory, config.SetAppName(cordial.ExecutableName())); creds != nil && creds.GetString("username") != "" {
+		hmac, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(creds.GetPassword("password").String(), "="))
+		if err != nil {
+			return nil, fmt.Errorf("EAB key for %s is not base64url encoded: %w", a.directory, err)
+		}
+		account.ExternalAccountBinding = &acme.ExternalAccountBinding{
+			KID: creds.GetString("username"),
+			Key: hmac,
+		}
+	}
+
+	if _, err = client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("ACME account registration with %s failed: %w", a.directory, err)
+	}
+
+	acmeClientOnce.client = client
+	return client, nil
+}
+
+// acmeHTTPClient returns the HTTP client to use for the ACME server in
+// a. If a CA certificate file is given by `--acme-ca` or
+// `tls::acme::cacert` then the certificates in it are trusted along with the system roots,
+// otherwise nil is returned and the ACME client uses the default.
+func acmeHTTPClient(a *acmeOptions) (client *http.Client, err error) {
+	cafile := acmeSetting(a.ca, "cacert", "")
+	if cafile == "" {
+		return
+	}
+	cafile = config.ExpandHome(cafile)
+	pembytes, err := geneos.LOCAL.ReadFile(cafile)
+	if err != nil {
+		return
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(pembytes) {
+		return nil, fmt.Errorf("no CA certificates found in %s", cafile)
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: roots},
+		},
+	}, nil
+}
+
+// acmeInstanceCert requests a certificate for instance i from the ACME
+// server in a. If renew is false then instances with an
+// existing valid certificate are skipped. When renewing an existing
+// private key is reused, otherwise a new key is created. The issued
+// certificate and key are written as for certificates created with the
+// local signing certificate while the chain returned by the ACME server
+// is written to an instance specific chain file.
+func acmeInstanceCert(i geneos.Instance, renew bool, a *acmeOptions) (resp *instance.Response) {
+	resp = instance.NewResponse(i)
+
+	if !renew {
+		if _, valid, _, err := instance.ReadCert(i); err == nil && valid {
+			resp.Line = "certificate already exists and is valid (use the `renew` command to overwrite)"
+			return
+		}
+	}
+
+	// the built-in responder can only answer for the local host
+	if !i.Host().IsLocal() && acmeSetting(a.challenge, "challenge", "http-01") == "http-01" && acmeSetting(a.hook, "hook", "") == "" {
+		resp.Err = fmt.Errorf("%w: http-01 challenges for instances on remote hosts require a `--hook` script to answer them on %s", geneos.ErrInvalidArgs, i.Host())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), acmeTimeout)
+	defer cancel()
+
+	client, err := acmeClient(ctx, a)
+	if err != nil {
+		resp.Err = err
+		return
+	}
+
+	hostname, _ := os.Hostname()
+	if !i.Host().IsLocal() {
+		hostname = i.Host().GetString("hostname")
+	}
+
+	var existingKey *memguard.Enclave
+	if renew {
+		existingKey, _ = instance.ReadKey(i)
+	}
+	keyDER := existingKey
+	if keyDER == nil {
+		if keyDER, err = config.NewPrivateKey(config.DefaultKeyType); err != nil {
+			resp.Err = err
+			return
+		}
+	}
+	key, _, err := config.ParseKey(keyDER)
+	if err != nil {
+		resp.Err = err
+		return
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		resp.Err = fmt.Errorf("private key type %s cannot be used for a certificate request", config.PrivateKeyType(keyDER))
+		return
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(hostname))
+	if err != nil {
+		resp.Err = err
+		return
+	}
+
+	for _, u := range order.AuthzURLs {
+		if resp.Err = acmeAuthorize(ctx, client, i, u, a); resp.Err != nil {
+			return
+		}
+	}
+
+	if order, err = client.WaitOrder(ctx, order.URI); err != nil {
+		resp.Err = err
+		return
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName: fmt.Sprintf("geneos %s %s", i.Type(), i.Name()),
+		},
+		DNSNames: []string{hostname},
+	}, signer)
+	if err != nil {
+		resp.Err = err
+		return
+	}
+
+	ders, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		resp.Err = err
+		return
+	}
+	var certs []*x509.Certificate
+	for _, der := range ders {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			resp.Err = err
+			return
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		resp.Err = fmt.Errorf("no certificate returned by ACME server")
+		return
+	}
+
+	if resp.Err = instance.WriteCert(i, certs[0]); resp.Err != nil {
+		return
+	}
+
+	if existingKey == nil {
+		if resp.Err = instance.WriteKey(i, keyDER); resp.Err != nil {
+			return
+		}
+	}
+
+	// the chain is specific to the ACME server, so never write it to
+	// the shared chain file
+	if len(certs) > 1 {
+		chainfile := instance.PathOf(i, "certchain")
+		if chainfile == "" || chainfile == i.Host().PathTo("tls", geneos.ChainCertFile) {
+			chainfile = path.Join(i.Home(), "chain.pem")
+			i.Config().SetString("certchain", chainfile, config.Replace("home"))
+		}
+		if resp.Err = config.WriteCertChain(i.Host(), chainfile, certs[1:]...); resp.Err != nil {
+			return
+		}
+	}
+
+	if resp.Err = instance.SaveConfig(i); resp.Err != nil {
+		return
+	}
+
+	resp.Completed = append(resp.Completed, fmt.Sprintf("certificate issued by %q (expires %s)", certs[0].Issuer.CommonName, certs[0].NotAfter.UTC().Format(time.RFC3339)))
+	return
+}
+
+// acmeAuthorize completes the authorization at URL u for instance i
+// using the challenge type selected in a
+func acmeAuthorize(ctx context.Context, client *acme.Client, i geneos.Instance, u string, a *acmeOptions) (err error) {
+	authz, err := client.GetAuthorization(ctx, u)
+	if err != nil {
+		return
+	}
+	if authz.Status == acme.StatusValid {
+		return
+	}
+
+	challengeType := acmeSetting(a.challenge, "challenge", "http-01")
+	idx := slices.IndexFunc(authz.Challenges, func(c *acme.Challenge) bool { return c.Type == challengeType })
+	if idx == -1 {
+		return fmt.Errorf("ACME server does not offer a %s challenge for %s", challengeType, authz.Identifier.Value)
+	}
+	challenge := authz.Challenges[idx]
+
+	env := []string{
+		"ACME_CHALLENGE=" + challenge.Type,
+		"ACME_DOMAIN=" + authz.Identifier.Value,
+		"ACME_TOKEN=" + challenge.Token,
+		"GENEOS_INSTANCE=" + i.String(),
+		"GENEOS_HOST=" + i.Host().String(),
+	}
+
+	switch challenge.Type {
+	case "http-01":
+		keyAuth, err := client.HTTP01ChallengeResponse(challenge.Token)
+		if err != nil {
+			return err
+		}
+		challengePath := client.HTTP01ChallengePath(challenge.Token)
+		env = append(env, "ACME_KEY_AUTH="+keyAuth, "ACME_PATH="+challengePath)
+
+		if acmeSetting(a.hook, "hook", "") == "" {
+			if err = acmeResponder.add(acmeSetting(a.listen, "listen", ":80"), challengePath, keyAuth); err != nil {
+				return err
+			}
+			defer acmeResponder.remove(challengePath)
+		}
+	case "dns-01":
+		value, err := client.DNS01ChallengeRecord(challenge.Token)
+		if err != nil {
+			return err
+		}
+		env = append(env, "ACME_DNS_NAME=_acme-challenge."+authz.Identifier.Value, "ACME_DNS_VALUE="+value)
+	default:
+		return fmt.Errorf("unsupported ACME challenge type %q", challenge.Type)
+	}
+
+	if err = acmeRunHook(ctx, a, "present", env); err != nil {
+		return
+	}
+	defer func() {
+		if err := acmeRunHook(context.Background(), a, "cleanup", env); err != nil {
+			log.Warn().Err(err).Msgf("%s: ACME challenge clean-up failed", i)
+		}
+	}()
+
+	if _, err = client.Accept(ctx, challenge); err != nil {
+		return
+	}
+	if _, err = client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("%s authorization for %s failed: %w", challenge.Type, authz.Identifier.Value, err)
+	}
+	return
+}
+
+// acmeRunHook runs the hook script in a, if any, with action as the
+// only argument and the challenge details in the environment
+func acmeRunHook(ctx context.Context, a *acmeOptions, action string, env []string) (err error) {
+	hook := acmeSetting(a.hook, "hook", "")
+	if hook == "" {
+		if slices.Contains(env, "ACME_CHALLENGE=dns-01") {
+			return fmt.Errorf("a hook script is required for dns-01 challenges (%w)", geneos.ErrInvalidArgs)
+		}
+		return
+	}
+
+	cmd := exec.CommandContext(ctx, hook, action)
+	cmd.Env = append(os.Environ(), env...)
+	out, err := cmd.CombinedOutput()
+	log.Debug().Msgf("hook %s %s output:\n%s", hook, action, out)
+	if err != nil {
+		return fmt.Errorf("hook %s %s: %w: %s", hook, action, err, strings.TrimSpace(string(out)))
+	}
+	return
+}
+
+// acmeResponder answers http-01 challenges directly when no hook script
+// is given. The listener is started on first use and then left running
+// until the command exits.
+var acmeResponder = &httpResponder{}
+
+type httpResponder struct {
+	sync.Mutex
+	started bool
+	tokens  map[string]string
+}
+
+// add answers challengePath with keyAuth, starting the listener on
+// listen if it is not already running
+func (r *httpResponder) add(listen, challengePath, keyAuth string) (err error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if !r.started {
+		l, err := net.Listen("tcp", listen)
+		if err != nil {
+			return fmt.Errorf("cannot listen for http-01 challenges, use `--hook` or `--acme-listen`: %w", err)
+		}
+		r.tokens = map[string]string{}
+		go http.Serve(l, r)
+		r.started = true
+		log.Debug().Msgf("answering http-01 challenges on %s", listen)
+	}
+	r.tokens[challengePath] = keyAuth
+	return
+}
+
+func (r *httpResponder) remove(challengePath string) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.tokens, challengePath)
+}
+
+func (r *httpResponder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.Lock()
+	keyAuth, ok := r.tokens[req.URL.Path]
+	r.Unlock()
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(keyAuth))
+}
@@ -0,0 +1,87 @@
+package tlscmd
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync/atomic"
+	"testing"
+
+	"github.com/itrs-group/cordial"
+	"github.com/itrs-group/cordial/pkg/config"
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+)
+
+// acmeStandIn returns a TLS server that answers the ACME directory,
+// nonce and account registration requests, counting the registrations
+func acmeStandIn(t *testing.T, registered *atomic.Int32) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	srv := httptest.NewUnstartedServer(mux)
+	// hide the handshake errors from the untrusted client
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	mux.HandleFunc("/directory", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"newNonce":   srv.URL + "/nonce",
+			"newAccount": srv.URL + "/account",
+			"newOrder":   srv.URL + "/order",
+		})
+	})
+	mux.HandleFunc("/nonce", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "nonce")
+	})
+	mux.HandleFunc("/account", func(w http.ResponseWriter, r *http.Request) {
+		registered.Add(1)
+		w.Header().Set("Replay-Nonce", "nonce")
+		w.Header().Set("Location", srv.URL+"/account/1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"status":"valid"}`))
+	})
+	return srv
+}
+
+func TestACMEClientCA(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	config.ResetConfig(config.SetAppName(cordial.ExecutableName()))
+	geneos.InitHosts(cordial.ExecutableName())
+	if err := os.MkdirAll(config.AppConfigDir(), 0775); err != nil {
+		t.Fatal(err)
+	}
+
+	var registered atomic.Int32
+	srv := acmeStandIn(t, &registered)
+	cafile := path.Join(dir, "ca.pem")
+	if err := os.WriteFile(cafile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &acmeOptions{directory: srv.URL + "/directory"}
+	t.Cleanup(func() { acmeClientOnce.client = nil })
+
+	// without the CA the server certificate is not trusted
+	if _, err := acmeClient(context.Background(), a); err == nil {
+		t.Fatal("acmeClient() succeeded without the ACME server CA")
+	}
+	if n := registered.Load(); n != 0 {
+		t.Fatalf("account registered %d times without the ACME server CA", n)
+	}
+
+	a.ca = cafile
+	client, err := acmeClient(context.Background(), a)
+	if err != nil {
+		t.Fatalf("acmeClient() with --acme-ca: %v", err)
+	}
+	if n := registered.Load(); client.HTTPClient == nil || n != 1 {
+		t.Errorf("account not registered through the CA client, %d registrations", n)
+	}
+}
@@ -163,6 +163,7 @@ func CreateCert(destination string, overwrite bool, duration time.Duration, cn s
 	if err != nil {
 		return
 	}
+	geneos.RecordIssued(signingCert, cert, "", "")
 
 	if err = config.WriteCert(geneos.LOCAL, basepath+".pem", cert); err != nil {
 		return
@@ -225,6 +226,7 @@ func CreateCertBundle(destination string, overwrite bool, duration time.Duration
 	if err != nil {
 		return
 	}
+	geneos.RecordIssued(signer, cert, "", "")
 
 	var pembytes []byte
 	for _, c := range []*x509.Certificate{cert, signer, root} {
@@ -0,0 +1,77 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tlscmd
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/itrs-group/cordial/tools/geneos/cmd"
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+)
+
+var crlCmdDays int
+var crlCmdOutput string
+
+func init() {
+	tlsCmd.AddCommand(crlCmd)
+
+	crlCmd.Flags().IntVarP(&crlCmdDays, "days", "D", 30, "CRL validity in days")
+	crlCmd.Flags().StringVarP(&crlCmdOutput, "output", "o", "", "Also write the CRL to `FILE`, `-` for stdout")
+
+	crlCmd.Flags().SortFlags = false
+}
+
+//go:embed _docs/crl.md
+var crlCmdDescription string
+
+var crlCmd = &cobra.Command{
+	Use:          "crl [flags]",
+	Short:        "Create and distribute a certificate revocation list",
+	Long:         crlCmdDescription,
+	SilenceUsage: true,
+	Annotations: map[string]string{
+		cmd.CmdGlobal:      "false",
+		cmd.CmdRequireHome: "true",
+	},
+	RunE: func(command *cobra.Command, _ []string) (err error) {
+		if crlCmdDays < 1 {
+			return fmt.Errorf("--days must be at least 1 (%w)", geneos.ErrInvalidArgs)
+		}
+		crl, err := geneos.CreateCRL(24 * time.Hour * time.Duration(crlCmdDays))
+		if err != nil {
+			return
+		}
+
+		switch crlCmdOutput {
+		case "":
+		case "-":
+			fmt.Print(string(crl))
+		default:
+			if err = os.WriteFile(crlCmdOutput, crl, 0644); err != nil {
+				return
+			}
+		}
+
+		return geneos.TLSSyncCRL(crl)
+	},
+}
@@ -18,27 +18,36 @@ limitations under the License.
 package tlscmd
 
 import (
+	"crypto/x509"
 	_ "embed"
 	"encoding/pem"
 	"fmt"
 	"os"
 	"path"
 
+	"github.com/awnumar/memguard"
 	"github.com/spf13/cobra"
 
 	"github.com/itrs-group/cordial/pkg/config"
 	"github.com/itrs-group/cordial/tools/geneos/cmd"
 	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+	"github.com/itrs-group/cordial/tools/geneos/internal/instance"
 )
 
-var exportCmdOutput string
-var exportCmdNoRoot bool
+var exportCmdOutput, exportCmdFormat string
+var exportCmdNoRoot, exportCmdChain bool
+var exportCmdPassword *config.Plaintext
 
 func init() {
 	tlsCmd.AddCommand(exportCmd)
 
+	exportCmdPassword = &config.Plaintext{}
+
 	exportCmd.Flags().StringVarP(&exportCmdOutput, "output", "o", "", "Output destination, default to stdout")
+	exportCmd.Flags().StringVarP(&exportCmdFormat, "format", "f", "pem", "Output `FORMAT`, one of pem or pkcs12")
+	exportCmd.Flags().VarP(exportCmdPassword, "password", "p", "Password for pkcs12 output")
 	exportCmd.Flags().BoolVarP(&exportCmdNoRoot, "no-root", "N", false, "Do not include the root CA certificate")
+	exportCmd.Flags().BoolVar(&exportCmdChain, "chain", false, "Export only the certificate chain, as a trust store")
 
 	exportCmd.Flags().SortFlags = false
 }
@@ -55,52 +64,80 @@ var exportCmd = &cobra.Command{
 	Example: `
 # export 
 $ geneos tls export --output file.pem
+$ geneos tls export --format pkcs12 --output signer.p12
+$ geneos tls export --format pkcs12 --output gateway.p12 gateway Demo
+$ geneos tls export --chain --format pkcs12 --output truststore.p12
 `,
 	Annotations: map[string]string{
 		cmd.CmdGlobal:      "false",
 		cmd.CmdRequireHome: "true",
 	},
 	RunE: func(command *cobra.Command, _ []string) (err error) {
-		confDir := config.AppConfigDir()
-		if confDir == "" {
-			return config.ErrNoUserConfigDir
-		}
-		// gather the rootCA cert, the geneos cert and key
-		root, rootFile, err := geneos.ReadRootCert(true)
-		if err != nil {
-			err = fmt.Errorf("local root certificate (%s) not valid: %w", rootFile, err)
+		ct, names := cmd.ParseTypeNames(command)
+
+		if err = checkFormat(exportCmdFormat, false); err != nil {
 			return
 		}
-		signer, signerFile, err := geneos.ReadSigningCert(true)
-		if err != nil {
-			err = fmt.Errorf("local signing root certificate (%s) not valid: %w", signerFile, err)
-			return
+		if exportCmdFormat == "pkcs12" && exportCmdOutput == "" {
+			return fmt.Errorf("pkcs12 format requires an --output file (%w)", geneos.ErrInvalidArgs)
 		}
-		signingKey, err := config.ReadPrivateKey(geneos.LOCAL, path.Join(confDir, geneos.SigningCertBasename+".key"))
-		if err != nil {
-			return
+
+		var cert *x509.Certificate
+		var key *memguard.Enclave
+		var chain []*x509.Certificate
+
+		switch {
+		case exportCmdChain:
+			chainfile := geneos.LOCAL.PathTo("tls", geneos.ChainCertFile)
+			if chain = config.ReadCertificates(geneos.LOCAL, chainfile); len(chain) == 0 {
+				return fmt.Errorf("no certificates found in %s", chainfile)
+			}
+		case ct != nil || len(names) > 0:
+			if cert, key, chain, err = exportInstance(ct, names); err != nil {
+				return
+			}
+		default:
+			if cert, key, chain, err = exportSigner(); err != nil {
+				return
+			}
+		}
+
+		if exportCmdFormat == "pkcs12" {
+			password, err := pkcs12Password(exportCmdOutput, exportCmdPassword, true)
+			if err != nil {
+				return err
+			}
+			pfx, err := geneos.EncodePKCS12(cert, key, chain, password)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(exportCmdOutput, pfx, 0600)
 		}
 
 		var pembytes []byte
 
-		pembytes = pem.EncodeToMemory(&pem.Block{
-			Type:  "CERTIFICATE",
-			Bytes: signer.Raw,
-		})
+		if cert != nil {
+			pembytes = pem.EncodeToMemory(&pem.Block{
+				Type:  "CERTIFICATE",
+				Bytes: cert.Raw,
+			})
+		}
 
-		if !exportCmdNoRoot {
+		for _, c := range chain {
 			pembytes = append(pembytes, pem.EncodeToMemory(&pem.Block{
 				Type:  "CERTIFICATE",
-				Bytes: root.Raw,
+				Bytes: c.Raw,
 			})...)
 		}
 
-		l, _ := signingKey.Open()
-		pembytes = append(pembytes, pem.EncodeToMemory(&pem.Block{
-			Type:  "PRIVATE KEY",
-			Bytes: l.Bytes(),
-		})...)
-		l.Destroy()
+		if key != nil {
+			l, _ := key.Open()
+			pembytes = append(pembytes, pem.EncodeToMemory(&pem.Block{
+				Type:  "PRIVATE KEY",
+				Bytes: l.Bytes(),
+			})...)
+			l.Destroy()
+		}
 
 		if exportCmdOutput != "" {
 			return os.WriteFile(exportCmdOutput, pembytes, 0600)
@@ -110,3 +147,60 @@ $ geneos tls export --output file.pem
 		return
 	},
 }
+
+// exportSigner returns the local signing certificate and key and, unless
+// `--no-root` is given, the root certificate as the chain
+func exportSigner() (cert *x509.Certificate, key *memguard.Enclave, chain []*x509.Certificate, err error) {
+	confDir := config.AppConfigDir()
+	if confDir == "" {
+		err = config.ErrNoUserConfigDir
+		return
+	}
+	// gather the rootCA cert, the geneos cert and key
+	root, rootFile, err := geneos.ReadRootCert(true)
+	if err != nil {
+		err = fmt.Errorf("local root certificate (%s) not valid: %w", rootFile, err)
+		return
+	}
+	cert, signerFile, err := geneos.ReadSigningCert(true)
+	if err != nil {
+		err = fmt.Errorf("local signing root certificate (%s) not valid: %w", signerFile, err)
+		return
+	}
+	key, err = config.ReadPrivateKey(geneos.LOCAL, path.Join(confDir, geneos.SigningCertBasename+".key"))
+	if err != nil {
+		return
+	}
+	if !exportCmdNoRoot {
+		chain = append(chain, root)
+	}
+	return
+}
+
+// exportInstance returns the certificate, key and chain of the single
+// instance matching ct and names
+func exportInstance(ct *geneos.Component, names []string) (cert *x509.Certificate, key *memguard.Enclave, chain []*x509.Certificate, err error) {
+	instances := instance.Instances(geneos.GetHost(cmd.Hostname), ct, instance.FilterNames(names...))
+	if len(instances) != 1 {
+		err = fmt.Errorf("%d instances match, exactly one is required (%w)", len(instances), geneos.ErrInvalidArgs)
+		return
+	}
+	i := instances[0]
+
+	cert, _, chainfile, err := instance.ReadCert(i)
+	if err != nil {
+		err = fmt.Errorf("%s: %w", i, err)
+		return
+	}
+	if key, err = instance.ReadKey(i); err != nil {
+		err = fmt.Errorf("%s: %w", i, err)
+		return
+	}
+	for _, c := range config.ReadCertificates(i.Host(), chainfile) {
+		if exportCmdNoRoot && c.IsCA && c.CheckSignatureFrom(c) == nil {
+			continue
+		}
+		chain = append(chain, c)
+	}
+	return
+}
@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"strings"
 
 	"github.com/awnumar/memguard"
 	"github.com/rs/zerolog/log"
@@ -36,13 +37,18 @@ import (
 	"github.com/itrs-group/cordial/tools/geneos/internal/instance"
 )
 
-var importCmdCert, importCmdSigningBundle, importCmdChain, importCmdPrivateKey string
+var importCmdCert, importCmdSigningBundle, importCmdChain, importCmdPrivateKey, importCmdFormat string
+var importCmdPassword *config.Plaintext
 
 func init() {
 	tlsCmd.AddCommand(importCmd)
 
-	importCmd.Flags().StringVarP(&importCmdCert, "instance-bundle", "c", "", "Instance certificate bundle to import, PEM format")
-	importCmd.Flags().StringVarP(&importCmdSigningBundle, "signing-bundle", "C", "", "Signing certificate bundle to import, PEM format")
+	importCmdPassword = &config.Plaintext{}
+
+	importCmd.Flags().StringVarP(&importCmdCert, "instance-bundle", "c", "", "Instance certificate bundle to import, PEM or PKCS#12 format")
+	importCmd.Flags().StringVarP(&importCmdSigningBundle, "signing-bundle", "C", "", "Signing certificate bundle to import, PEM or PKCS#12 format")
+	importCmd.Flags().StringVarP(&importCmdFormat, "format", "f", "", "Input `FORMAT`, one of pem or pkcs12 (default detected from the file)")
+	importCmd.Flags().VarP(importCmdPassword, "password", "p", "Password for pkcs12 input")
 
 	importCmd.Flags().StringVarP(&importCmdPrivateKey, "key", "k", "", "Private key `file` for certificate, PEM format")
 	importCmd.Flags().MarkDeprecated("key", "include the private key in either the instance or signing bundles")
@@ -79,6 +85,7 @@ var importCmd = &cobra.Command{
 	Example: `
 $ geneos tls import -c netprobe localhost file.pem
 $ geneos tls import --signing-bundle file.pem
+$ geneos tls import -c netprobe localhost file.pfx
 `,
 	Annotations: map[string]string{
 		cmd.CmdGlobal:      "false",
@@ -87,20 +94,25 @@ $ geneos tls import --signing-bundle file.pem
 	RunE: func(command *cobra.Command, _ []string) (err error) {
 		ct, names := cmd.ParseTypeNames(command)
 
-		if importCmdSigningBundle != "" {
-			return geneos.TLSImportBundle(importCmdSigningBundle, importCmdPrivateKey, importCmdChain)
+		if err = checkFormat(importCmdFormat, true); err != nil {
+			return
 		}
 
-		if importCmdCert != "" {
-			certs, err := config.ReadInputPEMString(importCmdCert, "instance certificate(s)")
+		if importCmdSigningBundle != "" {
+			c, k, chain, err := importBundle(importCmdSigningBundle, importCmdPrivateKey, "signing")
 			if err != nil {
 				return err
 			}
-			key, err := config.ReadInputPEMString(importCmdPrivateKey, "instance key")
-			if err != nil {
-				return err
+			if importCmdChain != "" {
+				if _, _, chain, err = importBundle(importCmdChain, "", "chain"); err != nil {
+					return err
+				}
 			}
-			c, k, chain, err := geneos.DecomposePEM(certs, key)
+			return geneos.TLSImportSigningCert(c, k, chain)
+		}
+
+		if importCmdCert != "" {
+			c, k, chain, err := importBundle(importCmdCert, importCmdPrivateKey, "instance")
 			if err != nil {
 				return err
 			}
@@ -112,15 +124,11 @@ $ geneos tls import --signing-bundle file.pem
 			return
 		}
 
-		b, err := os.ReadFile(importCmdChain)
+		_, _, chain, err := importBundle(importCmdChain, "", "chain")
 		if err != nil {
 			log.Error().Err(err).Msg("")
 			return err
 		}
-		_, _, chain, err := geneos.DecomposePEM(string(b))
-		if err != nil {
-			return err
-		}
 		if err = geneos.WriteChainLocal(chain); err != nil {
 			return err
 		}
@@ -130,6 +138,40 @@ $ geneos tls import --signing-bundle file.pem
 	},
 }
 
+// importBundle reads and decomposes the certificates and private key
+// from source, which is either PEM or PKCS#12 format. The format is
+// detected unless set with `--format`. A separate PEM private key can
+// be given as keySource, except for PKCS#12 bundles. prompt is used to
+// describe the input when it is read from the console.
+func importBundle(source, keySource, prompt string) (cert *x509.Certificate, key *memguard.Enclave, chain []*x509.Certificate, err error) {
+	if importCmdFormat != "pem" && source != "-" && !strings.HasPrefix(source, "pem:") {
+		data, err := os.ReadFile(source)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if importCmdFormat == "pkcs12" || geneos.IsPKCS12(data) {
+			if keySource != "" {
+				log.Warn().Msgf("ignoring separate private key for PKCS#12 bundle %s", source)
+			}
+			password, err := pkcs12Password(source, importCmdPassword, false)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			return geneos.DecomposePKCS12(data, password)
+		}
+	}
+
+	certs, err := config.ReadInputPEMString(source, prompt+" certificate(s)")
+	if err != nil {
+		return
+	}
+	k, err := config.ReadInputPEMString(keySource, prompt+" key")
+	if err != nil {
+		return
+	}
+	return geneos.DecomposePEM(certs, k)
+}
+
 // tlsWriteInstance expects 3 params, of *x509.Certificate,
 // *memguard.Enclave and a []*x509.Certificate or it will return an
 // error or panic.
@@ -47,6 +47,7 @@ type listCertType struct {
 	Expires    time.Time     `json:"expires,omitempty"`
 	CommonName string        `json:"common_name,omitempty"`
 	Valid      bool          `json:"valid,omitempty"`
+	Revoked    *time.Time    `json:"revoked,omitempty"`
 }
 
 type listCertLongType struct {
@@ -62,6 +63,7 @@ type listCertLongType struct {
 	SubAltNames []string      `json:"sans,omitempty"`
 	IPs         []net.IP      `json:"ip_addresses,omitempty"`
 	Signature   string        `json:"signature,omitempty"`
+	Revoked     *time.Time    `json:"revoked,omitempty"`
 }
 
 var listCmdAll, listCmdCSV, listCmdJSON, listCmdIndent, listCmdLong bool
@@ -84,6 +86,7 @@ var listCmdDescription string
 
 var rootCert, geneosCert *x509.Certificate
 var rootCertFile, geneosCertFile string
+var listIssued geneos.Issued
 
 var listCmd = &cobra.Command{
 	Use:          "list [flags] [TYPE] [NAME...]",
@@ -106,6 +109,9 @@ var listCmd = &cobra.Command{
 		if err != nil && !errors.Is(err, os.ErrNotExist) {
 			return
 		}
+		if listIssued, err = geneos.ReadIssued(); err != nil {
+			return
+		}
 
 		if listCmdLong {
 			return listCertsLongCommand(ct, names, params)
@@ -133,6 +139,7 @@ func listCertsCommand(ct *geneos.Component, names []string, _ []string) (err err
 						rootCert.NotAfter,
 						rootCert.Subject.CommonName,
 						verifyCert(rootCert),
+						nil,
 					}}
 			}
 			if geneosCert != nil {
@@ -145,6 +152,7 @@ func listCertsCommand(ct *geneos.Component, names []string, _ []string) (err err
 						geneosCert.NotAfter,
 						geneosCert.Subject.CommonName,
 						verifyCert(geneosCert),
+						nil,
 					}}
 			}
 		}
@@ -160,6 +168,7 @@ func listCertsCommand(ct *geneos.Component, names []string, _ []string) (err err
 			"Expires",
 			"CommonName",
 			"Valid",
+			"Revoked",
 		})
 		if listCmdAll {
 			if rootCert != nil {
@@ -171,6 +180,7 @@ func listCertsCommand(ct *geneos.Component, names []string, _ []string) (err err
 					rootCert.NotAfter.Format(time.RFC3339),
 					rootCert.Subject.CommonName,
 					fmt.Sprint(verifyCert(rootCert)),
+					"",
 				})
 			}
 			if geneosCert != nil {
@@ -182,16 +192,17 @@ func listCertsCommand(ct *geneos.Component, names []string, _ []string) (err err
 					geneosCert.NotAfter.Format(time.RFC3339),
 					geneosCert.Subject.CommonName,
 					fmt.Sprint(verifyCert(geneosCert)),
+					"",
 				})
 			}
 		}
 		instance.Do(geneos.GetHost(cmd.Hostname), ct, names, listCmdInstanceCertCSV).Write(listCSVWriter)
 	default:
 		listTabWriter := tabwriter.NewWriter(os.Stdout, 3, 8, 2, ' ', 0)
-		fmt.Fprintln(listTabWriter, "Type\tName\tHost\tRemaining\tExpires\tCommonName\tValid")
+		fmt.Fprintln(listTabWriter, "Type\tName\tHost\tRemaining\tExpires\tCommonName\tValid\tRevoked")
 		if listCmdAll {
 			if rootCert != nil {
-				fmt.Fprintf(listTabWriter, "global\t%s\t%s\t%.f\t%q\t%q\t%v\n",
+				fmt.Fprintf(listTabWriter, "global\t%s\t%s\t%.f\t%q\t%q\t%v\t\n",
 					geneos.RootCABasename,
 					geneos.LOCALHOST,
 					time.Until(rootCert.NotAfter).Seconds(),
@@ -200,7 +211,7 @@ func listCertsCommand(ct *geneos.Component, names []string, _ []string) (err err
 					verifyCert(rootCert))
 			}
 			if geneosCert != nil {
-				fmt.Fprintf(listTabWriter, "global\t%s\t%s\t%.f\t%q\t%q\t%v\n",
+				fmt.Fprintf(listTabWriter, "global\t%s\t%s\t%.f\t%q\t%q\t%v\t\n",
 					geneos.SigningCertBasename,
 					geneos.LOCALHOST,
 					time.Until(geneosCert.NotAfter).Seconds(),
@@ -239,6 +250,7 @@ func listCertsLongCommand(ct *geneos.Component, names []string, params []string)
 						nil,
 						nil,
 						fmt.Sprintf("%X", sha1.Sum(rootCert.Raw)),
+						nil,
 					}}
 			}
 			if geneosCert != nil {
@@ -256,6 +268,7 @@ func listCertsLongCommand(ct *geneos.Component, names []string, params []string)
 						nil,
 						nil,
 						fmt.Sprintf("%X", sha1.Sum(rootCert.Raw)),
+						nil,
 					}}
 			}
 		}
@@ -275,6 +288,7 @@ func listCertsLongCommand(ct *geneos.Component, names []string, params []string)
 			"SubjAltNames",
 			"IPs",
 			"Signature",
+			"Revoked",
 		})
 		if listCmdAll {
 			if rootCert != nil {
@@ -291,6 +305,7 @@ func listCertsLongCommand(ct *geneos.Component, names []string, params []string)
 					"[]",
 					"[]",
 					fmt.Sprintf("%X", sha1.Sum(rootCert.Raw)),
+					"",
 				})
 			}
 			if geneosCert != nil {
@@ -307,16 +322,17 @@ func listCertsLongCommand(ct *geneos.Component, names []string, params []string)
 					"[]",
 					"[]",
 					fmt.Sprintf("%X", sha1.Sum(geneosCert.Raw)),
+					"",
 				})
 			}
 		}
 		instance.Do(geneos.GetHost(cmd.Hostname), ct, names, listCmdInstanceCertCSV).Write(listCSVWriter)
 	default:
 		listTabWriter := tabwriter.NewWriter(os.Stdout, 3, 8, 2, ' ', 0)
-		fmt.Fprintln(listTabWriter, "Type\tName\tHost\tRemaining\tExpires\tCommonName\tValid\tChainFile\tIssuer\tSubjAltNames\tIPs\tFingerprint")
+		fmt.Fprintln(listTabWriter, "Type\tName\tHost\tRemaining\tExpires\tCommonName\tValid\tChainFile\tIssuer\tSubjAltNames\tIPs\tFingerprint\tRevoked")
 		if listCmdAll {
 			if rootCert != nil {
-				fmt.Fprintf(listTabWriter, "global\t%s\t%s\t%.f\t%q\t%q\t%v\t%q\t%q\t\t\t%X\n",
+				fmt.Fprintf(listTabWriter, "global\t%s\t%s\t%.f\t%q\t%q\t%v\t%q\t%q\t\t\t%X\t\n",
 					geneos.RootCABasename,
 					geneos.LOCALHOST,
 					time.Until(rootCert.NotAfter).Seconds(),
@@ -328,7 +344,7 @@ func listCertsLongCommand(ct *geneos.Component, names []string, params []string)
 					sha1.Sum(rootCert.Raw))
 			}
 			if geneosCert != nil {
-				fmt.Fprintf(listTabWriter, "global\t%s\t%s\t%.f\t%q\t%q\t%v\t%q\t%q\t\t\t%X\n",
+				fmt.Fprintf(listTabWriter, "global\t%s\t%s\t%.f\t%q\t%q\t%v\t%q\t%q\t\t\t%X\t\n",
 					geneos.SigningCertBasename,
 					geneos.LOCALHOST,
 					time.Until(geneosCert.NotAfter).Seconds(),
@@ -359,6 +375,11 @@ func listCmdInstanceCert(i geneos.Instance, _ ...any) (resp *instance.Response)
 		return
 	}
 
+	revoked := geneos.IsRevoked(listIssued, geneosCert, cert)
+	if revoked != nil {
+		valid = false
+	}
+
 	expires := cert.NotAfter
 	resp.Line = fmt.Sprintf("%s\t%s\t%s\t%.f\t%q\t%q\t%v\t", i.Type(), i.Name(), i.Host(), time.Until(expires).Seconds(), expires.Format(time.RFC3339), cert.Subject.CommonName, valid)
 
@@ -372,8 +393,9 @@ func listCmdInstanceCert(i geneos.Instance, _ ...any) (resp *instance.Response)
 		if len(cert.IPAddresses) > 0 {
 			resp.Line += fmt.Sprint(cert.IPAddresses)
 		}
-		resp.Line += fmt.Sprintf("\t%X", sha1.Sum(cert.Raw))
+		resp.Line += fmt.Sprintf("\t%X\t", sha1.Sum(cert.Raw))
 	}
+	resp.Line += revokedString(revoked)
 	return
 }
 
@@ -390,6 +412,11 @@ func listCmdInstanceCertCSV(i geneos.Instance, _ ...any) (resp *instance.Respons
 		return
 	}
 
+	revoked := geneos.IsRevoked(listIssued, geneosCert, cert)
+	if revoked != nil {
+		valid = false
+	}
+
 	expires := cert.NotAfter
 	until := fmt.Sprintf("%.f", time.Until(expires).Seconds())
 	cols := []string{i.Type().String(), i.Name(), i.Host().String(), until, expires.Format(time.RFC3339), cert.Subject.CommonName, fmt.Sprint(valid)}
@@ -400,6 +427,7 @@ func listCmdInstanceCertCSV(i geneos.Instance, _ ...any) (resp *instance.Respons
 		cols = append(cols, fmt.Sprintf("%v", cert.IPAddresses))
 		cols = append(cols, fmt.Sprintf("%X", sha1.Sum(cert.Raw)))
 	}
+	cols = append(cols, revokedString(revoked))
 
 	resp.Rows = append(resp.Rows, cols)
 	return
@@ -418,6 +446,11 @@ func listCmdInstanceCertJSON(i geneos.Instance, _ ...any) (resp *instance.Respon
 		return
 	}
 
+	revoked := geneos.IsRevoked(listIssued, geneosCert, cert)
+	if revoked != nil {
+		valid = false
+	}
+
 	if listCmdLong {
 		resp.Value = listCertLongType{
 			i.Type().String(),
@@ -432,6 +465,7 @@ func listCmdInstanceCertJSON(i geneos.Instance, _ ...any) (resp *instance.Respon
 			cert.DNSNames,
 			cert.IPAddresses,
 			fmt.Sprintf("%X", sha1.Sum(cert.Raw)),
+			revoked,
 		}
 		return
 	}
@@ -443,10 +477,20 @@ func listCmdInstanceCertJSON(i geneos.Instance, _ ...any) (resp *instance.Respon
 		cert.NotAfter,
 		cert.Subject.CommonName,
 		valid,
+		revoked,
 	}
 	return
 }
 
+// revokedString returns the revocation time of a certificate as a
+// string, or an empty string if it has not been revoked
+func revokedString(revoked *time.Time) string {
+	if revoked == nil {
+		return ""
+	}
+	return revoked.Format(time.RFC3339)
+}
+
 // verifyCert checks cert against the global rootCert and geneosCert
 // (initialised in the main RunE()) and if that fails then against
 // system certs. It also loads the Geneos global chain file and adds the
@@ -30,11 +30,15 @@ import (
 )
 
 var newCmdDays int
+var newCmdACME acmeOptions
 
 func init() {
 	tlsCmd.AddCommand(newCmd)
 
 	newCmd.Flags().IntVarP(&newCmdDays, "days", "D", 365, "Certificate duration in days")
+	newCmdACME.flags(newCmd.Flags())
+
+	newCmd.Flags().SortFlags = false
 }
 
 //go:embed _docs/new.md
@@ -57,5 +61,8 @@ var newCmd = &cobra.Command{
 }
 
 func newInstanceCert(i geneos.Instance, _ ...any) *instance.Response {
+	if newCmdACME.directory != "" {
+		return acmeInstanceCert(i, false, &newCmdACME)
+	}
 	return instance.CreateCert(i, 24*time.Hour*time.Duration(newCmdDays))
 }
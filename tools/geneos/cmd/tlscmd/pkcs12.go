@@ -0,0 +1,67 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tlscmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/itrs-group/cordial"
+	"github.com/itrs-group/cordial/pkg/config"
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+)
+
+// pkcs12Password returns the password for the PKCS#12 file. If password
+// is set, from a command line flag, then that is used, otherwise the
+// password from any credentials that match the file path. If neither is
+// found then the user is prompted, twice if confirm is true.
+func pkcs12Password(file string, password *config.Plaintext, confirm bool) (pw *config.Plaintext, err error) {
+	if !password.IsNil() && password.Size() > 0 {
+		return password, nil
+	}
+
+	if creds := config.FindCreds(file, config.SetAppName(cordial.ExecutableName())); creds != nil {
+		if pw = creds.GetPassword("password"); !pw.IsNil() {
+			return
+		}
+	}
+
+	prompt := []string{"PKCS#12 password for " + file}
+	if confirm {
+		prompt = append(prompt, "Re-enter PKCS#12 password")
+	}
+	pw, err = config.ReadPasswordInput(confirm, 0, prompt...)
+	if errors.Is(err, config.ErrNotInteractive) {
+		err = fmt.Errorf("%w and password required for %s", err, file)
+	}
+	return
+}
+
+// checkFormat returns an error if format is not one of the supported
+// formats. An empty format is allowed when allowEmpty is true.
+func checkFormat(format string, allowEmpty bool) error {
+	switch format {
+	case "pem", "pkcs12":
+		return nil
+	case "":
+		if allowEmpty {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported format %q, must be one of pem or pkcs12 (%w)", format, geneos.ErrInvalidArgs)
+}
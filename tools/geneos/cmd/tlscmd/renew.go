@@ -36,11 +36,15 @@ import (
 )
 
 var renewCmdDays int
+var renewCmdACME acmeOptions
 
 func init() {
 	tlsCmd.AddCommand(renewCmd)
 
 	renewCmd.Flags().IntVarP(&renewCmdDays, "days", "D", 365, "Certificate duration in days")
+	renewCmdACME.flags(renewCmd.Flags())
+
+	renewCmd.Flags().SortFlags = false
 }
 
 //go:embed _docs/renew.md
@@ -64,6 +68,17 @@ var renewCmd = &cobra.Command{
 
 // renew an instance certificate, reuse private key if it exists
 func renewInstanceCert(i geneos.Instance, _ ...any) (resp *instance.Response) {
+	return renewCert(i, renewCmdDays, &renewCmdACME)
+}
+
+// renewCert renews the certificate of instance i for days, or from the
+// ACME server in a if one is given, reusing the private key if it
+// exists
+func renewCert(i geneos.Instance, days int, a *acmeOptions) (resp *instance.Response) {
+	if a.directory != "" {
+		return acmeInstanceCert(i, true, a)
+	}
+
 	resp = instance.NewResponse(i)
 
 	confDir := config.AppConfigDir()
@@ -93,8 +108,8 @@ func renewInstanceCert(i geneos.Instance, _ ...any) (resp *instance.Response) {
 		return
 	}
 	duration := 365 * 24 * time.Hour
-	if renewCmdDays != 0 {
-		duration = 24 * time.Hour * time.Duration(renewCmdDays)
+	if days != 0 {
+		duration = 24 * time.Hour * time.Duration(days)
 	}
 	expires := time.Now().Add(duration)
 	template := x509.Certificate{
@@ -122,6 +137,7 @@ func renewInstanceCert(i geneos.Instance, _ ...any) (resp *instance.Response) {
 	if resp.Err = instance.WriteCert(i, cert); resp.Err != nil {
 		return
 	}
+	geneos.RecordIssued(signingCert, cert, i.String(), i.Host().String())
 
 	if existingKey == nil {
 		if resp.Err = instance.WriteKey(i, key); resp.Err != nil {
@@ -0,0 +1,169 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tlscmd
+
+import (
+	_ "embed"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/itrs-group/cordial/tools/geneos/cmd"
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+	"github.com/itrs-group/cordial/tools/geneos/internal/instance"
+)
+
+var revokeCmdSerials []string
+var revokeCmdOnHost, revokeCmdReason string
+var revokeCmdNoCRL bool
+
+func init() {
+	tlsCmd.AddCommand(revokeCmd)
+
+	revokeCmd.Flags().StringArrayVarP(&revokeCmdSerials, "serial", "s", nil, "Revoke the certificate with serial number `HEX`, repeat as required")
+	revokeCmd.Flags().StringVar(&revokeCmdOnHost, "on-host", "", "Revoke all certificates issued to instances on host `NAME`")
+	revokeCmd.Flags().StringVarP(&revokeCmdReason, "reason", "r", "unspecified", "Revocation `REASON`")
+	revokeCmd.Flags().BoolVar(&revokeCmdNoCRL, "no-crl", false, "Do not create and distribute a new CRL")
+	revokeCmd.Flags().IntVarP(&crlCmdDays, "days", "D", 30, "CRL validity in days")
+
+	revokeCmd.Flags().SortFlags = false
+}
+
+//go:embed _docs/revoke.md
+var revokeCmdDescription string
+
+var revokeCmd = &cobra.Command{
+	Use:   "revoke [flags] [TYPE] [NAME...]",
+	Short: "Revoke certificates issued by the signing certificate",
+	Long:  revokeCmdDescription,
+	Example: strings.ReplaceAll(`
+geneos tls revoke gateway example1 --reason keyCompromise
+geneos tls revoke --serial 7A3F19C2D4E5B601
+geneos tls revoke --on-host oldserver --reason cessationOfOperation
+`, "|", "`"),
+	SilenceUsage: true,
+	Annotations: map[string]string{
+		cmd.CmdGlobal:        "true",
+		cmd.CmdRequireHome:   "true",
+		cmd.CmdWildcardNames: "true",
+	},
+	RunE: func(command *cobra.Command, args []string) (err error) {
+		ct, names := cmd.ParseTypeNames(command)
+
+		reason, ok := geneos.RevocationReasons[revokeCmdReason]
+		if !ok {
+			return fmt.Errorf("unknown reason %q, must be one of %s (%w)", revokeCmdReason, strings.Join(slices.Sorted(maps.Keys(geneos.RevocationReasons)), ", "), geneos.ErrInvalidArgs)
+		}
+
+		if crlCmdDays < 1 {
+			return fmt.Errorf("--days must be at least 1 (%w)", geneos.ErrInvalidArgs)
+		}
+
+		// no arguments would otherwise mean all instances
+		if len(args) == 0 && len(revokeCmdSerials) == 0 && revokeCmdOnHost == "" {
+			return fmt.Errorf("%w: give instance names, --serial or --on-host", geneos.ErrInvalidArgs)
+		}
+
+		revoked := false
+
+		if len(revokeCmdSerials) > 0 || revokeCmdOnHost != "" {
+			serials := map[string]bool{}
+			for _, s := range revokeCmdSerials {
+				serials[strings.ToUpper(strings.ReplaceAll(s, ":", ""))] = true
+			}
+			certs, err := geneos.Revoke(func(c geneos.IssuedCert) bool {
+				return serials[c.Serial] || (revokeCmdOnHost != "" && c.Host == revokeCmdOnHost)
+			}, reason)
+			if err != nil {
+				return err
+			}
+			for _, c := range certs {
+				delete(serials, c.Serial)
+				fmt.Printf("certificate %s (%s) revoked\n", c.Serial, c.Subject)
+				revoked = true
+			}
+			for _, s := range slices.Sorted(maps.Keys(serials)) {
+				fmt.Printf("certificate %s not found, expired or already revoked\n", s)
+			}
+		}
+
+		if len(args) > 0 {
+			responses := instance.Do(geneos.GetHost(cmd.Hostname), ct, names, revokeInstanceCert, reason)
+			for _, r := range responses {
+				if r.Err == nil && len(r.Completed) > 0 {
+					revoked = true
+				}
+			}
+			responses.Write(os.Stdout)
+		}
+
+		if !revoked || revokeCmdNoCRL {
+			return
+		}
+		crl, err := geneos.CreateCRL(24 * time.Hour * time.Duration(crlCmdDays))
+		if err != nil {
+			return
+		}
+		return geneos.TLSSyncCRL(crl)
+	},
+}
+
+// revokeInstanceCert revokes the current certificate of instance i.
+// The reason is passed as the first value in params.
+func revokeInstanceCert(i geneos.Instance, params ...any) (resp *instance.Response) {
+	resp = instance.NewResponse(i)
+
+	if len(params) == 0 {
+		resp.Err = geneos.ErrInvalidArgs
+		return
+	}
+	reason, ok := params[0].(int)
+	if !ok {
+		resp.Err = geneos.ErrInvalidArgs
+		return
+	}
+
+	cert, _, _, _ := instance.ReadCert(i)
+	if cert == nil {
+		// no certificate is not an error
+		return
+	}
+
+	signingCert, _, err := geneos.ReadSigningCert()
+	if err != nil {
+		resp.Err = err
+		return
+	}
+
+	ok, err = geneos.RevokeCert(signingCert, cert, i.String(), i.Host().String(), reason)
+	if err != nil {
+		resp.Err = err
+		return
+	}
+	if !ok {
+		resp.Line = fmt.Sprintf("certificate %s already revoked", geneos.SerialString(cert))
+		return
+	}
+	resp.Completed = append(resp.Completed, fmt.Sprintf("certificate %s revoked", geneos.SerialString(cert)))
+	return
+}
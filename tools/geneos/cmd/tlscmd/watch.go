@@ -0,0 +1,253 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tlscmd
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/itrs-group/cordial"
+	"github.com/itrs-group/cordial/tools/geneos/cmd"
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+	"github.com/itrs-group/cordial/tools/geneos/internal/instance"
+)
+
+var watchCmdWindow, watchCmdDays int
+var watchCmdInterval time.Duration
+var watchCmdOnce, watchCmdRestart bool
+var watchCmdWebhook string
+var watchCmdACME acmeOptions
+
+func init() {
+	tlsCmd.AddCommand(watchCmd)
+
+	watchCmd.Flags().IntVarP(&watchCmdWindow, "window", "W", 30, "Renew certificates that expire within `DAYS` days")
+	watchCmd.Flags().IntVarP(&watchCmdDays, "days", "D", 365, "Certificate duration in days")
+	watchCmd.Flags().DurationVarP(&watchCmdInterval, "interval", "i", 12*time.Hour, "Time between scans")
+	watchCmd.Flags().BoolVar(&watchCmdOnce, "once", false, "Scan once and exit, e.g. when run from cron")
+	watchCmd.Flags().BoolVarP(&watchCmdRestart, "restart", "R", false, "Restart running instances that do not support reload")
+	watchCmd.Flags().StringVar(&watchCmdWebhook, "webhook", "", "POST a JSON report of each scan that takes action to `URL`")
+	watchCmdACME.flags(watchCmd.Flags())
+
+	watchCmd.Flags().SortFlags = false
+}
+
+//go:embed _docs/watch.md
+var watchCmdDescription string
+
+var watchCmd = &cobra.Command{
+	Use:   "watch [flags] [TYPE] [NAME...]",
+	Short: "Renew instance certificates before they expire",
+	Long:  watchCmdDescription,
+	Example: strings.ReplaceAll(`
+geneos tls watch
+geneos tls watch --once --window 14 netprobe
+geneos tls watch --restart --webhook https://hooks.example.com/geneos
+`, "|", "`"),
+	SilenceUsage: true,
+	Annotations: map[string]string{
+		cmd.CmdGlobal:        "true",
+		cmd.CmdRequireHome:   "true",
+		cmd.CmdWildcardNames: "true",
+	},
+	RunE: func(command *cobra.Command, _ []string) (err error) {
+		ct, names := cmd.ParseTypeNames(command)
+		h := geneos.GetHost(cmd.Hostname)
+
+		if watchCmdWindow < 1 {
+			return fmt.Errorf("--window must be at least 1 day (%w)", geneos.ErrInvalidArgs)
+		}
+		if !watchCmdOnce && watchCmdInterval < time.Minute {
+			return fmt.Errorf("--interval must be at least one minute (%w)", geneos.ErrInvalidArgs)
+		}
+
+		for {
+			responses := watchScan(h, ct, names)
+			responses.Write(os.Stdout)
+			if watchCmdWebhook != "" && len(responses) > 0 {
+				if err := watchPost(watchCmdWebhook, responses); err != nil {
+					log.Error().Err(err).Msgf("cannot post report to %s", watchCmdWebhook)
+				}
+			}
+			if watchCmdOnce {
+				return nil
+			}
+			log.Debug().Msgf("next scan at %s", time.Now().Add(watchCmdInterval).Format(time.RFC3339))
+			time.Sleep(watchCmdInterval)
+		}
+	},
+}
+
+// watchScan renews the certificates of matching instances that expire
+// within the window, re-syncs the chain files on remote hosts and then
+// reloads, or optionally restarts, the running instances that were
+// renewed. Only instances where action was taken, or that failed, are
+// included in the responses.
+func watchScan(h *geneos.Host, ct *geneos.Component, names []string) (responses instance.Responses) {
+	responses = instance.Do(h, ct, names, watchRenew)
+	maps.DeleteFunc(responses, func(_ string, r *instance.Response) bool {
+		return r.Err == nil && len(r.Completed) == 0
+	})
+
+	renewed := false
+	for _, r := range responses {
+		if r.Err == nil {
+			renewed = true
+		}
+	}
+	if !renewed {
+		return
+	}
+
+	if err := geneos.TLSSync(); err != nil {
+		log.Error().Err(err).Msg("cannot sync certificate chain files")
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(responses)) {
+		r := responses[k]
+		if r.Err != nil {
+			continue
+		}
+		resp := watchReload(r.Instance)
+		resp.Finish = time.Now()
+		responses[k] = instance.MergeResponse(r, resp)
+	}
+	return
+}
+
+// watchRenew renews the certificate of instance i if it expires within
+// the window. Instances without certificates are ignored.
+func watchRenew(i geneos.Instance, _ ...any) (resp *instance.Response) {
+	resp = instance.NewResponse(i)
+
+	cert, _, _, err := instance.ReadCert(i)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Debug().Err(err).Msgf("%s: cannot read certificate", i)
+		}
+		return
+	}
+
+	if time.Until(cert.NotAfter) > 24*time.Hour*time.Duration(watchCmdWindow) {
+		log.Debug().Msgf("%s: certificate expires %s, not renewing", i, cert.NotAfter.Format(time.RFC3339))
+		return
+	}
+
+	return renewCert(i, watchCmdDays, &watchCmdACME)
+}
+
+// watchReload tells a running instance i to reload its certificate. If
+// the component does not support reload then the instance is restarted
+// if `--restart` is given.
+func watchReload(i geneos.Instance) (resp *instance.Response) {
+	resp = instance.NewResponse(i)
+
+	if !instance.IsRunning(i) {
+		return
+	}
+
+	err := i.Reload()
+	switch {
+	case err == nil:
+		resp.Completed = append(resp.Completed, "reload signal sent")
+	case errors.Is(err, geneos.ErrNotSupported) && watchCmdRestart:
+		if resp.Err = instance.Stop(i, false, false); resp.Err != nil {
+			return
+		}
+		if resp.Err = instance.Start(i); resp.Err != nil {
+			return
+		}
+		resp.Completed = append(resp.Completed, "restarted")
+	case errors.Is(err, geneos.ErrNotSupported):
+		resp.Line = "reload not supported, restart the instance to use the new certificate"
+	default:
+		resp.Err = err
+	}
+	return
+}
+
+// watchReport is the JSON body posted to the webhook for each instance
+type watchReport struct {
+	Time      time.Time `json:"time"`
+	Host      string    `json:"host"`
+	Type      string    `json:"type"`
+	Name      string    `json:"name"`
+	Completed []string  `json:"completed,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// watchPost sends the responses from a scan to the webhook URL as a
+// JSON array
+func watchPost(url string, responses instance.Responses) (err error) {
+	reports := []watchReport{}
+	for _, k := range slices.Sorted(maps.Keys(responses)) {
+		r := responses[k]
+		report := watchReport{
+			Time:      r.Finish.UTC(),
+			Host:      r.Instance.Host().String(),
+			Type:      r.Instance.Type().String(),
+			Name:      r.Instance.Name(),
+			Completed: r.Completed,
+			Message:   strings.Join(append([]string{r.Line}, r.Lines...), "\n"),
+		}
+		report.Message = strings.TrimSpace(report.Message)
+		if r.Err != nil {
+			report.Error = r.Err.Error()
+		}
+		reports = append(reports, report)
+	}
+
+	body, err := json.Marshal(reports)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", cordial.ExecutableName()+"/"+cordial.VERSION)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return
+}
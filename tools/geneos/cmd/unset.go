@@ -43,6 +43,7 @@ func init() {
 	unsetCmd.Flags().VarP(&unsetCmdValues.Attributes, "attribute", "a", "Remove the attribute `NAME`\n(Repeat as required, san only)")
 	unsetCmd.Flags().VarP(&unsetCmdValues.Types, "type", "t", "Remove the type `NAME`\n(Repeat as required, san only)")
 	unsetCmd.Flags().VarP(&unsetCmdValues.Variables, "variable", "v", "Remove the variable `NAME`\n(Repeat as required, san only)")
+	unsetCmd.Flags().VarP(&unsetCmdValues.Labels, "label", "L", "Remove the label `KEY`\n(Repeat as required)")
 
 	unsetCmd.Flags().SortFlags = false
 }
@@ -58,6 +59,7 @@ var unsetCmd = &cobra.Command{
 	Example: strings.ReplaceAll(`
 geneos unset gateway GW1 -k aesfile
 geneos unset san -g Gateway1
+geneos unset gateway GW1 -L tier
 `, "|", "`"),
 	SilenceUsage:          true,
 	DisableFlagsInUseLine: true,
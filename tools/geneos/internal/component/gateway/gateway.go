@@ -65,6 +65,9 @@ var Gateway = geneos.Component{
 	PortRange: config.Join(Name, "ports"),
 	CleanList: config.Join(Name, "clean"),
 	PurgeList: config.Join(Name, "purge"),
+
+	StartOrder: 20,
+
 	ConfigAliases: map[string]string{
 		config.Join(Name, "ports"): Name + "portrange",
 		config.Join(Name, "clean"): Name + "cleanlist",
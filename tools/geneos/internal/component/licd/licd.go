@@ -51,6 +51,9 @@ var Licd = geneos.Component{
 	PortRange: config.Join(Name, "ports"),
 	CleanList: config.Join(Name, "clean"),
 	PurgeList: config.Join(Name, "purge"),
+
+	StartOrder: 10,
+
 	ConfigAliases: map[string]string{
 		config.Join(Name, "ports"): Name + "portrange",
 		config.Join(Name, "clean"): Name + "cleanlist",
@@ -22,7 +22,9 @@ import (
 	"archive/zip"
 	"bytes"
 	"compress/gzip"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -32,6 +34,7 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
 	"slices"
 	"strings"
@@ -74,6 +77,13 @@ func openArchive(ct *Component, options ...PackageOptions) (body io.ReadCloser,
 		body, filename, filesize, err = openSourceFile(opts.localArchive, options...)
 		if err == nil {
 			log.Debug().Msgf("source opened, returning")
+			if f, ok := body.(*os.File); ok && f != os.Stdin {
+				if err = verifyArchive(f, path.Dir(filepath.ToSlash(f.Name())), filename, opts); err != nil {
+					body.Close()
+				}
+				return
+			}
+			body, err = verifyStream(body, "", filename, opts)
 			return
 		} else if !errors.Is(err, ErrIsADirectory) {
 			// if success or the error indicates it's a directory,
@@ -118,6 +128,10 @@ func openArchive(ct *Component, options ...PackageOptions) (body io.ReadCloser,
 			err = fmt.Errorf("local installation selected but no suitable file found for %s (%w)", ct, err)
 			return
 		}
+		if err = verifyArchive(f, opts.localArchive, filename, opts); err != nil {
+			f.Close()
+			return
+		}
 		body = f
 
 		var s fs.FileInfo
@@ -138,9 +152,13 @@ func openArchive(ct *Component, options ...PackageOptions) (body io.ReadCloser,
 	s, err := LOCAL.Stat(archivePath)
 	if err == nil && s.Size() == resp.ContentLength {
 		if f, err := LOCAL.Open(archivePath); err == nil {
-			log.Debug().Msgf("not downloading, file with same size already exists: %s", archivePath)
-			resp.Body.Close()
-			return f, filename, -1, nil
+			if err = verifyArchive(f, opts.localArchive, filename, opts); err == nil {
+				log.Debug().Msgf("not downloading, file with same size already exists: %s", archivePath)
+				resp.Body.Close()
+				return f, filename, -1, nil
+			}
+			f.Close()
+			log.Warn().Err(err).Msgf("existing archive %s failed verification, downloading again", archivePath)
 		}
 	}
 
@@ -148,8 +166,15 @@ func openArchive(ct *Component, options ...PackageOptions) (body io.ReadCloser,
 
 	// transient download
 	if opts.nosave {
-		err = nil
-		body = resp.Body
+		body, err = verifyStream(resp.Body, opts.localArchive, filename, opts)
+		return
+	}
+
+	// look up the expected checksum before overwriting any existing
+	// archive, which may have a sidecar checksum file
+	expected, err := checksumFor(opts.localArchive, filename, opts)
+	if err != nil && (!errors.Is(err, ErrNoChecksum) || opts.requireChecksum) {
+		resp.Body.Close()
 		return
 	}
 
@@ -161,9 +186,27 @@ func openArchive(ct *Component, options ...PackageOptions) (body io.ReadCloser,
 	}
 	bar, isterm := getbar(os.Stdout, filename, resp.ContentLength)
 
-	if _, err = io.Copy(io.MultiWriter(w, bar), resp.Body); err != nil {
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, bar, hash), resp.Body)
+	resp.Body.Close()
+	if err == nil && resp.ContentLength > 0 && n != resp.ContentLength {
+		err = fmt.Errorf("%s: incomplete download, %d of %d bytes", filename, n, resp.ContentLength)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if err == nil && expected != "" && sum != expected {
+		err = fmt.Errorf("%s: %w (expected %s, got %s)", filename, ErrChecksum, expected, sum)
+	}
+	if err != nil {
+		w.Close()
+		LOCAL.Remove(archivePath)
 		return
 	}
+	if expected == "" {
+		// record the checksum so later corruption can be detected
+		if err := recordChecksum(opts.localArchive, filename, sum); err != nil {
+			log.Warn().Err(err).Msg("cannot record checksum")
+		}
+	}
 
 	defer func() {
 		if !isterm {
@@ -276,6 +319,9 @@ func unarchive(h *Host, ct *Component, archive io.Reader, filename string, files
 		stripFirstDir = nil
 	}
 
+	// checksums of unpacked files, for `package verify`
+	sums := Checksums{}
+
 	switch suffix {
 	case "tar.gz", "gz", "tgz":
 		var gziplen uint32
@@ -299,17 +345,27 @@ func unarchive(h *Host, ct *Component, archive io.Reader, filename string, files
 		t, err = gzip.NewReader(archive)
 		if err != nil {
 			// cannot gunzip file
+			h.RemoveAll(basedir)
 			return
 		}
 		defer t.Close()
 		t.Multistream(false)
 
-		if err = untar(h, basedir, t, int64(gziplen), stripFirstDir); err != nil {
+		if err = untar(h, basedir, t, int64(gziplen), stripFirstDir, sums); err != nil {
+			h.RemoveAll(basedir)
+			return
+		}
+
+		// read any trailing data so that streamed archives are
+		// checksummed in full
+		if _, err = io.Copy(io.Discard, archive); err != nil {
+			h.RemoveAll(basedir)
 			return
 		}
 
 	case "zip":
-		if err = unzip(h, basedir, archive, filesize, stripFirstDir); err != nil {
+		if err = unzip(h, basedir, archive, filesize, stripFirstDir, sums); err != nil {
+			h.RemoveAll(basedir)
 			return
 		}
 
@@ -318,6 +374,10 @@ func unarchive(h *Host, ct *Component, archive io.Reader, filename string, files
 		return
 	}
 
+	if err = writeTreeChecksums(h, basedir, sums); err != nil {
+		log.Warn().Err(err).Msgf("cannot write checksums for %s", h.HostPath(basedir))
+	}
+
 	fmt.Printf("installed %q to %q\n", filename, h.HostPath(basedir))
 
 	// only create a new base link, not overwrite
@@ -340,13 +400,13 @@ func unarchive(h *Host, ct *Component, archive io.Reader, filename string, files
 
 }
 
-func unzip(h *Host, basedir string, archive io.Reader, filesize int64, stripPrefix func(string) string) (err error) {
+func unzip(h *Host, basedir string, archive io.Reader, filesize int64, stripPrefix func(string) string, sums Checksums) (err error) {
 	// zip files are read into memory for now
 	var z *zip.Reader
 	var r []byte
 	r, err = io.ReadAll(archive)
 	if err != nil {
-		panic(err)
+		return
 	}
 	b := bytes.NewReader(r)
 	z, err = zip.NewReader(b, int64(len(r)))
@@ -415,7 +475,8 @@ func unzip(h *Host, basedir string, archive io.Reader, filesize int64, stripPref
 		}
 
 		var n int64
-		n, err = io.CopyN(out, c, int64(f.UncompressedSize64))
+		hash := sha256.New()
+		n, err = io.CopyN(io.MultiWriter(out, hash), c, int64(f.UncompressedSize64))
 		if err != nil {
 			out.Close()
 			c.Close()
@@ -427,6 +488,9 @@ func unzip(h *Host, basedir string, archive io.Reader, filesize int64, stripPref
 		}
 		out.Close()
 		c.Close()
+		if sums != nil {
+			sums[name] = hex.EncodeToString(hash.Sum(nil))
+		}
 
 		if err := h.Chtimes(fullpath, time.Time{}, f.Modified); err != nil {
 			log.Debug().Err(err).Msg("cannot update mtime (symlink?)")
@@ -444,8 +508,9 @@ func unzip(h *Host, basedir string, archive io.Reader, filesize int64, stripPref
 }
 
 // untar the archive from an io.Reader onto host h in directory dir.
-// Call stripPrefix for each file to remove configurable prefix
-func untar(h *Host, dir string, tarfile io.Reader, filelen int64, stripPrefix func(string) string) (err error) {
+// Call stripPrefix for each file to remove configurable prefix. If sums
+// is not nil then the checksum of each regular file is added.
+func untar(h *Host, dir string, tarfile io.Reader, filelen int64, stripPrefix func(string) string, sums Checksums) (err error) {
 	var name string
 
 	tr := tar.NewReader(tarfile)
@@ -502,7 +567,8 @@ func untar(h *Host, dir string, tarfile io.Reader, filelen int64, stripPrefix fu
 				return
 			}
 			var n int64
-			n, err = io.Copy(out, tr)
+			hash := sha256.New()
+			n, err = io.Copy(io.MultiWriter(out, hash), tr)
 			if err != nil {
 				out.Close()
 				return
@@ -512,6 +578,9 @@ func untar(h *Host, dir string, tarfile io.Reader, filelen int64, stripPrefix fu
 				log.Error().Msgf("lengths different: %d %d", hdr.Size, n)
 			}
 			out.Close()
+			if sums != nil {
+				sums[name] = hex.EncodeToString(hash.Sum(nil))
+			}
 			if err := h.Chtimes(fullpath, hdr.AccessTime, hdr.ModTime); err != nil {
 				log.Warn().Err(err).Msg("cannot update mtime")
 			}
@@ -0,0 +1,365 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package geneos
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ChecksumFile is the name of the SHA-256 checksum manifest looked for
+// in the same directory as release archives. The format is the same as
+// the output of `sha256sum`.
+const ChecksumFile = "SHA256SUMS"
+
+// ChecksumExtension is the extension added to the path of an installed
+// release directory for the manifest of checksums of the files
+// unpacked into it, e.g. `packages/gateway/7.1.0.sha256`
+const ChecksumExtension = ".sha256"
+
+var (
+	ErrChecksum   = errors.New("checksum mismatch")
+	ErrNoChecksum = errors.New("no checksum found")
+	ErrSignature  = errors.New("signature verification failed")
+)
+
+// Checksums maps file names, without directories for archives or
+// relative to the release directory for installed files, to lowercase
+// hex encoded SHA-256 checksums
+type Checksums map[string]string
+
+var bsdChecksumRE = regexp.MustCompile(`^SHA256 \((.+)\) = ([0-9a-fA-F]{64})$`)
+
+// ParseChecksums parses a checksum manifest in either the GNU
+// `sha256sum` format or the BSD `sha256 -r` tagged format. Lines that
+// are not recognised are ignored.
+func ParseChecksums(data []byte) (sums Checksums) {
+	sums = make(Checksums)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if m := bsdChecksumRE.FindStringSubmatch(line); m != nil {
+			sums[m[1]] = strings.ToLower(m[2])
+			continue
+		}
+		sum, name, ok := strings.Cut(line, " ")
+		if !ok || len(sum) != 64 {
+			continue
+		}
+		if _, err := hex.DecodeString(sum); err != nil {
+			continue
+		}
+		// binary mode marker
+		name = strings.TrimPrefix(strings.TrimLeft(name, " "), "*")
+		sums[name] = strings.ToLower(sum)
+	}
+	return
+}
+
+// Bytes returns the checksums in `sha256sum` format, sorted by name
+func (sums Checksums) Bytes() []byte {
+	var b bytes.Buffer
+	for _, name := range slices.Sorted(maps.Keys(sums)) {
+		fmt.Fprintf(&b, "%s  %s\n", sums[name], name)
+	}
+	return b.Bytes()
+}
+
+// ReadChecksums reads a checksum manifest from source, which can be a
+// local file or a URL. If signature is not empty then it is read in
+// the same way and must be a detached signature of the manifest made
+// with the private key matching the PEM encoded public key in the file
+// or URL pubkey. RSA (PKCS#1 v1.5 with SHA-256), ECDSA (with SHA-256)
+// and Ed25519 keys are supported. The signature can be raw binary or
+// base64 encoded.
+func ReadChecksums(source, signature, pubkey string) (sums Checksums, err error) {
+	data, err := ReadAll(source)
+	if err != nil {
+		return
+	}
+	if signature != "" {
+		if err = verifySignature(data, signature, pubkey); err != nil {
+			return
+		}
+	}
+	return ParseChecksums(data), nil
+}
+
+func verifySignature(data []byte, signature, pubkey string) (err error) {
+	if pubkey == "" {
+		return fmt.Errorf("%w: no public key given", ErrSignature)
+	}
+	sig, err := ReadAll(signature)
+	if err != nil {
+		return
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig))); err == nil {
+		sig = decoded
+	}
+	keydata, err := ReadAll(pubkey)
+	if err != nil {
+		return
+	}
+	p, _ := pem.Decode(keydata)
+	if p == nil {
+		return fmt.Errorf("%w: no PEM public key found in %s", ErrSignature, pubkey)
+	}
+	key, err := x509.ParsePKIXPublicKey(p.Bytes)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSignature, err)
+	}
+
+	digest := sha256.Sum256(data)
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, data, sig) {
+			return ErrSignature
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest[:], sig) {
+			return ErrSignature
+		}
+	case *rsa.PublicKey:
+		if err = rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig); err != nil {
+			return fmt.Errorf("%w: %w", ErrSignature, err)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported public key type %T", ErrSignature, key)
+	}
+	return
+}
+
+// checksumFor returns the expected checksum for the archive filename
+// in the directory dir on the local host. If a checksum manifest was
+// given in the options then that is used, otherwise the ChecksumFile
+// in dir and then a `FILENAME.sha256` file in dir. If there is no
+// checksum then ErrNoChecksum is returned.
+func checksumFor(dir, filename string, opts *packageOptions) (sum string, err error) {
+	if opts.checksums != "" {
+		var sums Checksums
+		if sums, err = ReadChecksums(opts.checksums, opts.signature, opts.pubkey); err != nil {
+			return
+		}
+		if sum, ok := sums[filename]; ok {
+			return sum, nil
+		}
+		return "", fmt.Errorf("%w for %s in %s", ErrNoChecksum, filename, opts.checksums)
+	}
+
+	if opts.signature != "" {
+		return "", fmt.Errorf("%w: a signature requires a checksum manifest", ErrSignature)
+	}
+
+	if dir == "" {
+		return "", fmt.Errorf("%w for %s", ErrNoChecksum, filename)
+	}
+
+	if data, err := LOCAL.ReadFile(path.Join(dir, ChecksumFile)); err == nil {
+		if sum, ok := ParseChecksums(data)[filename]; ok {
+			return sum, nil
+		}
+	}
+
+	if data, err := LOCAL.ReadFile(path.Join(dir, filename+ChecksumExtension)); err == nil {
+		for _, sum := range ParseChecksums(data) {
+			return sum, nil
+		}
+	}
+	return "", fmt.Errorf("%w for %s", ErrNoChecksum, filename)
+}
+
+// recordChecksum adds or replaces the checksum for filename in the
+// ChecksumFile in dir on the local host
+func recordChecksum(dir, filename, sum string) (err error) {
+	file := path.Join(dir, ChecksumFile)
+	sums := Checksums{}
+	if data, err := LOCAL.ReadFile(file); err == nil {
+		sums = ParseChecksums(data)
+	}
+	sums[filename] = sum
+	return LOCAL.WriteFile(file, sums.Bytes(), 0664)
+}
+
+// FileChecksum returns the hex encoded SHA-256 checksum of the file
+// p on host h
+func FileChecksum(h *Host, p string) (sum string, err error) {
+	f, err := h.Open(p)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// verifyArchive checks the contents of the local archive file against
+// the expected checksum, if there is one, and rewinds it. If there is
+// no checksum and the options do not require one then nil is returned.
+func verifyArchive(archive io.ReadSeeker, dir, filename string, opts *packageOptions) (err error) {
+	expected, err := checksumFor(dir, filename, opts)
+	if err != nil {
+		if errors.Is(err, ErrNoChecksum) && !opts.requireChecksum {
+			log.Debug().Err(err).Msg("not verifying")
+			return nil
+		}
+		return
+	}
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, archive); err != nil {
+		return
+	}
+	if _, err = archive.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != expected {
+		return fmt.Errorf("%s: %w (expected %s, got %s)", filename, ErrChecksum, expected, sum)
+	}
+	log.Debug().Msgf("%s: checksum verified", filename)
+	return
+}
+
+// checksumReader wraps an io.ReadCloser and returns an ErrChecksum
+// error instead of io.EOF if the SHA-256 of the data read does not
+// match the expected value. It is used for archives that are streamed
+// and cannot be checked before unpacking.
+type checksumReader struct {
+	io.ReadCloser
+	hash     hash.Hash
+	filename string
+	expected string
+}
+
+func (c *checksumReader) Read(p []byte) (n int, err error) {
+	n, err = c.ReadCloser.Read(p)
+	c.hash.Write(p[:n])
+	if errors.Is(err, io.EOF) {
+		if sum := hex.EncodeToString(c.hash.Sum(nil)); sum != c.expected {
+			err = fmt.Errorf("%s: %w (expected %s, got %s)", c.filename, ErrChecksum, c.expected, sum)
+		}
+	}
+	return
+}
+
+// verifyStream returns body wrapped in a checksumReader if there is an
+// expected checksum for filename, otherwise body itself unless the
+// options require a checksum
+func verifyStream(body io.ReadCloser, dir, filename string, opts *packageOptions) (io.ReadCloser, error) {
+	expected, err := checksumFor(dir, filename, opts)
+	if err != nil {
+		if errors.Is(err, ErrNoChecksum) && !opts.requireChecksum {
+			return body, nil
+		}
+		return body, err
+	}
+	return &checksumReader{ReadCloser: body, hash: sha256.New(), filename: filename, expected: expected}, nil
+}
+
+// writeTreeChecksums writes the checksums of the files unpacked into
+// the release directory dir on host h to the file dir plus
+// ChecksumExtension
+func writeTreeChecksums(h *Host, dir string, sums Checksums) error {
+	return h.WriteFile(dir+ChecksumExtension, sums.Bytes(), 0664)
+}
+
+// VerifyRelease checks the files in the installed release directory
+// dir on host h against the checksums recorded when it was unpacked.
+// It returns the relative paths of files that have changed and that
+// are missing. If there is no recorded manifest then the error is
+// ErrNoChecksum.
+func VerifyRelease(h *Host, dir string) (changed, missing []string, err error) {
+	data, err := h.ReadFile(dir + ChecksumExtension)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = fmt.Errorf("%w for %s", ErrNoChecksum, h.HostPath(dir))
+		}
+		return
+	}
+	sums := ParseChecksums(data)
+	for _, name := range slices.Sorted(maps.Keys(sums)) {
+		sum, err := FileChecksum(h, path.Join(dir, name))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			missing = append(missing, name)
+		case err != nil:
+			return changed, missing, err
+		case sum != sums[name]:
+			changed = append(changed, name)
+		}
+	}
+	return
+}
+
+// VerifyArchives checks all the release archives in the directory dir
+// on the local host against the ChecksumFile in the same directory. It
+// returns a map of archive file names to the result, which is nil for
+// a match, or an error wrapping ErrChecksum or ErrNoChecksum.
+func VerifyArchives(dir string, options ...PackageOptions) (results map[string]error, err error) {
+	opts := evalOptions(options...)
+	ents, err := LOCAL.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	results = make(map[string]error)
+	for _, ent := range ents {
+		name := ent.Name()
+		if ent.IsDir() || name == ChecksumFile || strings.HasSuffix(name, ChecksumExtension) {
+			continue
+		}
+		if !strings.HasSuffix(name, ".tar.gz") && !strings.HasSuffix(name, ".tgz") && !strings.HasSuffix(name, ".zip") {
+			continue
+		}
+		f, err := LOCAL.Open(path.Join(dir, name))
+		if err != nil {
+			results[name] = err
+			continue
+		}
+		o := *opts
+		o.requireChecksum = true
+		results[name] = verifyArchive(f, dir, name, &o)
+		f.Close()
+	}
+	return
+}
@@ -42,6 +42,10 @@ const RootComponentName = "root"
 
 const sharedSuffix = "_shared"
 
+// DefaultStartOrder is the start order tier for components that do not
+// set their own
+const DefaultStartOrder = 30
+
 var RootComponent = Component{
 	Name:         RootComponentName,
 	PackageTypes: nil,
@@ -161,6 +165,12 @@ type Component struct {
 	CleanList string
 	PurgeList string
 
+	// StartOrder is the tier that instances of this component are
+	// started in, lowest first, and they are stopped in the reverse
+	// order. Zero means DefaultStartOrder. Instances can override this
+	// with their own `startorder` setting.
+	StartOrder int
+
 	// ConfigAliases maps new configuration parameters to the original
 	// names, e.g. "netprobe::ports" -> "netprobeportrange"
 	//
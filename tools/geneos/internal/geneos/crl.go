@@ -0,0 +1,343 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package geneos
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"path"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/itrs-group/cordial/pkg/config"
+)
+
+// IssuedFile is the name of the issuance database, in the user's
+// configuration directory alongside the signing certificate, that
+// records every certificate created with the signing certificate
+const IssuedFile = "issued.json"
+
+// CRL revocation reasons, from RFC 5280
+var RevocationReasons = map[string]int{
+	"unspecified":          0,
+	"keyCompromise":        1,
+	"caCompromise":         2,
+	"affiliationChanged":   3,
+	"superseded":           4,
+	"cessationOfOperation": 5,
+}
+
+// IssuedCert is the record of a certificate created with the signing
+// certificate. Issuer identifies the signing certificate, see
+// signerID. Records without an Issuer were created before it was
+// recorded and are treated as issued by the current signing
+// certificate.
+type IssuedCert struct {
+	Serial   string     `json:"serial"`
+	Subject  string     `json:"subject"`
+	Issuer   string     `json:"issuer,omitempty"`
+	Instance string     `json:"instance,omitempty"`
+	Host     string     `json:"host,omitempty"`
+	Issued   time.Time  `json:"issued"`
+	Expires  time.Time  `json:"expires"`
+	Revoked  *time.Time `json:"revoked,omitempty"`
+	Reason   int        `json:"reason,omitempty"`
+}
+
+// Issued is the issuance database
+type Issued struct {
+	// CRLNumber is the number of the last CRL created, incremented for
+	// each new CRL as required by RFC 5280
+	CRLNumber    int64        `json:"crl_number"`
+	Certificates []IssuedCert `json:"certificates"`
+}
+
+var issuedMutex sync.Mutex
+
+// SerialString returns the serial number of cert in the upper case hex
+// form used in the issuance database
+func SerialString(cert *x509.Certificate) string {
+	return fmt.Sprintf("%X", cert.SerialNumber)
+}
+
+// signerID returns the identifier of signer recorded as the Issuer in
+// the issuance database. This is the hex subject key ID of signer, or
+// a SHA-256 hash of the public key if signer has no subject key ID, so
+// that a new signing certificate with a new key has a different ID
+// even if the subject is unchanged.
+func signerID(signer *x509.Certificate) string {
+	if len(signer.SubjectKeyId) > 0 {
+		return fmt.Sprintf("%X", signer.SubjectKeyId)
+	}
+	return fmt.Sprintf("%X", sha256.Sum256(signer.RawSubjectPublicKeyInfo))
+}
+
+// issuedBy returns true if the record c was issued by the signer with
+// the ID given, or has no recorded issuer
+func (c IssuedCert) issuedBy(id string) bool {
+	return c.Issuer == "" || c.Issuer == id
+}
+
+// ReadIssued returns the issuance database. If there is no database
+// then an empty one is returned.
+func ReadIssued() (issued Issued, err error) {
+	confDir := config.AppConfigDir()
+	if confDir == "" {
+		err = config.ErrNoUserConfigDir
+		return
+	}
+	data, err := LOCAL.ReadFile(path.Join(confDir, IssuedFile))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+		return
+	}
+	err = json.Unmarshal(data, &issued)
+	return
+}
+
+func writeIssued(issued Issued) (err error) {
+	confDir := config.AppConfigDir()
+	if confDir == "" {
+		return config.ErrNoUserConfigDir
+	}
+	data, err := json.MarshalIndent(issued, "", "    ")
+	if err != nil {
+		return
+	}
+	return LOCAL.WriteFile(path.Join(confDir, IssuedFile), data, 0600)
+}
+
+// RecordIssued adds cert, issued by signer, to the issuance database.
+// instance and host should be empty for certificates not created for an
+// instance. Errors are logged but otherwise ignored as the certificate
+// has already been created.
+func RecordIssued(signer, cert *x509.Certificate, instance, host string) {
+	issuedMutex.Lock()
+	defer issuedMutex.Unlock()
+
+	issued, err := ReadIssued()
+	if err != nil {
+		log.Error().Err(err).Msg("cannot read certificate issuance database")
+		return
+	}
+	issued.Certificates = append(issued.Certificates, IssuedCert{
+		Serial:   SerialString(cert),
+		Subject:  cert.Subject.String(),
+		Issuer:   signerID(signer),
+		Instance: instance,
+		Host:     host,
+		Issued:   time.Now().UTC(),
+		Expires:  cert.NotAfter.UTC(),
+	})
+	if err = writeIssued(issued); err != nil {
+		log.Error().Err(err).Msg("cannot update certificate issuance database")
+	}
+}
+
+// Revoke marks the unexpired certificates in the issuance database
+// issued by the current signing certificate for which match returns
+// true as revoked with the reason given and returns the newly revoked
+// records. Certificates already revoked are not changed.
+func Revoke(match func(IssuedCert) bool, reason int) (revoked []IssuedCert, err error) {
+	signer, _, err := ReadSigningCert()
+	if err != nil {
+		return
+	}
+	id := signerID(signer)
+
+	issuedMutex.Lock()
+	defer issuedMutex.Unlock()
+
+	issued, err := ReadIssued()
+	if err != nil {
+		return
+	}
+	now := time.Now().UTC()
+	for n, c := range issued.Certificates {
+		if c.Revoked != nil || c.Expires.Before(now) || !c.issuedBy(id) || !match(c) {
+			continue
+		}
+		issued.Certificates[n].Revoked = &now
+		issued.Certificates[n].Reason = reason
+		revoked = append(revoked, issued.Certificates[n])
+	}
+	if len(revoked) == 0 {
+		return
+	}
+	err = writeIssued(issued)
+	return
+}
+
+// RevokeCert marks cert as revoked in the issuance database with the
+// reason given, adding a record if the certificate was created before
+// the database existed. cert must have been issued by signer. revoked is
+// false if cert was already revoked.
+func RevokeCert(signer, cert *x509.Certificate, instance, host string, reason int) (revoked bool, err error) {
+	if signer == nil || !bytes.Equal(cert.RawIssuer, signer.RawSubject) {
+		return false, fmt.Errorf("certificate %q was not issued by the signing certificate", cert.Subject.CommonName)
+	}
+
+	issuedMutex.Lock()
+	defer issuedMutex.Unlock()
+
+	issued, err := ReadIssued()
+	if err != nil {
+		return
+	}
+	serial, id := SerialString(cert), signerID(signer)
+	n := slices.IndexFunc(issued.Certificates, func(c IssuedCert) bool { return c.Serial == serial && c.issuedBy(id) })
+	if n == -1 {
+		issued.Certificates = append(issued.Certificates, IssuedCert{
+			Serial:   serial,
+			Subject:  cert.Subject.String(),
+			Issuer:   id,
+			Instance: instance,
+			Host:     host,
+			Issued:   cert.NotBefore.UTC(),
+			Expires:  cert.NotAfter.UTC(),
+		})
+		n = len(issued.Certificates) - 1
+	}
+	if issued.Certificates[n].Revoked != nil {
+		return
+	}
+	now := time.Now().UTC()
+	issued.Certificates[n].Revoked = &now
+	issued.Certificates[n].Reason = reason
+	if err = writeIssued(issued); err != nil {
+		return
+	}
+	return true, nil
+}
+
+// IsRevoked returns the revocation time if cert is recorded as revoked
+// in the issuance database, otherwise nil. Only certificates issued by
+// the current signing certificate are checked.
+func IsRevoked(issued Issued, signer, cert *x509.Certificate) *time.Time {
+	if signer == nil || !bytes.Equal(cert.RawIssuer, signer.RawSubject) {
+		return nil
+	}
+	serial, id := SerialString(cert), signerID(signer)
+	for _, c := range issued.Certificates {
+		if c.Serial == serial && c.issuedBy(id) && c.Revoked != nil {
+			return c.Revoked
+		}
+	}
+	return nil
+}
+
+// CreateCRL returns a new PEM encoded certificate revocation list of the
+// unexpired revoked certificates in the issuance database, signed by the
+// signing certificate and valid for the duration given. Certificates
+// issued by a previous signing certificate are not included.
+func CreateCRL(validity time.Duration) (crl []byte, err error) {
+	issuedMutex.Lock()
+	defer issuedMutex.Unlock()
+
+	confDir := config.AppConfigDir()
+	if confDir == "" {
+		return nil, config.ErrNoUserConfigDir
+	}
+	signingCert, _, err := ReadSigningCert()
+	if err != nil {
+		return
+	}
+	signingKeyDER, err := config.ReadPrivateKey(LOCAL, path.Join(confDir, SigningCertBasename+".key"))
+	if err != nil {
+		return
+	}
+	k, _, err := config.ParseKey(signingKeyDER)
+	if err != nil {
+		return
+	}
+	signingKey, ok := k.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("signing key cannot be used to sign a CRL")
+	}
+
+	issued, err := ReadIssued()
+	if err != nil {
+		return
+	}
+
+	id := signerID(signingCert)
+	now := time.Now().UTC()
+	var entries []x509.RevocationListEntry
+	for _, c := range issued.Certificates {
+		if c.Revoked == nil || c.Expires.Before(now) || !c.issuedBy(id) {
+			continue
+		}
+		serial, ok := new(big.Int).SetString(c.Serial, 16)
+		if !ok {
+			log.Warn().Msgf("invalid serial %q in certificate issuance database", c.Serial)
+			continue
+		}
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   serial,
+			RevocationTime: *c.Revoked,
+			ReasonCode:     c.Reason,
+		})
+	}
+
+	issued.CRLNumber++
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(issued.CRLNumber),
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(validity),
+		RevokedCertificateEntries: entries,
+	}, signingCert, signingKey)
+	if err != nil {
+		return
+	}
+	if err = writeIssued(issued); err != nil {
+		return
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), nil
+}
+
+// TLSSyncCRL writes the PEM encoded crl to the `tls` directory of all
+// hosts, next to the chain file
+func TLSSyncCRL(crl []byte) (err error) {
+	for r := range ALL.OrList() {
+		tlsPath := r.PathTo("tls")
+		if err = r.MkdirAll(tlsPath, 0775); err != nil {
+			return
+		}
+		crlpath := path.Join(tlsPath, CRLFile)
+		if err = r.WriteFile(crlpath, crl, 0644); err != nil {
+			return
+		}
+		fmt.Printf("Updated certificate revocation list %s on %s\n", crlpath, r.String())
+	}
+	return
+}
@@ -0,0 +1,40 @@
+package geneos
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsRevokedIssuer(t *testing.T) {
+	// two signers with the same subject but different keys, as after
+	// a signing certificate rotation
+	cert, _, oldSigner := testCertAndKey(t)
+	_, _, newSigner := testCertAndKey(t)
+
+	if signerID(oldSigner) == signerID(newSigner) {
+		t.Fatal("signers with different keys have the same ID")
+	}
+
+	now := time.Now()
+	record := IssuedCert{
+		Serial:  SerialString(cert),
+		Issuer:  signerID(oldSigner),
+		Expires: cert.NotAfter,
+		Revoked: &now,
+	}
+	issued := Issued{Certificates: []IssuedCert{record}}
+
+	if IsRevoked(issued, oldSigner, cert) == nil {
+		t.Error("certificate not revoked for the signer that issued it")
+	}
+	if IsRevoked(issued, newSigner, cert) != nil {
+		t.Error("certificate revoked for a different signer with the same serial")
+	}
+
+	// records without an issuer predate it being recorded
+	record.Issuer = ""
+	issued = Issued{Certificates: []IssuedCert{record}}
+	if IsRevoked(issued, newSigner, cert) == nil {
+		t.Error("record without an issuer not matched")
+	}
+}
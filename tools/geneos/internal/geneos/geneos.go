@@ -50,6 +50,11 @@ var (
 // them disabled
 const DisableExtension = "disabled"
 
+// StoppedExtension is the suffix added to instance config files to mark
+// them as stopped by the user, so that they are not restarted by
+// `supervise`
+const StoppedExtension = "stopped"
+
 // Initialise a Geneos environment by creating a directory structure and
 // then it calls the initialisation functions for each component type
 // registered.
@@ -119,6 +124,7 @@ func Initialise(h *Host, options ...PackageOptions) (err error) {
 func Init(app string) {
 	SigningCertBasename = cordial.ExecutableName()
 	ChainCertFile = cordial.ExecutableName() + "-chain.pem"
+	CRLFile = cordial.ExecutableName() + "-crl.pem"
 	RootComponent.Register(nil)
 }
 
@@ -0,0 +1,127 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package geneos
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os/user"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// HistoryFile is the name of the file, in the `packages` directory of
+// each host, that records changes to base links made by Update. Each
+// line is a JSON encoded UpdateRecord.
+const HistoryFile = "history.jsonl"
+
+// UpdateRecord is a single change of a base link for a component on a
+// host
+type UpdateRecord struct {
+	Time      time.Time `json:"time"`
+	User      string    `json:"user,omitempty"`
+	Component string    `json:"component"`
+	Base      string    `json:"base"`
+	Old       string    `json:"old,omitempty"`
+	New       string    `json:"new"`
+	Restarted []string  `json:"restarted,omitempty"`
+
+	// Undo is the number of earlier changes reversed by this one,
+	// non-zero for rollbacks
+	Undo int `json:"undo,omitempty"`
+}
+
+// ReadHistory returns all the base link changes recorded on host h,
+// oldest first. If there is no history file then an empty slice is
+// returned. Lines that cannot be decoded are logged and skipped.
+func ReadHistory(h *Host) (records []UpdateRecord, err error) {
+	data, err := h.ReadFile(h.PathTo("packages", HistoryFile))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+		return
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var r UpdateRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			log.Debug().Err(err).Msgf("%s: skipping invalid history line", h)
+			continue
+		}
+		records = append(records, r)
+	}
+	return
+}
+
+// UpdateHistory returns the changes to the base link base for
+// component ct on host h that are still in effect, oldest first.
+// Changes reversed by a rollback are removed, as is the rollback
+// itself, so that the last entry is the change that set the current
+// target and further rollbacks step back through earlier ones.
+func UpdateHistory(h *Host, ct *Component, base string) (stack []UpdateRecord, err error) {
+	records, err := ReadHistory(h)
+	if err != nil {
+		return
+	}
+	for _, r := range records {
+		if r.Component != ct.String() || r.Base != base {
+			continue
+		}
+		if r.Undo > 0 {
+			stack = stack[:max(0, len(stack)-r.Undo)]
+			continue
+		}
+		stack = append(stack, r)
+	}
+	return
+}
+
+// recordUpdate appends r to the history file on host h, filling in the
+// time and user. Errors are logged but otherwise ignored as the update
+// itself has already been made.
+func recordUpdate(h *Host, r UpdateRecord) {
+	r.Time = time.Now().UTC()
+	if u, err := user.Current(); err == nil {
+		r.User = u.Username
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		log.Error().Err(err).Msg("cannot encode update history")
+		return
+	}
+
+	file := h.PathTo("packages", HistoryFile)
+	data, err := h.ReadFile(file)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Error().Err(err).Msgf("cannot read %s", h.HostPath(file))
+		return
+	}
+	data = append(data, line...)
+	data = append(data, '\n')
+	if err = h.WriteFile(file, data, 0664); err != nil {
+		log.Error().Err(err).Msgf("cannot write %s", h.HostPath(file))
+	}
+}
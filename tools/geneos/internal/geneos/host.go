@@ -86,7 +86,9 @@ func InitHosts(app string) {
 // NewHost is a factory method for Host. It returns an initialised Host
 // and will store it in the global map. If name is "localhost", "all" or
 // "unknown" then it returns pseudo-hosts used for testing and ranges.
-// An empty name results in a nil pointer.
+// An empty name results in a nil pointer. Other hosts are SSH remotes
+// configured by options, unless one of the options is a host.Host, e.g.
+// a host.Memory, which is then used instead.
 func NewHost(name string, options ...any) (h *Host) {
 	switch name {
 	case "":
@@ -120,8 +122,19 @@ func NewHost(name string, options ...any) (h *Host) {
 				return
 			}
 		}
-		// or bootstrap, but NOT save a new one, with only the name set
-		h = &Host{host.NewSSHRemote(name, options...), config.New(), false, false}
+		// or bootstrap, but NOT save a new one, with only the name set.
+		// a host.Host in options, such as a host.Memory for testing, is
+		// used in place of an SSH remote
+		var hh host.Host
+		for _, o := range options {
+			if oh, ok := o.(host.Host); ok {
+				hh = oh
+			}
+		}
+		if hh == nil {
+			hh = host.NewSSHRemote(name, options...)
+		}
+		h = &Host{hh, config.New(), false, false}
 		h.Set("name", name)
 		hosts.Store(name, h)
 	}
@@ -291,23 +304,35 @@ func PlatformID(h *Host) (platformID string) {
 
 // Match returns an iterator for all matching Hosts. Intended for use in
 // range loops where the host could be specific or 'all'. If passed an
-// empty string then yields nothing
+// empty string then yields nothing and 'all' yields the same hosts as
+// ALL.OrList(). A host selector, see ParseHostSelector, yields each
+// matching host and any other value yields the named host, if it
+// exists.
 func Match(h string) iter.Seq[*Host] {
 	return func(yield func(*Host) bool) {
-		switch h {
-		case "":
+		switch {
+		case h == "":
 			return
-		case ALLHOSTS:
-			yield(GetHost(h))
-			return
-		default:
-			hs := []*Host{LOCAL}
-			hs = append(hs, RemoteHosts(false)...)
-			for _, h := range hs {
-				if !yield(h) {
+		case h == ALLHOSTS:
+			for _, r := range allHosts() {
+				if !yield(r) {
 					return
 				}
 			}
+		case IsHostSelector(h):
+			s, err := ParseHostSelector(h)
+			if err != nil {
+				return
+			}
+			for _, r := range RemoteHosts(false) {
+				if s.Matches(r) && !yield(r) {
+					return
+				}
+			}
+		default:
+			if r := GetHost(h); r.Exists() {
+				yield(r)
+			}
 		}
 	}
 }
@@ -320,8 +345,7 @@ func (h *Host) OrList(hosts ...*Host) iter.Seq[*Host] {
 		switch h {
 		case nil:
 			if len(hosts) == 0 {
-				hosts = append(hosts, LOCAL)
-				hosts = append(hosts, RemoteHosts(false)...)
+				hosts = allHosts()
 			}
 			for _, h := range hosts {
 				if !yield(h) {
@@ -329,9 +353,7 @@ func (h *Host) OrList(hosts ...*Host) iter.Seq[*Host] {
 				}
 			}
 		case ALL:
-			hs := []*Host{LOCAL}
-			hs = append(hs, RemoteHosts(false)...)
-			for _, h := range hs {
+			for _, h := range allHosts() {
 				if !yield(h) {
 					return
 				}
@@ -345,6 +367,16 @@ func (h *Host) OrList(hosts ...*Host) iter.Seq[*Host] {
 	}
 }
 
+// allHosts returns LOCAL followed by all the non-hidden remote hosts.
+// If a host selection is active then LOCAL is not included and only
+// the matching remote hosts are returned.
+func allHosts() (hs []*Host) {
+	if hostSelection == nil {
+		hs = append(hs, LOCAL)
+	}
+	return append(hs, RemoteHosts(false)...)
+}
+
 // PathTo builds an absolute path based on the Geneos root of the host
 // h (using the executable name as the key) and the parts passed as
 // arguments. Each part can be a pointer to a geneos.Component, in which
@@ -403,7 +435,7 @@ func RemoteHosts(includeHidden bool) (hs []*Host) {
 
 	hosts.Range(func(k, v interface{}) bool {
 		h := GetHost(k.(string))
-		if h.Exists() && (includeHidden || !h.hidden) {
+		if h.Exists() && (includeHidden || !h.hidden) && hostSelection.Matches(h) {
 			hs = append(hs, h)
 		}
 		return true
@@ -459,17 +491,52 @@ func LoadHostConfig() {
 			continue
 		}
 
-		r := host.NewSSHRemote(v.GetString("name"),
-			host.Username(v.GetString("username")), // username is the login name for the remote host
-			host.Hostname(v.GetString("hostname")),
-			host.Port(uint16(v.GetInt("port"))),
-			host.Password(v.GetPassword("password").Enclave),
-			host.PrivateKeyFiles(v.GetStringSlice("privatekeys")...),
-		)
+		r := host.NewSSHRemote(v.GetString("name"), SSHOptions(v)...)
 		hosts.Store(v.GetString("name"), &Host{r, v, v.GetBool("hidden"), true})
 	}
 }
 
+// SSHOptions returns the options for host.NewSSHRemote, or NewHost,
+// from the remote host configuration cf. This includes any jump hosts,
+// in the `jumphosts` list, each of which is a map with the same
+// `hostname`, `port`, `username`, `password` and `privatekeys`
+// settings as the host, and a `proxycommand`.
+func SSHOptions(cf *config.Config) (options []any) {
+	options = []any{
+		host.Username(cf.GetString("username")), // username is the login name for the remote host
+		host.Hostname(cf.GetString("hostname")),
+		host.Port(uint16(cf.GetInt("port"))),
+		host.Password(cf.GetPassword("password").Enclave),
+		host.PrivateKeyFiles(cf.GetStringSlice("privatekeys")...),
+	}
+
+	jumps, _ := cf.Get("jumphosts").([]interface{})
+	for _, j := range jumps {
+		m, ok := j.(map[string]interface{})
+		if !ok {
+			log.Debug().Msgf("jumphosts value not a map[string]interface{} but a %T", j)
+			continue
+		}
+		jcf := config.New()
+		jcf.MergeConfigMap(m)
+		jumpOptions := []host.SSHOptions{
+			host.Hostname(jcf.GetString("hostname")),
+			host.Port(uint16(jcf.GetInt("port"))),
+			host.Password(jcf.GetPassword("password").Enclave),
+			host.PrivateKeyFiles(jcf.GetStringSlice("privatekeys")...),
+		}
+		if username := jcf.GetString("username"); username != "" {
+			jumpOptions = append(jumpOptions, host.Username(username))
+		}
+		options = append(options, host.JumpHost(jumpOptions...))
+	}
+
+	if proxyCommand := cf.GetString("proxycommand", config.NoExpand()); proxyCommand != "" {
+		options = append(options, host.ProxyCommand(proxyCommand))
+	}
+	return
+}
+
 // SaveHostConfig writes the current hosts to the users hosts configuration file
 func SaveHostConfig() error {
 	n := config.New()
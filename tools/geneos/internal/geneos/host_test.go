@@ -0,0 +1,93 @@
+package geneos
+
+import (
+	"os"
+	"os/exec"
+	"slices"
+	"syscall"
+	"testing"
+
+	"github.com/itrs-group/cordial/pkg/host"
+	"github.com/itrs-group/cordial/pkg/process"
+)
+
+func TestNewHostMemory(t *testing.T) {
+	m := host.NewMemory("memtest")
+	h := NewHost("memtest", m)
+	defer h.Delete()
+
+	if h.Host != m {
+		t.Fatalf("NewHost did not use the memory host, got %T", h.Host)
+	}
+	if h.GetString("os") != "linux" {
+		t.Errorf("os is %q, want linux", h.GetString("os"))
+	}
+
+	binary := "/home/geneos/packages/netprobe/active_prod/netprobe.linux_64"
+	cmd := &exec.Cmd{Path: binary, Args: []string{binary, "-port", "7036"}, Dir: "/home/geneos"}
+	if err := h.Start(cmd, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	pid, err := process.GetPID(h, "netprobe.linux_64", nil, nil, "-port", "7036")
+	if err != nil {
+		t.Fatalf("GetPID: %v", err)
+	}
+	if err = h.Signal(pid, syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = process.GetPID(h, "netprobe.linux_64", nil, nil, "-port", "7036"); err != os.ErrProcessDone {
+		t.Errorf("GetPID after SIGTERM returned %v", err)
+	}
+}
+
+func TestHostSelector(t *testing.T) {
+	for name, tags := range map[string]map[string]string{
+		"sel1": {"env": "prod", "dc": "ldn"},
+		"sel2": {"env": "prod", "dc": "nyc"},
+		"sel3": {"env": "dev", "dc": "ldn"},
+	} {
+		h := NewHost(name, host.NewMemory(name))
+		defer h.Delete()
+		h.Valid()
+		h.Set("tags", tags)
+	}
+	GetHost("sel2").Set("groups", []string{"web", "db"})
+
+	tests := map[string][]string{
+		"env=prod":         {"sel1", "sel2"},
+		"ENV=prod,dc!=ldn": {"sel2"},
+		"@db":              {"sel2"},
+		"@db,dc=ldn":       {},
+		"sel3":             {"sel3"},
+		"missing":          {},
+	}
+	for selector, want := range tests {
+		got := []string{}
+		for h := range Match(selector) {
+			got = append(got, h.String())
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("Match(%q) returned %v, want %v", selector, got, want)
+		}
+	}
+
+	if _, err := ParseHostSelector("env"); err == nil {
+		t.Error("ParseHostSelector accepted a term without a value")
+	}
+
+	if err := SelectHosts("dc=ldn"); err != nil {
+		t.Fatal(err)
+	}
+	defer SelectHosts("")
+	got := []string{}
+	for h := range ALL.OrList() {
+		got = append(got, h.String())
+	}
+	if !slices.Equal(got, []string{"sel1", "sel3"}) {
+		t.Errorf("ALL.OrList() with selection returned %v", got)
+	}
+	if err := SelectHosts("@none"); err == nil {
+		t.Error("SelectHosts matching no hosts did not return an error")
+	}
+}
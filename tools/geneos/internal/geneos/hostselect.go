@@ -0,0 +1,176 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package geneos
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// HostSelector selects hosts by their tags and groups. It is parsed
+// from a comma separated list of terms, all of which must match:
+//
+//	KEY=VALUE   the host has tag KEY set to VALUE
+//	KEY!=VALUE  the host does not have tag KEY set to VALUE
+//	@GROUP      the host is a member of GROUP
+//
+// Tag keys are case-insensitive, values and group names are not. The
+// local host has no tags or groups and so is never selected.
+type HostSelector struct {
+	terms []hostSelectorTerm
+}
+
+type hostSelectorTerm struct {
+	key    string
+	value  string
+	group  string
+	negate bool
+}
+
+// hostSelection, if not nil, limits the hosts returned by RemoteHosts
+// and the iterators for ALL to those that match
+var hostSelection *HostSelector
+
+// IsHostSelector returns true if s is a host selector rather than a
+// host name
+func IsHostSelector(s string) bool {
+	return strings.HasPrefix(s, "@") || strings.ContainsAny(s, "=,")
+}
+
+// ParseHostSelector returns the HostSelector for s
+func ParseHostSelector(s string) (selector *HostSelector, err error) {
+	selector = &HostSelector{}
+	for _, t := range strings.Split(s, ",") {
+		t = strings.TrimSpace(t)
+		switch {
+		case t == "":
+			continue
+		case strings.HasPrefix(t, "@"):
+			if t == "@" {
+				return nil, fmt.Errorf("%w: empty group name in host selector %q", ErrInvalidArgs, s)
+			}
+			selector.terms = append(selector.terms, hostSelectorTerm{group: t[1:]})
+		case strings.Contains(t, "!="):
+			k, v, _ := strings.Cut(t, "!=")
+			selector.terms = append(selector.terms, hostSelectorTerm{key: strings.ToLower(k), value: v, negate: true})
+		case strings.Contains(t, "="):
+			k, v, _ := strings.Cut(t, "=")
+			selector.terms = append(selector.terms, hostSelectorTerm{key: strings.ToLower(k), value: v})
+		default:
+			return nil, fmt.Errorf("%w: invalid term %q in host selector %q", ErrInvalidArgs, t, s)
+		}
+	}
+	if len(selector.terms) == 0 {
+		return nil, fmt.Errorf("%w: empty host selector", ErrInvalidArgs)
+	}
+	for _, t := range selector.terms {
+		if t.group == "" && t.key == "" {
+			return nil, fmt.Errorf("%w: empty tag name in host selector %q", ErrInvalidArgs, s)
+		}
+	}
+	return
+}
+
+// Matches returns true if host h matches all the terms of selector s
+func (s *HostSelector) Matches(h *Host) bool {
+	if s == nil {
+		return true
+	}
+	if h == nil || h == LOCAL || h == ALL || h == UNKNOWN {
+		return false
+	}
+	tags := h.Tags()
+	groups := h.Groups()
+	for _, t := range s.terms {
+		switch {
+		case t.group != "":
+			if !slices.Contains(groups, t.group) {
+				return false
+			}
+		case t.negate:
+			if v, ok := tags[t.key]; ok && v == t.value {
+				return false
+			}
+		default:
+			if v, ok := tags[t.key]; !ok || v != t.value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// SelectHosts limits the hosts returned by RemoteHosts, Match and the
+// iterators for ALL to those matching selector for the rest of the
+// program run. An empty selector removes any limit. An error is
+// returned if the selector is invalid or matches no hosts.
+func SelectHosts(selector string) (err error) {
+	if selector == "" {
+		hostSelection = nil
+		return
+	}
+	s, err := ParseHostSelector(selector)
+	if err != nil {
+		return
+	}
+	hostSelection = s
+	if len(RemoteHosts(true)) == 0 {
+		return fmt.Errorf("no hosts match %q", selector)
+	}
+	return
+}
+
+// Tags returns the tags of host h as a map. The local host has no tags.
+func (h *Host) Tags() (tags map[string]string) {
+	tags = map[string]string{}
+	if h == nil || h.Config == nil {
+		return
+	}
+	switch m := h.Get("tags").(type) {
+	case map[string]string:
+		maps.Copy(tags, m)
+	case map[string]any:
+		for k, v := range m {
+			tags[k] = fmt.Sprint(v)
+		}
+	}
+	return
+}
+
+// Groups returns the sorted names of the groups host h is a member of
+func (h *Host) Groups() (groups []string) {
+	if h == nil || h.Config == nil {
+		return
+	}
+	groups = h.GetStringSlice("groups")
+	slices.Sort(groups)
+	return slices.Compact(groups)
+}
+
+// TagsString returns the tags of h as a sorted, comma separated list
+// of KEY=VALUE pairs
+func (h *Host) TagsString() string {
+	tags := h.Tags()
+	var s []string
+	for _, k := range slices.Sorted(maps.Keys(tags)) {
+		s = append(s, k+"="+tags[k])
+	}
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,122 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package geneos
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DownloadBaseComponent returns the component that uses base as one
+// of its default download base paths, e.g. `Gateway+2`, or nil if
+// there is none. This is the reverse of the mapping used to build the
+// download URL.
+func DownloadBaseComponent(base string) *Component {
+	for _, ct := range RealComponents() {
+		basepaths := strings.FieldsFunc(ct.DownloadBase.Default, func(r rune) bool {
+			return unicode.IsSpace(r) || r == ','
+		})
+		for _, bp := range basepaths {
+			if bp == base {
+				return ct
+			}
+			// the base path may be URL encoded in the component definition
+			if u, err := url.PathUnescape(bp); err == nil && u == base {
+				return ct
+			}
+		}
+	}
+	return nil
+}
+
+// MirrorArchive returns the name of the release archive for component
+// ct in the local directory dir that best matches the query parameters
+// sent by a client downloading from the default download site. The
+// `title` parameter is either a version, which may be partial, or a
+// string that the archive name must contain, such as `linux-x64` or
+// `-el8-linux-x64` for a platform specific release. When the title is
+// not a version the latest matching release is returned. If `os` is
+// set then, unless the component has custom download parameters, the
+// archive name must contain it.
+//
+// If nothing matches then an error wrapping fs.ErrNotExist is returned.
+func MirrorArchive(ct *Component, dir string, query url.Values) (filename string, err error) {
+	title := query.Get("title")
+
+	options := []PackageOptions{LocalArchive(dir)}
+	for _, p := range platformSuffixList {
+		if strings.HasPrefix(title, "-"+p+"-") {
+			options = append(options, SetPlatformID(":"+p))
+			break
+		}
+	}
+
+	archives, err := LocalArchives(ct, options...)
+	if err != nil {
+		return
+	}
+
+	type candidate struct {
+		filename string
+		version  string
+	}
+	var candidates []candidate
+
+	for _, a := range archives {
+		if os := query.Get("os"); os != "" && ct.DownloadParams == nil && !strings.Contains(a, os) {
+			continue
+		}
+		_, version, _, _, err := FilenameToComponentVersion(ct, a)
+		if err != nil {
+			log.Debug().Err(err).Msgf("ignoring %s", a)
+			continue
+		}
+		switch {
+		case title == "":
+		case matchVersion(title):
+			if version != title &&
+				!strings.HasPrefix(version, title+".") &&
+				!strings.HasPrefix(version, title+"-") &&
+				!strings.HasPrefix(version, title+"+") {
+				continue
+			}
+		case !strings.Contains(a, title):
+			continue
+		}
+		candidates = append(candidates, candidate{a, version})
+	}
+
+	if len(candidates) == 0 {
+		err = fmt.Errorf("no release archive for %s matching %q (%w)", ct, query.Encode(), fs.ErrNotExist)
+		return
+	}
+
+	latest := slices.MaxFunc(candidates, func(a, b candidate) int {
+		if c := CompareVersion(a.version, b.version); c != 0 {
+			return c
+		}
+		return strings.Compare(a.filename, b.filename)
+	})
+	return latest.filename, nil
+}
@@ -26,25 +26,32 @@ import (
 // packageOptions defines the internal options for various operations in
 // the geneos package
 type packageOptions struct {
-	localArchive string
-	basename     string
-	doupdate     bool
-	downloadbase string
-	downloadonly bool
-	downloadtype string
-	force        bool
-	geneosdir    string
-	host         *Host
-	localOnly    bool
-	nosave       bool
-	override     string
-	password     *config.Plaintext
-	platformId   string
-	restart      []Instance
-	start        func(Instance, ...any) error
-	stop         func(Instance, bool, bool) error
-	username     string
-	version      string
+	affected        []Instance
+	localArchive    string
+	basename        string
+	checksums       string
+	doupdate        bool
+	downloadbase    string
+	downloadonly    bool
+	downloadtype    string
+	force           bool
+	geneosdir       string
+	hook            func(Instance, string) error
+	host            *Host
+	localOnly       bool
+	nosave          bool
+	override        string
+	password        *config.Plaintext
+	platformId      string
+	pubkey          string
+	requireChecksum bool
+	restart         []Instance
+	rollback        int
+	signature       string
+	start           func(Instance, ...any) error
+	stop            func(Instance, bool, bool) error
+	username        string
+	version         string
 }
 
 // PackageOptions can be passed to various function and influence
@@ -58,6 +65,11 @@ func evalOptions(options ...PackageOptions) (d *packageOptions) {
 		downloadtype: "resources",
 		localArchive: path.Join(LocalRoot(), "packages", "downloads"),
 		host:         LOCAL,
+
+		checksums:       config.GetString(config.Join("download", "checksums")),
+		signature:       config.GetString(config.Join("download", "signature")),
+		pubkey:          config.GetString(config.Join("download", "publickey")),
+		requireChecksum: config.GetBool(config.Join("download", "verify")),
 	}
 	for _, opt := range options {
 		opt(d)
@@ -114,6 +126,15 @@ func OverrideVersion(version string) PackageOptions {
 	return func(d *packageOptions) { d.override = version }
 }
 
+// Affected sets the instances that use the base link being updated.
+// The "pre-update" and "post-update" hooks are run for these, and for
+// any instances given in Restart(), whether or not they are restarted.
+func Affected(instance ...Instance) PackageOptions {
+	return func(d *packageOptions) {
+		d.affected = append(d.affected, instance...)
+	}
+}
+
 // Restart sets the instances to be restarted around the update
 func Restart(instance ...Instance) PackageOptions {
 	return func(d *packageOptions) {
@@ -121,6 +142,13 @@ func Restart(instance ...Instance) PackageOptions {
 	}
 }
 
+// Rollback marks an update as reversing the last steps changes
+// recorded in the update history for the base link, so that later
+// rollbacks continue from the change before those
+func Rollback(steps int) PackageOptions {
+	return func(d *packageOptions) { d.rollback = steps }
+}
+
 // DoUpdate sets the option to also do an update after an install
 func DoUpdate(update bool) PackageOptions {
 	return func(d *packageOptions) { d.doupdate = update }
@@ -134,6 +162,16 @@ func StartFunc(fn func(Instance, ...any) error) PackageOptions {
 	}
 }
 
+// HookFunc sets the function to call to run the "pre-update" and
+// "post-update" lifecycle hooks for each instance given in Affected()
+// or Restart().
+// It is required to avoid import loops.
+func HookFunc(fn func(Instance, string) error) PackageOptions {
+	return func(d *packageOptions) {
+		d.hook = fn
+	}
+}
+
 // StopFunc sets the start function to call for each instance given in
 // Restart(). It is required to avoid import loops.
 func StopFunc(fn func(Instance, bool, bool) error) PackageOptions {
@@ -190,3 +228,27 @@ func UseNexus() PackageOptions {
 func UseNexusSnapshots() PackageOptions {
 	return func(d *packageOptions) { d.downloadbase = "snapshots" }
 }
+
+// ChecksumManifest sets the source of the SHA-256 checksum manifest, a local
+// file or a URL, used to verify archives. If not set then a
+// `SHA256SUMS` file in the same directory as the archive is used, if
+// found.
+func ChecksumManifest(source string) PackageOptions {
+	return func(d *packageOptions) { d.checksums = source }
+}
+
+// ChecksumSignature sets the source of a detached signature for the
+// checksum manifest and the PEM encoded public key used to verify it.
+// Both can be local files or URLs.
+func ChecksumSignature(signature, pubkey string) PackageOptions {
+	return func(d *packageOptions) {
+		d.signature = signature
+		d.pubkey = pubkey
+	}
+}
+
+// RequireChecksum makes archives without a checksum an error instead
+// of being installed unverified
+func RequireChecksum(require bool) PackageOptions {
+	return func(d *packageOptions) { d.requireChecksum = require }
+}
@@ -198,23 +198,21 @@ func Install(h *Host, ct *Component, options ...PackageOptions) (err error) {
 // the base link exists then the force option must be used to update it,
 // otherwise it is created as expected. When called from unarchive()
 // this allows new installs to work without explicitly calling update.
-func Update(h *Host, ct *Component, options ...PackageOptions) (err error) {
-	// before updating a specific type on a specific host, loop
-	// through related types, hosts and components. continue to
-	// other items if a single update fails?
-	//
-
+//
+// When h or ct match more than one host or component all of them are
+// updated, even if some fail, and the errors for the failures are
+// returned joined together. Components with no matching release
+// installed are skipped.
+func Update(h *Host, ct *Component, options ...PackageOptions) error {
+	var errs []error
 	for h := range h.OrList() {
 		for ct := range ct.OrList() {
-			if err = update(h, ct, options...); err != nil {
-				if !errors.Is(err, os.ErrNotExist) {
-					fmt.Println(err)
-				}
+			if err := update(h, ct, options...); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
 			}
 		}
 	}
-
-	return nil
+	return errors.Join(errs...)
 }
 
 // update is the core function and must be called with non-wild ct and
@@ -226,12 +224,13 @@ func update(h *Host, ct *Component, options ...PackageOptions) (err error) {
 
 	// update each associated package type for a parent component
 	if len(ct.PackageTypes) > 0 {
+		var errs []error
 		for _, ct := range ct.PackageTypes {
-			if err = Update(h, ct, options...); err != nil && !errors.Is(err, os.ErrNotExist) {
-				log.Error().Err(err).Msg("")
+			if err = Update(h, ct, options...); err != nil {
+				errs = append(errs, err)
 			}
 		}
-		return nil
+		return errors.Join(errs...)
 	}
 
 	// from here hosts and component types must be specified
@@ -266,6 +265,11 @@ func update(h *Host, ct *Component, options ...PackageOptions) (err error) {
 	if len(versions) > 0 {
 		version = versions[len(versions)-1]
 	}
+	// prefer an exact match, e.g. for a rollback to a release that has
+	// later builds with the same prefix
+	if opts.version != "" && slices.Contains(versions, opts.version) {
+		version = opts.version
+	}
 
 	if version == "" {
 		return fmt.Errorf("%s version %q on %s: %w", ct, originalVersion, h, os.ErrNotExist)
@@ -289,19 +293,54 @@ func update(h *Host, ct *Component, options ...PackageOptions) (err error) {
 		return nil
 	}
 
-	if opts.start != nil && opts.stop != nil {
-		for _, c := range opts.restart {
-			// only stop selected instances using components on the host we are working on
-			if c.Host() != h {
-				continue
+	// only selected instances using components on the host we are
+	// working on. hooks run for all of these, even if not restarted.
+	var hooked, restarts []Instance
+	for _, c := range slices.Concat(opts.restart, opts.affected) {
+		if c.Host() != h {
+			continue
+		}
+		// check for plain type or package type
+		if c.Type() != ct && c.Config().GetString("pkgtype") != ct.String() {
+			continue
+		}
+		if slices.Contains(hooked, c) {
+			continue
+		}
+		hooked = append(hooked, c)
+		if slices.Contains(opts.restart, c) {
+			restarts = append(restarts, c)
+		}
+	}
+
+	// post-update hooks are deferred first so that they run after any
+	// instances are restarted below, and only if the update succeeds
+	var updated bool
+	if opts.hook != nil {
+		for _, c := range hooked {
+			if err = opts.hook(c, "pre-update"); err != nil {
+				return
 			}
-			// check for plain type or package type
-			if c.Type() != ct && c.Config().GetString("pkgtype") != ct.String() {
-				continue
+		}
+		defer func() {
+			if !updated {
+				return
 			}
+			for _, c := range hooked {
+				if err := opts.hook(c, "post-update"); err != nil {
+					log.Error().Err(err).Msg("")
+				}
+			}
+		}()
+	}
+
+	var restarted []string
+	if opts.start != nil && opts.stop != nil {
+		for _, c := range restarts {
 			if err = opts.stop(c, opts.force, false); err == nil {
 				// only restart instances that we stopped, regardless of success of install/update
 				defer opts.start(c)
+				restarted = append(restarted, c.String())
 			}
 		}
 	}
@@ -312,6 +351,15 @@ func update(h *Host, ct *Component, options ...PackageOptions) (err error) {
 	if err = h.Symlink(version, basepath); err != nil {
 		return err
 	}
+	recordUpdate(h, UpdateRecord{
+		Component: ct.String(),
+		Base:      opts.basename,
+		Old:       existing,
+		New:       version,
+		Restarted: restarted,
+		Undo:      opts.rollback,
+	})
+	updated = true
 	fmt.Printf("%s %q on %s updated to %s\n", ct, path.Base(basepath), h, version)
 	return nil
 }
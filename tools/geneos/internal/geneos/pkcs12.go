@@ -0,0 +1,110 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package geneos
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/awnumar/memguard"
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/itrs-group/cordial/pkg/config"
+)
+
+// PKCS#12 support. Bundles are written using PBES2 with AES-256-CBC
+// and PBKDF2 with HMAC-SHA256, protected by a SHA-256 MAC, which is
+// what current versions of OpenSSL, Java and Windows use. Bundles using
+// either these or the older legacy algorithms can be read.
+
+// EncodePKCS12 returns a PKCS#12 bundle containing the certificate cert,
+// its DER encoded private key and the certificates in chain, protected
+// by password. If cert and key are both nil then the chain certificates
+// are marked as trusted, so that the bundle can be used as a Java trust
+// store.
+func EncodePKCS12(cert *x509.Certificate, key *memguard.Enclave, chain []*x509.Certificate, password *config.Plaintext) (pfx []byte, err error) {
+	pw := password.Bytes()
+	defer memguard.WipeBytes(pw)
+
+	switch {
+	case cert == nil && key == nil:
+		if len(chain) == 0 {
+			return nil, fmt.Errorf("%w: no certificates to encode", ErrInvalidArgs)
+		}
+		return pkcs12.Modern.EncodeTrustStore(chain, string(pw))
+	case cert == nil:
+		return nil, fmt.Errorf("%w: no certificate for private key", ErrInvalidArgs)
+	case key == nil:
+		return nil, fmt.Errorf("%w: no private key for certificate", ErrInvalidArgs)
+	}
+
+	pk, _, err := config.ParseKey(key)
+	if err != nil {
+		return
+	}
+	return pkcs12.Modern.Encode(pk, cert, chain, string(pw))
+}
+
+// DecomposePKCS12 parses the PKCS#12 bundle in data using password and
+// returns the leaf certificate, private key and chain in the same way
+// as DecomposePEM. Keys are returned PKCS#8 encoded. Bundles without a
+// private key must be trust stores, like those written by EncodePKCS12,
+// and only return certificates.
+func DecomposePKCS12(data []byte, password *config.Plaintext) (cert *x509.Certificate, key *memguard.Enclave, chain []*x509.Certificate, err error) {
+	pw := password.Bytes()
+	defer memguard.WipeBytes(pw)
+
+	var pems []string
+	pk, leaf, certs, err := pkcs12.DecodeChain(data, string(pw))
+	if err != nil {
+		// no key, or more than one, so try reading as a trust store
+		// and return the original error if that fails too
+		var terr error
+		if certs, terr = pkcs12.DecodeTrustStore(data, string(pw)); terr != nil {
+			return
+		}
+		err = nil
+	} else {
+		der, err := x509.MarshalPKCS8PrivateKey(pk)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		pems = append(pems, string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})))
+		memguard.WipeBytes(der)
+		certs = append([]*x509.Certificate{leaf}, certs...)
+	}
+
+	for _, c := range certs {
+		pems = append(pems, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})))
+	}
+	return DecomposePEM(pems...)
+}
+
+// IsPKCS12 returns true if data looks like a DER encoded PKCS#12 bundle
+// rather than PEM
+func IsPKCS12(data []byte) bool {
+	var pfx struct {
+		Version  int
+		AuthSafe asn1.RawValue
+		MacData  asn1.RawValue `asn1:"optional"`
+	}
+	_, err := asn1.Unmarshal(data, &pfx)
+	return err == nil && pfx.Version == 3
+}
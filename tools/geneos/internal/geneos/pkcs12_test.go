@@ -0,0 +1,131 @@
+package geneos
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/awnumar/memguard"
+
+	"github.com/itrs-group/cordial/pkg/config"
+)
+
+// testCertAndKey returns a certificate and private key signed by a new
+// root, along with the root
+func testCertAndKey(t *testing.T) (cert *x509.Certificate, key *memguard.Enclave, ca *x509.Certificate) {
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test root"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	ca, caKey, err := config.CreateCertificateAndKey(caTemplate, caTemplate, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "geneos gateway test"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+	}
+	cert, key, err = config.CreateCertificateAndKey(template, ca, caKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestPKCS12RoundTrip(t *testing.T) {
+	cert, key, ca := testCertAndKey(t)
+
+	password := config.NewPlaintext([]byte("secret"))
+	pfx, err := EncodePKCS12(cert, key, []*x509.Certificate{ca}, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, _, err = DecomposePKCS12(pfx, config.NewPlaintext([]byte("wrong"))); err == nil {
+		t.Error("DecomposePKCS12 with the wrong password did not fail")
+	}
+
+	c, k, chain, err := DecomposePKCS12(pfx, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Equal(cert) {
+		t.Errorf("decoded certificate %q, expected %q", c.Subject.CommonName, cert.Subject.CommonName)
+	}
+	if k == nil || config.MatchKey(c, []*memguard.Enclave{k}) != 0 {
+		t.Error("decoded private key does not match certificate")
+	}
+	if len(chain) != 1 || !chain[0].Equal(ca) {
+		t.Errorf("decoded chain has %d certificates, expected the root", len(chain))
+	}
+}
+
+// the testdata bundles were created by OpenSSL 3 with and without the
+// -legacy option, using the password "secret"
+func TestPKCS12OpenSSLFixtures(t *testing.T) {
+	for _, file := range []string{"openssl.p12", "openssl-legacy.p12"} {
+		data, err := os.ReadFile(filepath.Join("testdata", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsPKCS12(data) {
+			t.Errorf("%s: not recognised as PKCS#12", file)
+		}
+		c, k, chain, err := DecomposePKCS12(data, config.NewPlaintext([]byte("secret")))
+		if err != nil {
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+		if c.Subject.CommonName != "geneos gateway test" {
+			t.Errorf("%s: decoded certificate %q", file, c.Subject.CommonName)
+		}
+		if k == nil || config.MatchKey(c, []*memguard.Enclave{k}) != 0 {
+			t.Errorf("%s: decoded private key does not match certificate", file)
+		}
+		if len(chain) != 1 || chain[0].Subject.CommonName != "test root" {
+			t.Errorf("%s: decoded chain has %d certificates, expected the root", file, len(chain))
+		}
+	}
+}
+
+func TestPKCS12ReadByOpenSSL(t *testing.T) {
+	openssl, err := exec.LookPath("openssl")
+	if err != nil {
+		t.Skip("openssl not found")
+	}
+	cert, key, ca := testCertAndKey(t)
+
+	pfx, err := EncodePKCS12(cert, key, []*x509.Certificate{ca}, config.NewPlaintext([]byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "test.p12")
+	if err = os.WriteFile(file, pfx, 0600); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(openssl, "pkcs12", "-in", file, "-passin", "pass:secret", "-nodes").CombinedOutput()
+	if err != nil {
+		t.Fatalf("openssl: %v\n%s", err, out)
+	}
+	if n := bytes.Count(out, []byte("BEGIN CERTIFICATE")); n != 2 {
+		t.Errorf("openssl found %d certificates, expected 2", n)
+	}
+	if !bytes.Contains(out, []byte("BEGIN PRIVATE KEY")) {
+		t.Error("openssl did not find the private key")
+	}
+}
@@ -47,6 +47,10 @@ var SigningCertBasename string
 // verify instance certificates
 var ChainCertFile string
 
+// CRLFile is the file name of the certificate revocation list, kept
+// next to the chain file in the `tls` directory of each host
+var CRLFile string
+
 // ReadRootCert reads the root certificate from the user's app config
 // directory. It "promotes" old cert and key files from the previous tls
 // directory if files do not already exist in the user app config
@@ -205,18 +209,6 @@ func DecomposePEM(data ...string) (cert *x509.Certificate, der *memguard.Enclave
 // or an embedded string with either an included private key and chain
 // or separately specified in the same way.
 func TLSImportBundle(signingBundleSource, privateKeySource, chainSource string) (err error) {
-	confDir := config.AppConfigDir()
-	if confDir == "" {
-		return config.ErrNoUserConfigDir
-	}
-
-	// speculatively create user config directory. permissions do not
-	// need to be restrictive
-	err = LOCAL.MkdirAll(confDir, 0775)
-	if err != nil {
-		log.Fatal().Err(err).Msg("")
-	}
-
 	signingBundle, err := config.ReadInputPEMString(signingBundleSource, "signing certificate(s)")
 	if err != nil {
 		return err
@@ -232,6 +224,37 @@ func TLSImportBundle(signingBundleSource, privateKeySource, chainSource string)
 		return err
 	}
 
+	if chainSource != "" {
+		b, err := os.ReadFile(chainSource)
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			return err
+		}
+		_, _, chain, err = DecomposePEM(string(b))
+		if err != nil {
+			return err
+		}
+	}
+
+	return TLSImportSigningCert(cert, key, chain)
+}
+
+// TLSImportSigningCert saves cert and key as the signing certificate
+// and private key in the user's configuration directory and, if chain
+// is not empty, writes the chain to the local chain file.
+func TLSImportSigningCert(cert *x509.Certificate, key *memguard.Enclave, chain []*x509.Certificate) (err error) {
+	confDir := config.AppConfigDir()
+	if confDir == "" {
+		return config.ErrNoUserConfigDir
+	}
+
+	// speculatively create user config directory. permissions do not
+	// need to be restrictive
+	err = LOCAL.MkdirAll(confDir, 0775)
+	if err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+
 	// basic validation
 	if !(cert.BasicConstraintsValid && cert.IsCA) {
 		return ErrInvalidArgs
@@ -251,26 +274,13 @@ func TLSImportBundle(signingBundleSource, privateKeySource, chainSource string)
 	}
 	fmt.Printf("%s signing certificate key written to %s\n", cordial.ExecutableName(), path.Join(confDir, SigningCertBasename+".key"))
 
-	if chainSource != "" {
-		b, err := os.ReadFile(chainSource)
-		if err != nil {
-			log.Error().Err(err).Msg("")
-			return err
-		}
-		_, _, chain, err = DecomposePEM(string(b))
-		if err != nil {
-			return err
-		}
-		if err = WriteChainLocal(chain); err != nil {
-			return err
-		}
-	} else if len(chain) > 0 {
+	if len(chain) > 0 {
 		if err = WriteChainLocal(chain); err != nil {
 			return err
 		}
+		fmt.Printf("%s certificate chain written to %s\n", cordial.ExecutableName(), path.Join(LOCAL.PathTo("tls"), ChainCertFile))
 	}
-	fmt.Printf("%s certificate chain written to %s\n", cordial.ExecutableName(), path.Join(LOCAL.PathTo("tls"), ChainCertFile))
-	return err
+	return
 }
 
 func WriteChainLocal(chain []*x509.Certificate) (err error) {
@@ -33,13 +33,13 @@ type FileOwner struct {
 }
 
 func (h *Host) GetFileOwner(info fs.FileInfo) (s FileOwner) {
-	switch h.GetString("name") {
-	case LOCALHOST:
-		s.Uid = int(info.Sys().(*syscall.Stat_t).Uid)
-		s.Gid = int(info.Sys().(*syscall.Stat_t).Gid)
-	default:
-		s.Uid = int(info.Sys().(*sftp.FileStat).UID)
-		s.Gid = int(info.Sys().(*sftp.FileStat).GID)
+	switch st := info.Sys().(type) {
+	case *syscall.Stat_t:
+		s.Uid = int(st.Uid)
+		s.Gid = int(st.Gid)
+	case *sftp.FileStat:
+		s.Uid = int(st.UID)
+		s.Gid = int(st.GID)
 	}
 	return
 }
@@ -127,8 +127,11 @@ func LocalArchives(ct *Component, options ...PackageOptions) (archives []string,
 		return
 	}
 
-	// remove non-files from the list
+	// remove non-files and checksum manifests from the list
 	entries = slices.DeleteFunc(entries, func(d fs.DirEntry) bool {
+		if d.Name() == ChecksumFile || strings.HasSuffix(d.Name(), ChecksumExtension) {
+			return true
+		}
 		st, err := os.Lstat(filepath.Join(opts.localArchive, d.Name()))
 		return err != nil || !st.Mode().IsRegular()
 	})
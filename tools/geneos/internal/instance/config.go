@@ -459,3 +459,19 @@ func DeleteSettingFromMap(i geneos.Instance, from map[string]interface{}, key st
 	}
 	delete(from, key)
 }
+
+// inheritedSetting returns the unexpanded value of key for instance i
+// from the most specific level it is set: the instance configuration,
+// then the global configuration under the component type (and its
+// parent type, if any) and finally the global configuration itself
+func inheritedSetting(i geneos.Instance, key string) (value string) {
+	if value = i.Config().GetString(key, config.NoExpand()); value != "" {
+		return
+	}
+	for ct := i.Type(); ct != nil; ct = ct.ParentType {
+		if value = config.GetString(config.Join(ct.Name, key), config.NoExpand()); value != "" {
+			return
+		}
+	}
+	return config.GetString(key, config.NoExpand())
+}
@@ -0,0 +1,170 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/itrs-group/cordial/pkg/config"
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+)
+
+// Lifecycle hook names. Each is a configuration key under `hooks` at
+// the global, component or instance level.
+const (
+	PreStart   = "pre-start"
+	PostStart  = "post-start"
+	PreStop    = "pre-stop"
+	PostStop   = "post-stop"
+	PreUpdate  = "pre-update"
+	PostUpdate = "post-update"
+)
+
+// DefaultHookTimeout is the time a hook is allowed to run for unless
+// `hooks::timeout` is set
+const DefaultHookTimeout = 60 * time.Second
+
+// RunHook runs the command configured for the lifecycle hook on
+// instance i, if any, through a shell on the instance's host with the
+// instance home directory as the working directory. Details of the
+// instance are passed in GENEOS_* environment variables.
+//
+// The settings `hooks::HOOK`, `hooks::timeout` and `hooks::on-failure`
+// are looked up first in the instance configuration, then in the
+// global configuration under the component type (and its parent
+// type, if any) and finally under `hooks` in the global configuration.
+//
+// If the hook fails or times out then the error is returned when
+// `hooks::on-failure` is `abort`, the default, and callers should not
+// go ahead with the operation for "pre-" hooks. When it is `continue`
+// the failure is logged and nil is returned. Start and Stop only log
+// the errors from "post-" hooks, as the operation has already been
+// done.
+func RunHook(i geneos.Instance, hook string) (err error) {
+	command := hookSetting(i, hook)
+	if command == "" {
+		return
+	}
+
+	timeout, err := hookTimeout(i)
+	if err != nil {
+		return
+	}
+
+	if err = runHook(i, hook, command, timeout); err == nil {
+		return
+	}
+
+	switch policy := hookSetting(i, "on-failure"); policy {
+	case "", "abort":
+		return
+	case "continue":
+		log.Warn().Err(err).Msgf("%s: continuing after %s hook failure", i, hook)
+		return nil
+	default:
+		log.Warn().Msgf("%s: unknown hooks on-failure policy %q, using abort", i, policy)
+		return
+	}
+}
+
+// runHook runs command for hook on the host of instance i and waits up
+// to timeout for it to complete. Local commands are killed on timeout,
+// remote ones are abandoned.
+func runHook(i geneos.Instance, hook, command string, timeout time.Duration) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	h := i.Host()
+	base, underlying, _ := Version(i)
+	env := []string{
+		"GENEOS_HOOK=" + hook,
+		"GENEOS_INSTANCE=" + i.String(),
+		"GENEOS_TYPE=" + i.Type().String(),
+		"GENEOS_NAME=" + i.Name(),
+		"GENEOS_HOST=" + h.String(),
+		"GENEOS_HOSTNAME=" + h.GetString("hostname"),
+		"GENEOS_INSTANCE_HOME=" + i.Home(),
+		"GENEOS_PORT=" + fmt.Sprint(i.Config().GetInt("port")),
+		"GENEOS_BASE=" + base,
+		"GENEOS_VERSION=" + underlying,
+		"GENEOS_HOME=" + h.PathTo(),
+	}
+	if h.IsLocal() {
+		env = append(os.Environ(), env...)
+	}
+
+	// merge stderr into the output so that it can be reported
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", "exec 2>&1\n"+command)
+	cmd.Env = env
+	cmd.Dir = i.Home()
+
+	type result struct {
+		output []byte
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		output, err := h.Run(cmd, "")
+		done <- result{output, err}
+	}()
+
+	log.Debug().Msgf("%s: running %s hook %q", i, hook, command)
+	select {
+	case r := <-done:
+		log.Debug().Msgf("%s: %s hook output:\n%s", i, hook, r.output)
+		if r.err != nil {
+			if output := strings.TrimSpace(string(r.output)); output != "" {
+				return fmt.Errorf("%s hook: %w: %s", hook, r.err, output)
+			}
+			return fmt.Errorf("%s hook: %w", hook, r.err)
+		}
+		return
+	case <-ctx.Done():
+		return fmt.Errorf("%s hook: timed out after %s", hook, timeout)
+	}
+}
+
+// hookTimeout returns the `hooks::timeout` setting for instance i,
+// either a duration like "2m" or a number of seconds
+func hookTimeout(i geneos.Instance) (timeout time.Duration, err error) {
+	t := hookSetting(i, "timeout")
+	if t == "" {
+		return DefaultHookTimeout, nil
+	}
+	if n, err := strconv.Atoi(t); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	if timeout, err = time.ParseDuration(t); err != nil {
+		err = fmt.Errorf("invalid hooks timeout %q: %w", t, err)
+	}
+	return
+}
+
+// hookSetting returns the value of `hooks::name` for instance i, from
+// the most specific level it is set
+func hookSetting(i geneos.Instance, name string) string {
+	return inheritedSetting(i, config.Join("hooks", name))
+}
@@ -0,0 +1,250 @@
+package instance_test
+
+import (
+	"errors"
+	"io/fs"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/itrs-group/cordial"
+	"github.com/itrs-group/cordial/pkg/config"
+	"github.com/itrs-group/cordial/pkg/host"
+	"github.com/itrs-group/cordial/tools/geneos/internal/component/netprobe"
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+	"github.com/itrs-group/cordial/tools/geneos/internal/instance"
+)
+
+// hookRecorder records the environment of each hook run on a memory
+// host and fails the hooks given
+type hookRecorder struct {
+	mutex sync.Mutex
+	runs  [][]string
+	fail  []string
+	sleep time.Duration
+}
+
+func (r *hookRecorder) run(_ *host.Memory, cmd *exec.Cmd) host.MemoryResult {
+	r.mutex.Lock()
+	r.runs = append(r.runs, cmd.Env)
+	r.mutex.Unlock()
+	time.Sleep(r.sleep)
+	for _, hook := range r.fail {
+		if slices.Contains(cmd.Env, "GENEOS_HOOK="+hook) {
+			return host.MemoryResult{Stdout: []byte("hook failed"), ExitCode: 1}
+		}
+	}
+	return host.MemoryResult{}
+}
+
+// hooks returns the names of the hooks run, in order
+func (r *hookRecorder) hooks() (hooks []string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, env := range r.runs {
+		for _, e := range env {
+			if hook, ok := strings.CutPrefix(e, "GENEOS_HOOK="); ok {
+				hooks = append(hooks, hook)
+			}
+		}
+	}
+	return
+}
+
+// hookInstance returns a netprobe on a memory host, using release
+// 1.0.0 through the active_prod base link with 2.0.0 also installed,
+// with the hooks given set. The instance is stopped and the host
+// removed when the test finishes.
+func hookInstance(t *testing.T, r *hookRecorder, hooks map[string]string) (h *geneos.Host, i geneos.Instance) {
+	t.Helper()
+	name := strings.NewReplacer("/", "-", "=", "-").Replace(strings.ToLower(t.Name()))
+	h = geneos.NewHost(name, host.NewMemory(name, host.OnCommand("sh", r.run)))
+	h.Valid()
+	h.Set(cordial.ExecutableName(), "/opt/geneos")
+	// instance defaults use the root under the real executable name
+	h.Set("geneos", "/opt/geneos")
+
+	ct := &netprobe.Netprobe
+	basedir := h.PathTo("packages", ct.String())
+	for _, v := range []string{"1.0.0", "2.0.0"} {
+		if err := h.MkdirAll(path.Join(basedir, v), 0775); err != nil {
+			t.Fatal(err)
+		}
+		if err := h.WriteFile(path.Join(basedir, v, "netprobe.linux_64"), nil, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.Symlink("1.0.0", path.Join(basedir, "active_prod")); err != nil {
+		t.Fatal(err)
+	}
+
+	i, err := instance.Get(ct, "hooktest@"+name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if instance.IsRunning(i) {
+			instance.Stop(i, true, false)
+		}
+		i.Unload()
+		h.Delete()
+	})
+	for k, v := range hooks {
+		i.Config().Set(config.Join("hooks", k), v)
+	}
+	if err = instance.SaveConfig(i); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestPostStopHookFailureUpdateRestarts(t *testing.T) {
+	r := &hookRecorder{fail: []string{instance.PostStop}}
+	h, i := hookInstance(t, r, map[string]string{instance.PostStop: "exit 1"})
+
+	if err := instance.Start(i); err != nil {
+		t.Fatal(err)
+	}
+	pid, err := instance.GetPID(i)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = geneos.Update(h, &netprobe.Netprobe,
+		geneos.Version("2.0.0"),
+		geneos.Basename("active_prod"),
+		geneos.Force(true),
+		geneos.Restart(i),
+		geneos.StartFunc(instance.Start),
+		geneos.StopFunc(instance.Stop),
+		geneos.HookFunc(instance.RunHook),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	newpid, err := instance.GetPID(i)
+	if err != nil {
+		t.Fatalf("instance not running after update with a failing post-stop hook: %v", err)
+	}
+	if newpid == pid {
+		t.Error("instance was not restarted")
+	}
+}
+
+func TestPreStartHookOnFailure(t *testing.T) {
+	for _, tt := range []struct {
+		policy  string
+		started bool
+	}{
+		{"", false},
+		{"abort", false},
+		{"continue", true},
+	} {
+		t.Run("policy="+tt.policy, func(t *testing.T) {
+			r := &hookRecorder{fail: []string{instance.PreStart}}
+			_, i := hookInstance(t, r, map[string]string{
+				instance.PreStart: "exit 1",
+				"on-failure":      tt.policy,
+			})
+
+			err := instance.Start(i)
+			if (err == nil) != tt.started {
+				t.Errorf("Start() error = %v", err)
+			}
+			if instance.IsRunning(i) != tt.started {
+				t.Errorf("instance running = %v, want %v", instance.IsRunning(i), tt.started)
+			}
+			if hooks := r.hooks(); !slices.Equal(hooks, []string{instance.PreStart}) {
+				t.Errorf("hooks run = %v", hooks)
+			}
+		})
+	}
+}
+
+func TestHookTimeout(t *testing.T) {
+	r := &hookRecorder{sleep: time.Second}
+	_, i := hookInstance(t, r, map[string]string{
+		instance.PreStart: "sleep 10",
+		"timeout":         "50ms",
+	})
+
+	start := time.Now()
+	err := instance.Start(i)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Start() error = %v, want a timeout", err)
+	}
+	if d := time.Since(start); d >= r.sleep {
+		t.Errorf("Start() returned after %s, the hook timeout was not applied", d)
+	}
+	if instance.IsRunning(i) {
+		t.Error("instance started after the pre-start hook timed out")
+	}
+}
+
+func TestHookEnvironment(t *testing.T) {
+	r := &hookRecorder{}
+	h, i := hookInstance(t, r, map[string]string{instance.PreStart: "true"})
+	i.Config().Set("port", 7036)
+
+	if err := instance.RunHook(i, instance.PreStart); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.runs) != 1 {
+		t.Fatalf("hook run %d times", len(r.runs))
+	}
+	for _, want := range []string{
+		"GENEOS_HOOK=" + instance.PreStart,
+		"GENEOS_INSTANCE=" + i.String(),
+		"GENEOS_TYPE=netprobe",
+		"GENEOS_NAME=hooktest",
+		"GENEOS_HOST=" + h.String(),
+		"GENEOS_INSTANCE_HOME=" + i.Home(),
+		"GENEOS_PORT=7036",
+		"GENEOS_BASE=active_prod",
+		"GENEOS_VERSION=1.0.0",
+		"GENEOS_HOME=/opt/geneos",
+	} {
+		if !slices.Contains(r.runs[0], want) {
+			t.Errorf("hook environment %v does not contain %s", r.runs[0], want)
+		}
+	}
+}
+
+func TestUpdateHooksWithoutRestart(t *testing.T) {
+	r := &hookRecorder{}
+	h, i := hookInstance(t, r, map[string]string{
+		instance.PreUpdate:  "true",
+		instance.PostUpdate: "true",
+	})
+
+	if err := instance.Start(i); err != nil {
+		t.Fatal(err)
+	}
+	pid, err := instance.GetPID(i)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = geneos.Update(h, &netprobe.Netprobe,
+		geneos.Version("2.0.0"),
+		geneos.Basename("active_prod"),
+		geneos.Force(true),
+		geneos.Affected(i),
+		geneos.StartFunc(instance.Start),
+		geneos.StopFunc(instance.Stop),
+		geneos.HookFunc(instance.RunHook),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	if hooks := r.hooks(); !slices.Equal(hooks, []string{instance.PreUpdate, instance.PostUpdate}) {
+		t.Errorf("hooks run = %v", hooks)
+	}
+	if newpid, err := instance.GetPID(i); err != nil || newpid != pid {
+		t.Errorf("instance restarted without Restart(), pid %d -> %d (%v)", pid, newpid, err)
+	}
+}
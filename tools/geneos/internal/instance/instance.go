@@ -125,18 +125,39 @@ func Signal(i geneos.Instance, signal syscall.Signal) (err error) {
 // Do calls Instances() to resolve the names given to a list of matching
 // instances on host h (which can be geneos.ALL to look on all hosts)
 // and for type ct, which can be nil to look across all component types.
+// Instances are also limited to those matching the labels in Selector.
 func Do(h *geneos.Host, ct *geneos.Component, names []string, f func(geneos.Instance, ...any) *Response, values ...any) (responses Responses) {
+	return do(Instances(h, ct, FilterNames(names...)), f, values...)
+}
+
+// MaxParallel limits the number of instances on remote hosts that Do
+// and DoInOrder act on at the same time, to bound the number of
+// concurrent SSH sessions. Zero or less means no limit.
+var MaxParallel int
+
+// do runs f against each of instances in parallel and returns the
+// collected responses
+func do(instances []geneos.Instance, f func(geneos.Instance, ...any) *Response, values ...any) (responses Responses) {
 	var wg sync.WaitGroup
 
-	instances := Instances(h, ct, FilterNames(names...))
 	responses = make(Responses, len(instances))
 	ch := make(chan *Response, len(instances))
 
+	var remote chan struct{}
+	if MaxParallel > 0 {
+		remote = make(chan struct{}, MaxParallel)
+	}
+
 	for _, c := range instances {
 		wg.Add(1)
 		go func(c geneos.Instance) {
 			defer wg.Done()
 
+			if remote != nil && !c.Host().IsLocal() {
+				remote <- struct{}{}
+				defer func() { <-remote }()
+			}
+
 			resp := f(c, values...)
 			resp.Finish = time.Now()
 			ch <- resp
@@ -208,7 +229,9 @@ func Get(ct *geneos.Component, name string) (instance geneos.Instance, err error
 // Instances returns a slice of all instances on host h of component
 // type ct, where both can be nil in which case all hosts or component
 // types are used respectively. The options allow filtering based on
-// names or parameter matches.
+// names or parameter matches. Instances are also limited to those
+// matching the labels in Selector unless the IgnoreSelector option is
+// given.
 func Instances(h *geneos.Host, ct *geneos.Component, options ...InstanceOptions) (instances []geneos.Instance) {
 	var instanceNames []string
 
@@ -219,6 +242,9 @@ func Instances(h *geneos.Host, ct *geneos.Component, options ...InstanceOptions)
 	}
 
 	opts := evalInstanceOptions(options...)
+	if !opts.ignoreSelector {
+		opts.labels = append(opts.labels, Selector...)
+	}
 
 	if len(opts.names) > 0 {
 		instanceNames = slices.DeleteFunc(instanceNames, func(n string) bool {
@@ -242,25 +268,13 @@ func Instances(h *geneos.Host, ct *geneos.Component, options ...InstanceOptions)
 		instances = append(instances, instance)
 	}
 
-	if len(opts.parameters) > 0 {
-		params := map[string]string{}
-		for _, v := range opts.parameters {
-			if v == "" {
-				continue
-			}
-			s := strings.SplitN(v, "=", 2)
-			if len(s) == 2 {
-				params[s[0]] = s[1]
-			}
-		}
-
+	if len(opts.parameters) > 0 || len(opts.labels) > 0 {
 		instances = slices.DeleteFunc(instances, func(i geneos.Instance) bool {
-			for p, v := range params {
-				if i.Config().GetString(p) != v {
-					return true
-				}
+			if !matchTerms(opts.parameters, func(key string) string { return i.Config().GetString(key) }) {
+				return true
 			}
-			return false
+			labels := Labels(i)
+			return !matchTerms(opts.labels, func(key string) string { return labels[key] })
 		})
 	}
 
@@ -268,8 +282,10 @@ func Instances(h *geneos.Host, ct *geneos.Component, options ...InstanceOptions)
 }
 
 type instanceOptions struct {
-	names      []string
-	parameters []string
+	names          []string
+	parameters     []string
+	labels         []string
+	ignoreSelector bool
 }
 type InstanceOptions func(*instanceOptions)
 
@@ -287,9 +303,30 @@ func FilterNames(names ...string) InstanceOptions {
 	}
 }
 
+// FilterParameters limits instances to those where all the parameters,
+// in the form KEY=VALUE or KEY!=VALUE, match the instance
+// configuration
 func FilterParameters(parameters ...string) InstanceOptions {
 	return func(io *instanceOptions) {
-		io.parameters = parameters
+		io.parameters = append(io.parameters, parameters...)
+	}
+}
+
+// FilterLabels limits instances to those where all the labels, in the
+// form KEY=VALUE or KEY!=VALUE as returned by ParseSelector, match. A
+// label that is not set matches an empty VALUE.
+func FilterLabels(labels ...string) InstanceOptions {
+	return func(io *instanceOptions) {
+		io.labels = append(io.labels, labels...)
+	}
+}
+
+// IgnoreSelector returns all matching instances regardless of the
+// global Selector, for lookups that must see every instance, such as
+// checking which ports are in use
+func IgnoreSelector() InstanceOptions {
+	return func(io *instanceOptions) {
+		io.ignoreSelector = true
 	}
 }
 
@@ -22,6 +22,8 @@ import (
 	"io/fs"
 	"path"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
 	"github.com/rs/zerolog/log"
@@ -85,3 +87,41 @@ func Files(i geneos.Instance) (openfiles map[int]OpenFiles) {
 	}
 	return
 }
+
+// clockTicks is the kernel USER_HZ value used for CPU times in
+// /proc/PID/stat. It is 100 on all supported Linux platforms.
+const clockTicks = 100
+
+// ProcessUsage returns the resident set size in bytes and the total
+// user and system CPU time used by process pid for instance i, from
+// /proc on the instance host.
+func ProcessUsage(i geneos.Instance, pid int) (rss int64, cpu time.Duration, err error) {
+	stat, err := i.Host().ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return
+	}
+	// the command name in field 2 may contain spaces, so split the
+	// fields after the closing parenthesis, starting with field 3
+	s := string(stat)
+	fields := strings.Fields(s[strings.LastIndexByte(s, ')')+1:])
+	if len(fields) < 22 {
+		err = fmt.Errorf("/proc/%d/stat: unexpected format", pid)
+		return
+	}
+	utime, _ := strconv.ParseInt(fields[11], 10, 64)
+	stime, _ := strconv.ParseInt(fields[12], 10, 64)
+	cpu = time.Duration(utime+stime) * time.Second / clockTicks
+
+	status, err := i.Host().ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if v, ok := strings.CutPrefix(line, "VmRSS:"); ok {
+			kb, _ := strconv.ParseInt(strings.TrimSuffix(strings.TrimSpace(v), " kB"), 10, 64)
+			rss = kb * 1024
+			break
+		}
+	}
+	return
+}
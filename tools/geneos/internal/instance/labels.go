@@ -0,0 +1,96 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+)
+
+// Selector is the list of label terms, from ParseSelector, that limit
+// the instances returned by Instances, and so those Do and DoInOrder
+// act on, unless IgnoreSelector is given. An empty Selector matches all
+// instances.
+var Selector []string
+
+// ParseSelector splits the comma separated label selector s into the
+// terms used by FilterLabels. Each term must be in the form KEY=VALUE
+// or KEY!=VALUE. Label keys are case-insensitive and are returned in
+// lower case.
+func ParseSelector(s string) (terms []string, err error) {
+	for _, t := range strings.Split(s, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		op := "="
+		if strings.Contains(t, "!=") {
+			op = "!="
+		}
+		k, v, ok := strings.Cut(t, op)
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("%w: invalid term %q in selector %q, must be KEY=VALUE or KEY!=VALUE", geneos.ErrInvalidArgs, t, s)
+		}
+		terms = append(terms, strings.ToLower(k)+op+v)
+	}
+	return
+}
+
+// Labels returns the labels set on instance i
+func Labels(i geneos.Instance) (labels map[string]string) {
+	labels = map[string]string{}
+	for k, v := range i.Config().GetStringMap("labels") {
+		labels[k] = fmt.Sprint(v)
+	}
+	return
+}
+
+// LabelColumns returns the values of the labels keys on instance i, in
+// the same order, with empty used for any that are not set
+func LabelColumns(i geneos.Instance, keys []string, empty string) (values []string) {
+	labels := Labels(i)
+	for _, k := range keys {
+		v, ok := labels[strings.ToLower(k)]
+		if !ok || v == "" {
+			v = empty
+		}
+		values = append(values, v)
+	}
+	return
+}
+
+// matchTerms returns true if all the KEY=VALUE and KEY!=VALUE terms
+// match the values returned by value for each KEY. Terms without an
+// "=" are ignored.
+func matchTerms(terms []string, value func(key string) string) bool {
+	for _, t := range terms {
+		if k, v, ok := strings.Cut(t, "!="); ok {
+			if value(k) == v {
+				return false
+			}
+			continue
+		}
+		if k, v, ok := strings.Cut(t, "="); ok && value(k) != v {
+			return false
+		}
+	}
+	return true
+}
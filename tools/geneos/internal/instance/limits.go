@@ -0,0 +1,361 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"fmt"
+	"math"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/itrs-group/cordial/pkg/config"
+	"github.com/itrs-group/cordial/pkg/host"
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+)
+
+// CGroupRoot is the mount point of the cgroup v2 hierarchy. Relative
+// `cgroup::slice` settings are under this directory.
+const CGroupRoot = "/sys/fs/cgroup"
+
+// rlimits are the resource limits that can be set under `limits`, in
+// the order they are passed to prlimit(1). Limits with bytes set
+// accept k, m, g and t suffixes.
+var rlimits = []struct {
+	name  string
+	bytes bool
+}{
+	{"nofile", false},
+	{"nproc", false},
+	{"core", true},
+	{"as", true},
+}
+
+// ioClasses maps the names and numbers accepted for the `ionice`
+// setting to the I/O scheduling class names used by ionice(1) and
+// systemd
+var ioClasses = map[string]string{
+	"1":           "realtime",
+	"realtime":    "realtime",
+	"2":           "best-effort",
+	"best-effort": "best-effort",
+	"3":           "idle",
+	"idle":        "idle",
+}
+
+// startLimits are the validated resource limit, scheduling and cgroup
+// settings for an instance
+type startLimits struct {
+	rlimits   map[string]string // "SOFT[:HARD]" by rlimit name
+	nice      string
+	ioClass   string
+	ioLevel   string
+	cgroup    string // absolute cgroup directory
+	memoryMax string
+	cpuMax    string
+}
+
+func (l *startLimits) empty() bool {
+	return len(l.rlimits) == 0 && l.nice == "" && l.ioClass == "" && l.cgroup == ""
+}
+
+// getStartLimits returns the resource limit settings for instance i.
+// Each setting is looked up in the instance configuration, then the
+// global configuration under the component type and finally at the
+// top level of the global configuration. An error is returned for the
+// first invalid setting.
+func getStartLimits(i geneos.Instance) (l *startLimits, err error) {
+	l = &startLimits{rlimits: map[string]string{}}
+
+	for _, r := range rlimits {
+		key := config.Join("limits", r.name)
+		v := inheritedSetting(i, key)
+		if v == "" {
+			continue
+		}
+		if l.rlimits[r.name], err = parseRlimit(v, r.bytes); err != nil {
+			return nil, fmt.Errorf("%w: invalid %s %q: %w", geneos.ErrInvalidArgs, key, v, err)
+		}
+	}
+
+	if l.nice = inheritedSetting(i, "nice"); l.nice != "" {
+		if n, err := strconv.Atoi(l.nice); err != nil || n < -20 || n > 19 {
+			return nil, fmt.Errorf("%w: invalid nice %q, must be between -20 and 19", geneos.ErrInvalidArgs, l.nice)
+		}
+	}
+
+	if v := inheritedSetting(i, "ionice"); v != "" {
+		class, level, _ := strings.Cut(v, ":")
+		var ok bool
+		if l.ioClass, ok = ioClasses[strings.ToLower(class)]; !ok {
+			return nil, fmt.Errorf("%w: invalid ionice class %q, must be realtime, best-effort or idle", geneos.ErrInvalidArgs, class)
+		}
+		if level != "" {
+			if n, err := strconv.Atoi(level); err != nil || n < 0 || n > 7 || l.ioClass == "idle" {
+				return nil, fmt.Errorf("%w: invalid ionice level %q, must be between 0 and 7 and not for the idle class", geneos.ErrInvalidArgs, level)
+			}
+			l.ioLevel = level
+		}
+	}
+
+	if l.cgroup = inheritedSetting(i, config.Join("cgroup", "slice")); l.cgroup != "" {
+		if !path.IsAbs(l.cgroup) {
+			l.cgroup = path.Join(CGroupRoot, l.cgroup)
+		}
+		l.cgroup = path.Clean(l.cgroup)
+		if !strings.HasPrefix(l.cgroup, CGroupRoot+"/") {
+			return nil, fmt.Errorf("%w: cgroup slice %q is not under %s", geneos.ErrInvalidArgs, l.cgroup, CGroupRoot)
+		}
+		l.memoryMax = inheritedSetting(i, config.Join("cgroup", "memory.max"))
+		l.cpuMax = inheritedSetting(i, config.Join("cgroup", "cpu.max"))
+	}
+
+	return
+}
+
+// parseRlimit validates v, a limit in the form SOFT or SOFT:HARD, where
+// each value is a number or `unlimited`, and returns it in the form
+// used by prlimit(1). If bytes is set then values can have a k, m, g
+// or t suffix.
+func parseRlimit(v string, bytes bool) (limit string, err error) {
+	var values []string
+	for _, s := range strings.SplitN(v, ":", 2) {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s == "unlimited" || s == "infinity" {
+			values = append(values, "unlimited")
+			continue
+		}
+		mult := uint64(1)
+		if bytes && s != "" {
+			if n := strings.IndexByte("kmgt", s[len(s)-1]); n != -1 {
+				mult = 1 << (10 * (n + 1))
+				s = s[:len(s)-1]
+			}
+		}
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("%q is not a number or unlimited", s)
+		}
+		if n > math.MaxUint64/mult {
+			return "", fmt.Errorf("%q is too large", v)
+		}
+		values = append(values, strconv.FormatUint(n*mult, 10))
+	}
+	return strings.Join(values, ":"), nil
+}
+
+// applyLimits changes cmd, which should have been created by BuildCmd,
+// to apply the resource limits, nice and ionice values and cgroup
+// configured for instance i before running the program. These are only
+// supported on Linux hosts.
+//
+// The program is run from a shell that applies the settings to itself
+// using prlimit(1), ionice(1) and the cgroup v2 filesystem and then
+// uses nice(1) to exec the program, so the process ID is unchanged. If
+// any setting cannot be applied the shell exits without running the
+// program and the reason is written to the instance's start-up log.
+func applyLimits(i geneos.Instance, cmd *exec.Cmd) (err error) {
+	l, err := getStartLimits(i)
+	if err != nil || l.empty() {
+		return
+	}
+
+	if os := i.Host().GetString("os"); os != "linux" {
+		log.Warn().Msgf("%s: resource limits, nice, ionice and cgroup settings are not supported on %s, ignoring", i, os)
+		return
+	}
+
+	script := []string{"set -e"}
+
+	if l.cgroup != "" {
+		script = append(script,
+			"test -f "+CGroupRoot+"/cgroup.controllers || { echo cgroup v2 is not mounted on "+CGroupRoot+" >&2; exit 1; }",
+			"d="+host.ShellQuote(l.cgroup), `mkdir -p "$d"`,
+		)
+		if l.memoryMax != "" {
+			script = append(script, "echo "+host.ShellQuote(l.memoryMax)+` > "$d/memory.max"`)
+		}
+		if l.cpuMax != "" {
+			script = append(script, "echo "+host.ShellQuote(l.cpuMax)+` > "$d/cpu.max"`)
+		}
+		script = append(script, `echo $$ > "$d/cgroup.procs"`)
+	}
+
+	if len(l.rlimits) > 0 {
+		prlimit := "prlimit --pid $$"
+		for _, r := range rlimits {
+			if v, ok := l.rlimits[r.name]; ok {
+				prlimit += " --" + r.name + "=" + v
+			}
+		}
+		script = append(script, prlimit)
+	}
+
+	if l.ioClass != "" {
+		ionice := "ionice -c " + l.ioClass
+		if l.ioLevel != "" {
+			ionice += " -n " + l.ioLevel
+		}
+		script = append(script, ionice+" -p $$")
+	}
+
+	// nice(1) adjusts the current value, so subtract that to end up
+	// with the configured value
+	exe := `exec "$0" "$@"`
+	if l.nice != "" {
+		exe = `exec nice -n $((` + l.nice + ` - $(nice))) "$0" "$@"`
+	}
+	script = append(script, exe)
+
+	args := append([]string{"/bin/sh", "-c", strings.Join(script, "; ")}, cmd.Args...)
+	args[3] = cmd.Path
+	cmd.Path = "/bin/sh"
+	cmd.Args = args
+	return
+}
+
+// serviceLimits returns the systemd unit directives for the resource
+// limits, nice and ionice values and cgroup configured for instance i.
+// A cgroup slice is only used if its name ends in `.slice`.
+func serviceLimits(i geneos.Instance) (directives []string, err error) {
+	l, err := getStartLimits(i)
+	if err != nil || l.empty() {
+		return
+	}
+
+	for _, r := range rlimits {
+		if v, ok := l.rlimits[r.name]; ok {
+			directives = append(directives, fmt.Sprintf("Limit%s=%s", strings.ToUpper(r.name), strings.ReplaceAll(v, "unlimited", "infinity")))
+		}
+	}
+	if l.nice != "" {
+		directives = append(directives, "Nice="+l.nice)
+	}
+	if l.ioClass != "" {
+		directives = append(directives, "IOSchedulingClass="+l.ioClass)
+		if l.ioLevel != "" {
+			directives = append(directives, "IOSchedulingPriority="+l.ioLevel)
+		}
+	}
+	if l.cgroup != "" {
+		if slice := path.Base(l.cgroup); strings.HasSuffix(slice, ".slice") {
+			directives = append(directives, "Slice="+slice)
+		}
+		if l.memoryMax != "" {
+			directives = append(directives, "MemoryMax="+l.memoryMax)
+		}
+		if quota, period, ok := strings.Cut(l.cpuMax, " "); ok && quota != "max" {
+			q, qerr := strconv.Atoi(quota)
+			p, perr := strconv.Atoi(period)
+			if qerr == nil && perr == nil && p > 0 {
+				directives = append(directives, fmt.Sprintf("CPUQuota=%d%%", q*100/p))
+			}
+		}
+	}
+	return
+}
+
+// Limits are the effective resource limits, nice value and cgroup of
+// a running instance process. Each limit is either a single value, when
+// the soft and hard limits are the same, or SOFT:HARD.
+type Limits struct {
+	NoFile string `json:"nofile,omitempty"`
+	NProc  string `json:"nproc,omitempty"`
+	Core   string `json:"core,omitempty"`
+	AS     string `json:"as,omitempty"`
+	Nice   int    `json:"nice"`
+	CGroup string `json:"cgroup,omitempty"`
+}
+
+// String returns the limits as a space separated list of NAME=VALUE
+// pairs
+func (l Limits) String() string {
+	s := []string{
+		"nofile=" + l.NoFile,
+		"nproc=" + l.NProc,
+		"core=" + l.Core,
+		"as=" + l.AS,
+		"nice=" + strconv.Itoa(l.Nice),
+	}
+	if l.CGroup != "" {
+		s = append(s, "cgroup="+l.CGroup)
+	}
+	return strings.Join(s, " ")
+}
+
+// ProcessLimits returns the effective resource limits, nice value and
+// cgroup of process pid for instance i, from /proc on the instance
+// host
+func ProcessLimits(i geneos.Instance, pid int) (limits Limits, err error) {
+	h := i.Host()
+	file := fmt.Sprintf("/proc/%d/limits", pid)
+	b, err := h.ReadFile(file)
+	if err != nil {
+		return
+	}
+	lines := strings.Split(string(b), "\n")
+	// the limit names contain spaces, so use the column of the first
+	// heading after the name to split them from the values
+	col := strings.Index(lines[0], "Soft Limit")
+	if col == -1 {
+		err = fmt.Errorf("%s: unexpected format", file)
+		return
+	}
+	values := map[string]string{}
+	for _, line := range lines[1:] {
+		if len(line) <= col {
+			continue
+		}
+		f := strings.Fields(line[col:])
+		if len(f) < 2 {
+			continue
+		}
+		v := f[0]
+		if f[1] != f[0] {
+			v += ":" + f[1]
+		}
+		values[strings.TrimSpace(line[:col])] = v
+	}
+	limits.NoFile = values["Max open files"]
+	limits.NProc = values["Max processes"]
+	limits.Core = values["Max core file size"]
+	limits.AS = values["Max address space"]
+
+	// nice is field 19 of /proc/PID/stat, the 17th after the command
+	// name, which may contain spaces
+	if stat, err := h.ReadFile(fmt.Sprintf("/proc/%d/stat", pid)); err == nil {
+		s := string(stat)
+		if f := strings.Fields(s[strings.LastIndexByte(s, ')')+1:]); len(f) > 16 {
+			limits.Nice, _ = strconv.Atoi(f[16])
+		}
+	}
+
+	// the cgroup v2 entry has a hierarchy ID of 0 and no controllers
+	if cgroups, err := h.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid)); err == nil {
+		for _, line := range strings.Split(string(cgroups), "\n") {
+			if cg, ok := strings.CutPrefix(line, "0::"); ok {
+				limits.CGroup = cg
+				break
+			}
+		}
+	}
+	return
+}
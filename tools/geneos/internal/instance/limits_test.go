@@ -0,0 +1,30 @@
+package instance
+
+import "testing"
+
+func TestParseRlimit(t *testing.T) {
+	tests := []struct {
+		v     string
+		bytes bool
+		want  string
+		err   bool
+	}{
+		{"1024", false, "1024", false},
+		{"1024:4096", false, "1024:4096", false},
+		{"unlimited", false, "unlimited", false},
+		{"0:infinity", false, "0:unlimited", false},
+		{"2k", true, "2048", false},
+		{"1G:unlimited", true, "1073741824:unlimited", false},
+		{"2k", false, "", true},
+		{"lots", false, "", true},
+		{"16777215T", true, "18446742974197923840", false},
+		{"16777216T", true, "", true},
+		{"9999999999999G", true, "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseRlimit(tt.v, tt.bytes)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parseRlimit(%q, %v) = %q, %v", tt.v, tt.bytes, got, err)
+		}
+	}
+}
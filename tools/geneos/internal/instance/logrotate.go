@@ -0,0 +1,305 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/itrs-group/cordial/pkg/config"
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+)
+
+// LogRotatePolicy is the log rotation policy for an instance
+type LogRotatePolicy struct {
+	MaxSize  int64         // rotate when the log is at least this many bytes, 0 to disable
+	MaxAge   time.Duration // remove rotated generations older than this, 0 to disable
+	Keep     int           // number of rotated generations to keep
+	Compress bool          // gzip rotated generations
+}
+
+// default log rotation policy values
+const (
+	DefaultLogRotateKeep     = 5
+	DefaultLogRotateCompress = true
+)
+
+// LogRotateSettings returns the log rotation policy for instance i.
+// Each value is taken from the instance `logrotate::KEY` setting, if
+// set, else the global `TYPE::logrotate::KEY` setting for the
+// component type, else the global `logrotate::KEY` setting and finally
+// a built-in default. Invalid values are logged and ignored.
+func LogRotateSettings(i geneos.Instance) (policy LogRotatePolicy) {
+	policy = LogRotatePolicy{
+		Keep:     DefaultLogRotateKeep,
+		Compress: DefaultLogRotateCompress,
+	}
+
+	if v := logRotateSetting(i, "maxsize"); v != "" {
+		if size, err := parseSize(v); err == nil {
+			policy.MaxSize = size
+		} else {
+			log.Error().Err(err).Msgf("%s: logrotate::maxsize", i)
+		}
+	}
+	if v := logRotateSetting(i, "maxage"); v != "" {
+		if age, err := parseAge(v); err == nil {
+			policy.MaxAge = age
+		} else {
+			log.Error().Err(err).Msgf("%s: logrotate::maxage", i)
+		}
+	}
+	if v := logRotateSetting(i, "keep"); v != "" {
+		if keep, err := strconv.Atoi(v); err == nil && keep >= 0 {
+			policy.Keep = keep
+		} else {
+			log.Error().Msgf("%s: logrotate::keep: invalid value %q", i, v)
+		}
+	}
+	if v := logRotateSetting(i, "compress"); v != "" {
+		if compress, err := strconv.ParseBool(v); err == nil {
+			policy.Compress = compress
+		} else {
+			log.Error().Err(err).Msgf("%s: logrotate::compress", i)
+		}
+	}
+	return
+}
+
+func logRotateSetting(i geneos.Instance, key string) string {
+	if v := i.Config().GetString(config.Join("logrotate", key)); v != "" {
+		return v
+	}
+	if v := config.GetString(config.Join(i.Type().String(), "logrotate", key)); v != "" {
+		return v
+	}
+	return config.GetString(config.Join("logrotate", key))
+}
+
+// parseSize parses a size in bytes with an optional case-insensitive
+// suffix of K, M or G (powers of 1024), optionally followed by `B` or
+// `iB`, e.g. `100MB` or `1GiB`.
+func parseSize(s string) (size int64, err error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	v = strings.TrimSuffix(strings.TrimSuffix(v, "B"), "I")
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(v, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(v, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(v, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		v = v[:len(v)-1]
+	}
+	if size, err = strconv.ParseInt(strings.TrimSpace(v), 10, 64); err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return size * multiplier, nil
+}
+
+// parseAge parses a duration as for time.ParseDuration but also accepts
+// a whole number of days with a `d` suffix, e.g. `14d`.
+func parseAge(s string) (age time.Duration, err error) {
+	if d, ok := strings.CutSuffix(strings.TrimSpace(s), "d"); ok {
+		days, err := strconv.Atoi(d)
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// LogFiles returns the paths to all the log files for instance i that
+// can be rotated. This is the main log file, the STDOUT/STDERR capture
+// file and, for netprobes, the Collection Agent log file if configured.
+func LogFiles(i geneos.Instance) (logfiles []string) {
+	logfiles = []string{LogFilePath(i), ComponentFilepath(i, "txt")}
+	if i.Type().IsA("netprobe") {
+		if calog := PathOf(i, "calogfile"); calog != "" {
+			logfiles = append(logfiles, calog)
+		}
+	}
+	return
+}
+
+// LogGenerations returns the paths to the rotated generations of
+// logfile on the host of instance i, newest first. Compressed
+// generations end in `.gz`.
+func LogGenerations(i geneos.Instance, logfile string) (generations []string) {
+	paths, err := i.Host().Glob(logfile + ".*")
+	if err != nil {
+		return
+	}
+	numbered := map[int]string{}
+	for _, p := range paths {
+		if n := logGeneration(logfile, p); n > 0 {
+			numbered[n] = p
+		}
+	}
+	for _, n := range slices.Sorted(maps.Keys(numbered)) {
+		generations = append(generations, numbered[n])
+	}
+	return
+}
+
+// logGeneration returns the generation number of the rotated log p for
+// logfile, or 0 if p is not a rotated generation
+func logGeneration(logfile, p string) int {
+	suffix := strings.TrimSuffix(strings.TrimPrefix(p, logfile+"."), ".gz")
+	n, err := strconv.Atoi(suffix)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// OpenLog opens logfile on the host of instance i for reading,
+// decompressing it if the path ends in `.gz`
+func OpenLog(i geneos.Instance, logfile string) (r io.ReadCloser, err error) {
+	f, err := i.Host().Open(logfile)
+	if err != nil || !strings.HasSuffix(logfile, ".gz") {
+		return f, err
+	}
+	z, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{z, f}, nil
+}
+
+// RotateLog rotates logfile for instance i using policy. The log is
+// rotated if force is true or it is at least policy.MaxSize bytes.
+// Rotated generations beyond policy.Keep or older than policy.MaxAge
+// are removed whether or not the log is rotated.
+//
+// The current contents are copied to generation 1, compressed if
+// policy.Compress is set, and the log is then truncated so that a
+// running process can carry on writing to the same open file. Any
+// lines written between the copy and the truncate are lost. This works
+// on remote hosts over SFTP.
+func RotateLog(i geneos.Instance, logfile string, policy LogRotatePolicy, force bool) (rotated bool, err error) {
+	h := i.Host()
+
+	st, err := h.Stat(logfile)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+		return
+	}
+
+	if st.Size() > 0 && (force || (policy.MaxSize > 0 && st.Size() >= policy.MaxSize)) {
+		if policy.Keep > 0 {
+			generations := LogGenerations(i, logfile)
+			// shift, oldest first, so nothing is overwritten
+			for n := len(generations) - 1; n >= 0; n-- {
+				g := generations[n]
+				next := logGeneration(logfile, g) + 1
+				if next > policy.Keep {
+					if err = h.Remove(g); err != nil {
+						return
+					}
+					continue
+				}
+				dest := fmt.Sprintf("%s.%d", logfile, next)
+				if strings.HasSuffix(g, ".gz") {
+					dest += ".gz"
+				}
+				if err = h.Rename(g, dest); err != nil {
+					return
+				}
+			}
+			if err = copyLog(i, logfile, logfile+".1", st.Size(), policy.Compress); err != nil {
+				return
+			}
+		}
+		if err = h.Truncate(logfile, 0); err != nil {
+			return
+		}
+		rotated = true
+	}
+
+	for _, g := range LogGenerations(i, logfile) {
+		remove := logGeneration(logfile, g) > policy.Keep
+		if !remove && policy.MaxAge > 0 {
+			if gst, err := h.Stat(g); err == nil && time.Since(gst.ModTime()) > policy.MaxAge {
+				remove = true
+			}
+		}
+		if remove {
+			log.Debug().Msgf("%s: removing %s", i, g)
+			if err = h.Remove(g); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// copyLog copies the first size bytes of logfile to dest, which has
+// `.gz` appended if compress is true
+func copyLog(i geneos.Instance, logfile, dest string, size int64, compress bool) (err error) {
+	h := i.Host()
+
+	in, err := h.Open(logfile)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+
+	if compress {
+		dest += ".gz"
+	}
+	out, err := h.Create(dest, 0644)
+	if err != nil {
+		return
+	}
+	defer out.Close()
+
+	if !compress {
+		if _, err = io.CopyN(out, in, size); errors.Is(err, io.EOF) {
+			err = nil
+		}
+		return
+	}
+
+	z := gzip.NewWriter(out)
+	if _, err = io.CopyN(z, in, size); err != nil && !errors.Is(err, io.EOF) {
+		z.Close()
+		return
+	}
+	return z.Close()
+}
@@ -46,7 +46,7 @@ func GetAllPorts(h *geneos.Host) (ports map[uint16]bool) {
 		log.Fatal().Msg("getports() call with all hosts")
 	}
 	ports = make(map[uint16]bool)
-	for _, c := range Instances(h, nil) {
+	for _, c := range Instances(h, nil, IgnoreSelector()) {
 		if c.Loaded().IsZero() {
 			log.Error().Msgf("cannot load configuration for %s", c)
 			continue
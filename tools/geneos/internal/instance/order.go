@@ -0,0 +1,121 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+)
+
+// StartOrder returns the start order tier for instance i. This is the
+// instance `startorder` setting if set, otherwise the value for the
+// component type or geneos.DefaultStartOrder.
+func StartOrder(i geneos.Instance) int {
+	if order := i.Config().GetInt("startorder"); order != 0 {
+		return order
+	}
+	if i.Type() != nil && i.Type().StartOrder != 0 {
+		return i.Type().StartOrder
+	}
+	return geneos.DefaultStartOrder
+}
+
+// StartTiers groups instances by their StartOrder and returns them as
+// a slice of tiers, lowest first or, if reverse is true, highest first.
+func StartTiers(instances []geneos.Instance, reverse bool) (tiers [][]geneos.Instance) {
+	groups := make(map[int][]geneos.Instance)
+	for _, i := range instances {
+		order := StartOrder(i)
+		groups[order] = append(groups[order], i)
+	}
+
+	orders := slices.Sorted(maps.Keys(groups))
+	if reverse {
+		slices.Reverse(orders)
+	}
+	for _, o := range orders {
+		tiers = append(tiers, groups[o])
+	}
+	return
+}
+
+// DoInOrder works like Do but runs f on each tier of instances from
+// StartTiers in turn. Instances within a tier are run in parallel.
+//
+// If wait is non-zero then, before moving on to the next tier, DoInOrder
+// waits up to that duration for all the instances in the current tier
+// that f did not return an error for to be running and listening on at
+// least one TCP port. Use reverse to stop instances.
+func DoInOrder(h *geneos.Host, ct *geneos.Component, names []string, reverse bool, wait time.Duration, f func(geneos.Instance, ...any) *Response, values ...any) (responses Responses) {
+	responses = make(Responses)
+
+	tiers := StartTiers(Instances(h, ct, FilterNames(names...)), reverse)
+	for n, tier := range tiers {
+		r := do(tier, f, values...)
+		maps.Copy(responses, r)
+
+		// nothing to wait for after the last tier
+		if wait == 0 || n == len(tiers)-1 {
+			continue
+		}
+
+		var ready []geneos.Instance
+		for _, i := range tier {
+			if resp, ok := r[i.String()]; ok && resp.Err == nil && IsRunning(i) {
+				ready = append(ready, i)
+			}
+		}
+		WaitForListening(ready, wait)
+	}
+	return
+}
+
+// WaitForListening waits for up to timeout for each of instances to
+// be running and listening on at least one TCP port. It returns the
+// instances that were not ready in time, logging a warning for each.
+func WaitForListening(instances []geneos.Instance, timeout time.Duration) (notready []geneos.Instance) {
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+
+	for _, i := range instances {
+		wg.Add(1)
+		go func(i geneos.Instance) {
+			defer wg.Done()
+
+			deadline := time.Now().Add(timeout)
+			for time.Now().Before(deadline) {
+				if IsRunning(i) && len(ListeningPorts(i)) > 0 {
+					return
+				}
+				time.Sleep(250 * time.Millisecond)
+			}
+			log.Warn().Msgf("%s not listening after %s, continuing", i, timeout)
+			mutex.Lock()
+			notready = append(notready, i)
+			mutex.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	return
+}
@@ -0,0 +1,241 @@
+/*
+Copyright © 2024 ITRS Group
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
+)
+
+// ServiceTarget is the name of the systemd target unit that groups
+// all the instance service units
+const ServiceTarget = "geneos.target"
+
+// systemd unit file directories for system and user units
+const (
+	SystemUnitDir = "/etc/systemd/system"
+	UserUnitDir   = ".config/systemd/user"
+)
+
+// IsServiceManaged returns true if instance i has had a systemd unit
+// installed by `service install`, in which case Start and Stop use
+// systemctl instead of managing the process directly.
+func IsServiceManaged(i geneos.Instance) bool {
+	return i.Config().GetString("service") != ""
+}
+
+// ServiceName returns the systemd unit name for instance i, in the
+// form `geneos-TYPE-NAME.service`. Characters not valid in unit names
+// are replaced with underscores.
+func ServiceName(i geneos.Instance) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, i.Name())
+	return fmt.Sprintf("geneos-%s-%s.service", i.Type(), name)
+}
+
+// ServiceUnitDir returns the directory on host h that unit files are
+// written to. If user is true this is the systemd user directory under
+// the home directory of the user on h.
+func ServiceUnitDir(h *geneos.Host, user bool) string {
+	if !user {
+		return SystemUnitDir
+	}
+	return path.Join(h.GetString("homedir"), UserUnitDir)
+}
+
+// ServiceEnvFile returns the path to the environment file referenced by
+// the unit for instance i
+func ServiceEnvFile(i geneos.Instance) string {
+	return ComponentFilepath(i, "env")
+}
+
+// ServiceUnit returns the contents of a systemd unit for instance i and
+// of the environment file it references. The command line and
+// environment are the same as those used by Start, from BuildCmd. The
+// environment file contains decoded secure environment variables and
+// must be written with restricted permissions. Resource limits, nice
+// and ionice values and cgroup settings are converted to the
+// equivalent systemd directives.
+//
+// The unit is ordered after the units for the instances in after,
+// which should be those on the same host with a lower StartOrder.
+func ServiceUnit(i geneos.Instance, user bool, after []geneos.Instance) (unit, env []byte, err error) {
+	cmd := BuildCmd(i, false)
+	if cmd == nil {
+		err = fmt.Errorf("%s: cannot build command", i)
+		return
+	}
+	limits, err := serviceLimits(i)
+	if err != nil {
+		return
+	}
+
+	var e bytes.Buffer
+	for _, v := range cmd.Env {
+		fmt.Fprintln(&e, serviceEnvQuote(v))
+	}
+	env = e.Bytes()
+
+	afterUnits := []string{"network-online.target"}
+	for _, a := range after {
+		afterUnits = append(afterUnits, ServiceName(a))
+	}
+
+	var u bytes.Buffer
+	fmt.Fprintf(&u, "# generated by geneos service install, do not edit\n")
+	fmt.Fprintf(&u, "[Unit]\n")
+	fmt.Fprintf(&u, "Description=Geneos %s %s\n", i.Type(), i.Name())
+	fmt.Fprintf(&u, "Wants=network-online.target\n")
+	fmt.Fprintf(&u, "After=%s\n", strings.Join(afterUnits, " "))
+	fmt.Fprintf(&u, "PartOf=%s\n", ServiceTarget)
+	fmt.Fprintf(&u, "\n[Service]\n")
+	fmt.Fprintf(&u, "Type=simple\n")
+	if !user {
+		// never default to the user running the command, usually root,
+		// but to the owner of the instance home directory
+		username := i.Config().GetString("user")
+		if username == "" {
+			if st, err := i.Host().Stat(i.Home()); err == nil {
+				if uid := i.Host().GetFileOwner(st).Uid; uid != 0 {
+					username = strconv.Itoa(uid)
+				}
+			}
+		}
+		if username == "" {
+			err = fmt.Errorf("%s: %w: set `user` for a system unit, the instance home directory is owned by root or the owner is not known", i, geneos.ErrInvalidArgs)
+			return
+		}
+		fmt.Fprintf(&u, "User=%s\n", username)
+	}
+	fmt.Fprintf(&u, "WorkingDirectory=%s\n", cmd.Dir)
+	fmt.Fprintf(&u, "EnvironmentFile=%s\n", ServiceEnvFile(i))
+	fmt.Fprintf(&u, "ExecStart=%s\n", serviceQuote(cmd.Args...))
+	fmt.Fprintf(&u, "StandardOutput=append:%s\n", ComponentFilepath(i, "txt"))
+	fmt.Fprintf(&u, "StandardError=append:%s\n", ComponentFilepath(i, "txt"))
+	fmt.Fprintf(&u, "KillSignal=SIGTERM\n")
+	fmt.Fprintf(&u, "TimeoutStopSec=10\n")
+	fmt.Fprintf(&u, "Restart=no\n")
+	for _, l := range limits {
+		fmt.Fprintln(&u, l)
+	}
+	fmt.Fprintf(&u, "\n[Install]\n")
+	fmt.Fprintf(&u, "WantedBy=%s\n", ServiceTarget)
+	unit = u.Bytes()
+	return
+}
+
+// ServiceTargetUnit returns the contents of the target unit that groups
+// all the instance units
+func ServiceTargetUnit(user bool) []byte {
+	wantedBy := "multi-user.target"
+	if user {
+		wantedBy = "default.target"
+	}
+	return fmt.Appendf(nil, `# generated by geneos service install, do not edit
+[Unit]
+Description=Geneos instances
+Wants=network-online.target
+After=network-online.target
+
+[Install]
+WantedBy=%s
+`, wantedBy)
+}
+
+// serviceQuote quotes args for an ExecStart line, escaping the
+// characters systemd treats specially
+func serviceQuote(args ...string) string {
+	quoted := []string{}
+	for _, a := range args {
+		a = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$").Replace(a)
+		if a == "" || strings.ContainsAny(a, " \t'") {
+			a = `"` + a + `"`
+		}
+		quoted = append(quoted, a)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// serviceEnvQuote returns the environment variable v, in NAME=VALUE
+// form, as a line for an EnvironmentFile. The value is double quoted
+// and the characters systemd unescapes inside double quotes are
+// escaped, so that quotes, backslashes (including a trailing one) and
+// newlines are passed through unchanged.
+func serviceEnvQuote(v string) string {
+	name, value, _ := strings.Cut(v, "=")
+	return name + `="` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", "$", `\$`).Replace(value) + `"`
+}
+
+// Systemctl runs systemctl on host h with args and returns the output.
+// If user is true then the `--user` flag is added.
+func Systemctl(h *geneos.Host, user bool, args ...string) (output []byte, err error) {
+	if user {
+		args = append([]string{"--user"}, args...)
+	}
+	cmd := exec.Command("systemctl", args...)
+	log.Debug().Msgf("%s: running %s", h, cmd.String())
+	output, err = h.Run(cmd, "")
+	if err != nil {
+		err = fmt.Errorf("systemctl %s: %w", strings.Join(args, " "), err)
+	}
+	return
+}
+
+// serviceStart starts instance i through systemctl
+func serviceStart(i geneos.Instance) (err error) {
+	if _, err = Systemctl(i.Host(), i.Config().GetBool("serviceuser"), "start", i.Config().GetString("service")); err != nil {
+		return
+	}
+	time.Sleep(250 * time.Millisecond)
+	pid, err := GetPID(i)
+	if err != nil {
+		return err
+	}
+	clearStopped(i)
+	fmt.Printf("%s started with PID %d (via systemd unit %s)\n", i, pid, i.Config().GetString("service"))
+	return
+}
+
+// serviceStop stops instance i through systemctl. If kill is true then
+// the process is sent a SIGKILL first.
+func serviceStop(i geneos.Instance, kill bool) (err error) {
+	user := i.Config().GetBool("serviceuser")
+	unit := i.Config().GetString("service")
+	if kill {
+		if _, err = Systemctl(i.Host(), user, "kill", "--signal=SIGKILL", unit); err != nil {
+			return
+		}
+	}
+	_, err = Systemctl(i.Host(), user, "stop", unit)
+	return
+}
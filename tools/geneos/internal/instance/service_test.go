@@ -0,0 +1,22 @@
+package instance
+
+import "testing"
+
+func TestServiceEnvQuote(t *testing.T) {
+	tests := []struct {
+		v    string
+		want string
+	}{
+		{"A=b", `A="b"`},
+		{"A=", `A=""`},
+		{"A=b=c", `A="b=c"`},
+		{`A=say "hi"`, `A="say \"hi\""`},
+		{`A=C:\dir\`, `A="C:\\dir\\"`},
+		{"A=$HOME `id`", "A=\"\\$HOME \\`id\\`\""},
+	}
+	for _, tt := range tests {
+		if got := serviceEnvQuote(tt.v); got != tt.want {
+			t.Errorf("serviceEnvQuote(%q) = %s, want %s", tt.v, got, tt.want)
+		}
+	}
+}
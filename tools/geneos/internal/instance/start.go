@@ -28,7 +28,10 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-// Start runs the instance.
+// Start runs the instance. The pre-start and post-start hooks, if
+// configured, are run around starting the instance, see RunHook. A
+// post-start hook failure is logged but not returned, as the instance
+// has already been started.
 func Start(i geneos.Instance, opts ...any) (err error) {
 	if IsRunning(i) {
 		return geneos.ErrRunning
@@ -57,10 +60,38 @@ func Start(i geneos.Instance, opts ...any) (err error) {
 			options = append(options, option)
 		}
 	}
+
+	// a systemd unit has a fixed command line and environment
+	if so := evalStartOptions(options...); IsServiceManaged(i) && (len(so.extras) > 0 || len(so.envs) > 0) {
+		return fmt.Errorf("%s: %w: extra arguments and environment variables cannot be used with an instance managed by systemd", i, geneos.ErrInvalidArgs)
+	}
+
+	if err = RunHook(i, PreStart); err != nil {
+		return
+	}
+	if err = start(i, options...); err != nil {
+		return
+	}
+	if err := RunHook(i, PostStart); err != nil {
+		log.Error().Err(err).Msgf("%s: started but %s hook failed", i, PostStart)
+	}
+	return
+}
+
+// start runs the instance, either through the service manager or
+// directly, once all the checks in Start have passed
+func start(i geneos.Instance, options ...StartOptions) (err error) {
+	if IsServiceManaged(i) {
+		return serviceStart(i)
+	}
+
 	cmd := BuildCmd(i, false, options...)
 	if cmd == nil {
 		return fmt.Errorf("BuildCmd() returned nil")
 	}
+	if err = applyLimits(i, cmd); err != nil {
+		return
+	}
 
 	// set underlying user for child proc
 	errfile := ComponentFilepath(i, "txt")
@@ -75,6 +106,7 @@ func Start(i geneos.Instance, opts ...any) (err error) {
 	if err != nil {
 		return err
 	}
+	clearStopped(i)
 	fmt.Printf("%s started with PID %d\n", i, pid)
 	return nil
 }
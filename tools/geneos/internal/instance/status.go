@@ -40,6 +40,16 @@ func IsDisabled(i geneos.Instance) bool {
 	return false
 }
 
+// IsStopped returns true if the instance i was last stopped by the
+// user and has not been started since.
+func IsStopped(i geneos.Instance) bool {
+	d := ComponentFilepath(i, geneos.StoppedExtension)
+	if f, err := i.Host().Stat(d); err == nil && f.Mode().IsRegular() {
+		return true
+	}
+	return false
+}
+
 // IsProtected returns true if instance i is marked protected
 func IsProtected(i geneos.Instance) bool {
 	return i.Config().GetBool("protected")
@@ -28,7 +28,11 @@ import (
 	"github.com/itrs-group/cordial/tools/geneos/internal/geneos"
 )
 
-// Stop an instance
+// Stop an instance. The pre-stop and post-stop hooks, if configured,
+// are run around stopping the instance, see RunHook. A post-stop hook
+// failure is logged but not returned, as the instance has already been
+// stopped and callers, such as restarts, rely on a nil error to know
+// that.
 func Stop(i geneos.Instance, force, kill bool) (err error) {
 	if !force && IsProtected(i) {
 		return geneos.ErrProtected
@@ -39,6 +43,25 @@ func Stop(i geneos.Instance, force, kill bool) (err error) {
 		return os.ErrProcessDone
 	}
 
+	if err = RunHook(i, PreStop); err != nil {
+		return
+	}
+	if err = stop(i, kill); err != nil {
+		return
+	}
+	if err := RunHook(i, PostStop); err != nil {
+		log.Error().Err(err).Msgf("%s: stopped but %s hook failed", i, PostStop)
+	}
+	return
+}
+
+// stop signals the instance to stop, or asks the service manager to
+// stop it, and waits for it to exit
+func stop(i geneos.Instance, kill bool) (err error) {
+	if IsServiceManaged(i) {
+		return serviceStop(i, kill)
+	}
+
 	// start := time.Now()
 
 	if !kill {
@@ -72,3 +95,24 @@ func Stop(i geneos.Instance, force, kill bool) (err error) {
 	}
 	return
 }
+
+// MarkStopped records that the instance i was stopped by the user. The
+// mark is removed the next time the instance is started by Start.
+func MarkStopped(i geneos.Instance) (err error) {
+	f, err := i.Host().Create(ComponentFilepath(i, geneos.StoppedExtension), 0664)
+	if err != nil {
+		return
+	}
+	return f.Close()
+}
+
+// clearStopped removes any stopped mark from instance i
+func clearStopped(i geneos.Instance) {
+	stoppedFile := ComponentFilepath(i, geneos.StoppedExtension)
+	if _, err := i.Host().Stat(stoppedFile); err != nil {
+		return
+	}
+	if err := i.Host().Remove(stoppedFile); err != nil {
+		log.Debug().Err(err).Msgf("%s: cannot remove %s", i, stoppedFile)
+	}
+}
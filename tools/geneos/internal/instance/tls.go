@@ -107,6 +107,7 @@ func CreateCert(i geneos.Instance, duration time.Duration) (resp *Response) {
 		resp.Err = err
 		return
 	}
+	geneos.RecordIssued(signingCert, cert, i.String(), i.Host().String())
 
 	if err = WriteKey(i, key); err != nil {
 		resp.Err = err
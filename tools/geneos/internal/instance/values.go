@@ -51,6 +51,9 @@ type SetConfigValues struct {
 	// Types for SAN templates
 	Types Types
 
+	// Labels are free-form key=value pairs used to select instances
+	Labels LabelValues
+
 	// Params are key=value pairs set directly in the configuration after checking
 	Params []string
 
@@ -122,6 +125,10 @@ func SetInstanceValues(i geneos.Instance, set SetConfigValues, keyfile config.Ke
 	setMap(i, set.Includes, "includes")
 	setMap(i, set.Variables, "variables")
 
+	if len(set.Labels) > 0 {
+		setMap(i, set.Labels, "labels")
+	}
+
 	return
 }
 
@@ -314,6 +321,31 @@ func (i *Gateways) Type() string {
 	return "HOSTNAME:PORT"
 }
 
+// labels - key=value
+type LabelValues map[string]string
+
+const LabelValuesOptionsText = "A label in the format KEY=VALUE, used by --selector\n(Repeat as required)"
+
+func (l *LabelValues) String() string {
+	return ""
+}
+
+func (l *LabelValues) Set(value string) error {
+	if *l == nil {
+		*l = LabelValues{}
+	}
+	k, v, ok := strings.Cut(value, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("label %q must be in the form KEY=VALUE", value)
+	}
+	(*l)[strings.ToLower(k)] = v
+	return nil
+}
+
+func (l *LabelValues) Type() string {
+	return "KEY=VALUE"
+}
+
 // attribute - name=value
 type NameValues []string
 
@@ -447,6 +479,7 @@ type UnsetConfigValues struct {
 	Gateways   UnsetValues
 	Includes   UnsetValues
 	Keys       UnsetValues
+	Labels     UnsetValues
 	Types      UnsetValues
 	Variables  UnsetVars
 }
@@ -468,6 +501,16 @@ func UnsetInstanceValues(i geneos.Instance, unset UnsetConfigValues) (changed bo
 	}
 	unsetMapHex(i, "variables", unset.Variables)
 
+	if len(unset.Labels) > 0 {
+		changed = true
+		// label keys are stored in lower case
+		labels := UnsetValues{}
+		for _, k := range unset.Labels {
+			labels = append(labels, strings.ToLower(k))
+		}
+		unsetMap(i, "labels", labels)
+	}
+
 	if len(unset.Attributes) > 0 {
 		changed = true
 	}
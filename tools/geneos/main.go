@@ -35,6 +35,7 @@ import (
 	_ "github.com/itrs-group/cordial/tools/geneos/cmd/hostcmd"
 	_ "github.com/itrs-group/cordial/tools/geneos/cmd/initcmd"
 	_ "github.com/itrs-group/cordial/tools/geneos/cmd/pkgcmd"
+	_ "github.com/itrs-group/cordial/tools/geneos/cmd/servicecmd"
 	_ "github.com/itrs-group/cordial/tools/geneos/cmd/tlscmd"
 
 	// each component type registers itself when imported here
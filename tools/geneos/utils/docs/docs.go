@@ -28,6 +28,7 @@ import (
 	_ "github.com/itrs-group/cordial/tools/geneos/cmd/hostcmd"
 	_ "github.com/itrs-group/cordial/tools/geneos/cmd/initcmd"
 	_ "github.com/itrs-group/cordial/tools/geneos/cmd/pkgcmd"
+	_ "github.com/itrs-group/cordial/tools/geneos/cmd/servicecmd"
 	_ "github.com/itrs-group/cordial/tools/geneos/cmd/tlscmd"
 
 	// components from internals for documentation